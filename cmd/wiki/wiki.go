@@ -2,19 +2,97 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/suzuken/wiki"
+	"github.com/suzuken/wiki/mail"
+	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/sso"
 )
 
 func main() {
 	var (
-		addr   = flag.String("addr", ":8080", "addr to bind")
-		dbconf = flag.String("dbconf", "dbconfig.yml", "database configuration file.")
-		env    = flag.String("env", "development", "application envirionment (production, development etc.)")
-		debug  = flag.Bool("debug", false, "debug mode. default is false.")
+		addr     = flag.String("addr", ":8080", "addr to bind")
+		dbconf   = flag.String("dbconf", "dbconfig.yml", "database configuration file.")
+		conf     = flag.String("config", "config.yml", "configuration file of secret keys. keys are also read from WIKI_CSRF_KEYS, WIKI_SESSION_HASH_KEYS and WIKI_SESSION_ENCRYPTION_KEYS.")
+		env      = flag.String("env", "development", "application envirionment (production, development etc.)")
+		debug    = flag.Bool("debug", false, "debug mode. default is false.")
+		baseURL  = flag.String("url", "http://localhost:8080", "URL of the wiki used in emails.")
+		smtpAddr = flag.String("smtp", "", "host:port of SMTP server. If empty, emails are written to -mail-log.")
+		mailFrom = flag.String("mail-from", "wiki@localhost", "sender address of emails.")
+		mailLog  = flag.String("mail-log", "", "file to write emails instead of sending. default is stderr.")
+		memSess  = flag.Bool("memory-sessions", false, "keep sessions in memory instead of database. they are lost on exit, and not shared among instances.")
+		purge    = flag.Duration("purge-unverified", 7*24*time.Hour, "delete users who have not verified email addresses for this duration. 0 disables.")
+
+		oidcIssuer   = flag.String("oidc-issuer", "", "issuer URL of OpenID Connect provider for single sign-on. If empty, single sign-on is disabled.")
+		oidcClientID = flag.String("oidc-client-id", "", "client ID registered at the OpenID Connect provider.")
+		oidcGroups   = flag.String("oidc-groups-claim", "groups", "claim of ID tokens listing groups of the user.")
+		oidcRoles    = flag.String("oidc-roles", "", "comma separated group=role pairs to set roles of users by their groups, like wiki-admins=admin,staff=editor.")
 	)
 	flag.Parse()
 	b := wiki.New()
+	b.BaseURL = *baseURL
+	b.ConfigFile = *conf
+	b.MemorySessions = *memSess
+	b.UnverifiedTTL = *purge
+	switch {
+	case *smtpAddr != "":
+		m := &mail.SMTP{Addr: *smtpAddr, From: *mailFrom}
+		// credentials are given by environment not to be seen in process list.
+		if user := os.Getenv("SMTP_USERNAME"); user != "" {
+			host, _, err := net.SplitHostPort(*smtpAddr)
+			if err != nil {
+				log.Fatalf("invalid SMTP address: %s", err)
+			}
+			m.Auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		b.Mailer = m
+	case *mailLog != "":
+		f, err := os.OpenFile(*mailLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			log.Fatalf("cannot open mail log: %s", err)
+		}
+		defer f.Close()
+		b.Mailer = mail.NewLog(f, *mailFrom)
+	default:
+		b.Mailer = mail.NewLog(os.Stderr, *mailFrom)
+	}
+	if *oidcIssuer != "" {
+		roles, err := parseRoles(*oidcRoles)
+		if err != nil {
+			log.Fatalf("invalid -oidc-roles: %s", err)
+		}
+		// the secret is given by environment not to be seen in process list.
+		b.OIDC = &sso.Config{
+			Issuer:       *oidcIssuer,
+			ClientID:     *oidcClientID,
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			GroupsClaim:  *oidcGroups,
+			Roles:        roles,
+		}
+	}
 	b.Init(*dbconf, *env, *debug)
 	b.Run(*addr)
 }
+
+// parseRoles parses comma separated group=role pairs.
+func parseRoles(s string) (map[string]string, error) {
+	roles := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || !model.IsRole(strings.TrimSpace(kv[1])) {
+			return nil, fmt.Errorf("%q is not group=role", pair)
+		}
+		roles[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return roles, nil
+}
@@ -0,0 +1,204 @@
+// Package config loads configuration of the application, such as secret
+// keys to sign cookies.
+//
+// Keys are read from a YAML file of each environment, and overridden by
+// environment variables. Keys are encoded by base64, like outputs of
+// `openssl rand -base64 32`. To rotate keys, put the new key first and keep
+// old ones after it: the first key signs new cookies, and all keys are
+// accepted for cookies signed before.
+//
+//	production:
+//	  csrf_keys:
+//	    - <new key>
+//	    - <old key>
+//	  session_keys:
+//	    - hash: <new hash key>
+//	      encryption: <new encryption key>
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v1"
+)
+
+// Production is the environment which refuses to start with default keys.
+const Production = "production"
+
+// Environment variables of keys, which are comma separated lists of keys.
+// Session hash and encryption keys are paired in order.
+const (
+	EnvCSRFKeys              = "WIKI_CSRF_KEYS"
+	EnvSessionHashKeys       = "WIKI_SESSION_HASH_KEYS"
+	EnvSessionEncryptionKeys = "WIKI_SESSION_ENCRYPTION_KEYS"
+)
+
+// Default keys are used when no keys are configured, so that the wiki runs
+// in development without configuration. They are public, so never use them
+// in production.
+var (
+	defaultCSRFKey           = []byte("go-wiki-insecure-default-csrfkey")
+	defaultSessionHash       = []byte("go-wiki-insecure-default-hashkey")
+	defaultSessionEncryption = []byte("go-wiki-insecure-default-enckey!")
+)
+
+// Config is configuration of the application.
+type Config struct {
+	// CSRFKeys sign CSRF tokens. The first one signs new tokens, and the
+	// others are accepted for tokens signed before rotation.
+	CSRFKeys [][]byte
+	// SessionKeys sign and encrypt session cookies, in the same order as
+	// CSRFKeys.
+	SessionKeys []SessionKey
+}
+
+// SessionKey is a pair of keys of session cookies.
+type SessionKey struct {
+	Hash       []byte
+	Encryption []byte
+}
+
+// SessionKeyPairs returns keys as arguments of sessions.NewCookieStore.
+func (c *Config) SessionKeyPairs() [][]byte {
+	pairs := make([][]byte, 0, 2*len(c.SessionKeys))
+	for _, k := range c.SessionKeys {
+		pairs = append(pairs, k.Hash, k.Encryption)
+	}
+	return pairs
+}
+
+// file is the configuration of an environment in the file.
+type file struct {
+	CSRFKeys    []string         `yaml:"csrf_keys"`
+	SessionKeys []sessionKeyFile `yaml:"session_keys"`
+}
+
+// sessionKeyFile is a pair of session keys in the file.
+type sessionKeyFile struct {
+	Hash       string `yaml:"hash"`
+	Encryption string `yaml:"encryption"`
+}
+
+// Load reads configuration of the environment from the file and environment
+// variables. The file may be empty or missing. Keys which are not configured
+// are defaults, except in production.
+func Load(path, env string) (*Config, error) {
+	var r io.Reader = strings.NewReader("")
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			defer f.Close()
+			r = f
+		}
+	}
+	return load(r, env, os.Getenv)
+}
+
+// load reads configuration from r, and environment variables by getenv.
+func load(r io.Reader, env string, getenv func(string) string) (*Config, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var files map[string]file
+	if err := yaml.Unmarshal(b, &files); err != nil {
+		return nil, err
+	}
+	f := files[env]
+	if v := getenv(EnvCSRFKeys); v != "" {
+		f.CSRFKeys = strings.Split(v, ",")
+	}
+	if h, e := getenv(EnvSessionHashKeys), getenv(EnvSessionEncryptionKeys); h != "" || e != "" {
+		hashes, encryptions := strings.Split(h, ","), strings.Split(e, ",")
+		if len(hashes) != len(encryptions) {
+			return nil, fmt.Errorf("%s and %s should have the same number of keys", EnvSessionHashKeys, EnvSessionEncryptionKeys)
+		}
+		f.SessionKeys = nil
+		for i := range hashes {
+			f.SessionKeys = append(f.SessionKeys, sessionKeyFile{Hash: hashes[i], Encryption: encryptions[i]})
+		}
+	}
+
+	c := &Config{}
+	for i, s := range f.CSRFKeys {
+		k, err := decodeKey(s, fmt.Sprintf("csrf_keys[%d]", i), 32)
+		if err != nil {
+			return nil, err
+		}
+		c.CSRFKeys = append(c.CSRFKeys, k)
+	}
+	for i, s := range f.SessionKeys {
+		hash, err := decodeKey(s.Hash, fmt.Sprintf("session_keys[%d].hash", i), 32, 64)
+		if err != nil {
+			return nil, err
+		}
+		encryption, err := decodeKey(s.Encryption, fmt.Sprintf("session_keys[%d].encryption", i), 16, 24, 32)
+		if err != nil {
+			return nil, err
+		}
+		c.SessionKeys = append(c.SessionKeys, SessionKey{Hash: hash, Encryption: encryption})
+	}
+	if len(c.CSRFKeys) == 0 {
+		c.CSRFKeys = [][]byte{defaultCSRFKey}
+	}
+	if len(c.SessionKeys) == 0 {
+		c.SessionKeys = []SessionKey{{Hash: defaultSessionHash, Encryption: defaultSessionEncryption}}
+	}
+	if env == Production && c.usesDefaults() {
+		return nil, fmt.Errorf("default keys cannot be used in %s. configure csrf_keys and session_keys, or %s, %s and %s",
+			Production, EnvCSRFKeys, EnvSessionHashKeys, EnvSessionEncryptionKeys)
+	}
+	return c, nil
+}
+
+// usesDefaults reports whether any of keys is the default one.
+func (c *Config) usesDefaults() bool {
+	for _, k := range c.CSRFKeys {
+		if bytes.Equal(k, defaultCSRFKey) {
+			return true
+		}
+	}
+	for _, k := range c.SessionKeys {
+		if bytes.Equal(k.Hash, defaultSessionHash) || bytes.Equal(k.Encryption, defaultSessionEncryption) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeKey decodes the base64 key of the name, which should be one of
+// lengths in bytes.
+func decodeKey(s, name string, lengths ...int) ([]byte, error) {
+	k, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not base64: %s", name, err)
+	}
+	for _, l := range lengths {
+		if len(k) == l {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("%s should be %s bytes, got %d bytes", name, joinInts(lengths), len(k))
+}
+
+// joinInts returns lengths like "16, 24 or 32".
+func joinInts(ns []int) string {
+	s := fmt.Sprint(ns[0])
+	for i, n := range ns[1:] {
+		if i == len(ns)-2 {
+			s += fmt.Sprintf(" or %d", n)
+		} else {
+			s += fmt.Sprintf(", %d", n)
+		}
+	}
+	return s
+}
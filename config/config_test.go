@@ -0,0 +1,90 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// key returns base64 of n bytes of c.
+func key(c byte, n int) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{c}, n))
+}
+
+func TestLoad(t *testing.T) {
+	file := `
+production:
+  csrf_keys:
+    - ` + key('a', 32) + `
+    - ` + key('b', 32) + `
+  session_keys:
+    - hash: ` + key('c', 64) + `
+      encryption: ` + key('d', 32) + `
+    - hash: ` + key('e', 32) + `
+      encryption: ` + key('f', 16) + `
+`
+	c, err := load(strings.NewReader(file), "production", func(string) string { return "" })
+	if err != nil {
+		t.Fatalf("load failed: %s", err)
+	}
+	if len(c.CSRFKeys) != 2 || c.CSRFKeys[0][0] != 'a' || c.CSRFKeys[1][0] != 'b' {
+		t.Errorf("unexpected CSRF keys: %q", c.CSRFKeys)
+	}
+	pairs := c.SessionKeyPairs()
+	if len(pairs) != 4 || pairs[0][0] != 'c' || pairs[1][0] != 'd' || pairs[2][0] != 'e' || pairs[3][0] != 'f' {
+		t.Errorf("unexpected session keys: %q", pairs)
+	}
+
+	// environment variables override the file.
+	env := map[string]string{
+		EnvCSRFKeys:              key('g', 32),
+		EnvSessionHashKeys:       key('h', 32) + "," + key('i', 32),
+		EnvSessionEncryptionKeys: key('j', 32) + "," + key('k', 24),
+	}
+	c, err = load(strings.NewReader(file), "production", func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("load failed: %s", err)
+	}
+	if len(c.CSRFKeys) != 1 || c.CSRFKeys[0][0] != 'g' {
+		t.Errorf("unexpected CSRF keys: %q", c.CSRFKeys)
+	}
+	if pairs := c.SessionKeyPairs(); len(pairs) != 4 || pairs[0][0] != 'h' || pairs[3][0] != 'k' {
+		t.Errorf("unexpected session keys: %q", pairs)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	noenv := func(string) string { return "" }
+	c, err := load(strings.NewReader(""), "development", noenv)
+	if err != nil {
+		t.Fatalf("load failed: %s", err)
+	}
+	if len(c.CSRFKeys) != 1 || len(c.CSRFKeys[0]) != 32 || len(c.SessionKeys) != 1 {
+		t.Errorf("want default keys, got %+v", c)
+	}
+	if _, err := load(strings.NewReader(""), Production, noenv); err == nil {
+		t.Error("default keys should be error in production")
+	}
+	// only CSRF keys are configured.
+	file := "production:\n  csrf_keys:\n    - " + key('a', 32) + "\n"
+	if _, err := load(strings.NewReader(file), Production, noenv); err == nil {
+		t.Error("default session keys should be error in production")
+	}
+}
+
+func TestLoadInvalidKeys(t *testing.T) {
+	tests := []map[string]string{
+		{EnvCSRFKeys: key('a', 21)},
+		{EnvCSRFKeys: "not base64!"},
+		{EnvSessionHashKeys: key('a', 16), EnvSessionEncryptionKeys: key('b', 16)},
+		{EnvSessionHashKeys: key('a', 32), EnvSessionEncryptionKeys: key('b', 20)},
+		{EnvSessionHashKeys: key('a', 32)},
+		{EnvSessionHashKeys: key('a', 32) + "," + key('c', 32), EnvSessionEncryptionKeys: key('b', 32)},
+	}
+	for i, env := range tests {
+		if _, err := load(strings.NewReader(""), "development", func(k string) string { return env[k] }); err == nil {
+			t.Errorf("%d: invalid keys should be error: %v", i, env)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/view"
+)
+
+// ACL is controller for access control lists of articles and namespaces.
+// It is only for admins.
+type ACL struct {
+	Store model.ACLStore
+	// Users, Groups and Articles are used for showing whom and what
+	// entries apply to.
+	Users    model.UserStore
+	Groups   model.GroupStore
+	Articles model.ArticleStore
+}
+
+// List shows all ACL entries and the form to add an entry.
+// The form is prefilled by article or namespace parameter.
+func (c *ACL) List(w http.ResponseWriter, r *http.Request) error {
+	acls, err := c.Store.ACLsAll()
+	if err != nil {
+		return err
+	}
+	users, err := c.Users.UsersAll()
+	if err != nil {
+		return err
+	}
+	groups, err := c.Groups.GroupsAll()
+	if err != nil {
+		return err
+	}
+	userNames := make(map[int64]string, len(users))
+	for _, u := range users {
+		userNames[u.ID] = u.Name
+	}
+	groupNames := make(map[int64]string, len(groups))
+	for _, g := range groups {
+		groupNames[g.ID] = g.Name
+	}
+	titles := make(map[int64]string)
+	for _, acl := range acls {
+		if _, ok := titles[acl.ArticleID]; acl.ArticleID == 0 || ok {
+			continue
+		}
+		a, err := c.Articles.ArticleOne(principal(r), acl.ArticleID)
+		if err != nil {
+			return err
+		}
+		titles[a.ID] = a.Title
+	}
+	return view.Default(w, r, http.StatusOK, "acl.tmpl", map[string]interface{}{
+		"title":       "Access control - go-wiki",
+		"acls":        acls,
+		"users":       users,
+		"groups":      groups,
+		"userNames":   userNames,
+		"groupNames":  groupNames,
+		"titles":      titles,
+		"permissions": model.ACLPermissions,
+		"article":     r.FormValue("article"),
+		"namespace":   r.FormValue("namespace"),
+	})
+}
+
+// Create adds an ACL entry. It applies to the article given by article
+// form value, or to the namespace given by namespace form value. It grants
+// permission form value to the user or the group given by user or group
+// form value.
+func (c *ACL) Create(w http.ResponseWriter, r *http.Request) error {
+	acl := model.ACL{Permission: model.Permission(r.PostFormValue("permission"))}
+	if !model.IsACLPermission(acl.Permission) {
+		return &httputil.HTTPError{Status: http.StatusBadRequest}
+	}
+	if v := strings.TrimSpace(r.PostFormValue("article")); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return &httputil.HTTPError{Status: http.StatusBadRequest, Err: err}
+		}
+		if _, err := c.Articles.ArticleOne(principal(r), id); err != nil {
+			return notFound(err)
+		}
+		acl.ArticleID = id
+	} else {
+		ns := strings.TrimSpace(r.PostFormValue("namespace"))
+		if !strings.HasSuffix(ns, "/") {
+			ns += "/"
+		}
+		if !model.IsNamespace(ns) {
+			return &httputil.HTTPError{Status: http.StatusBadRequest}
+		}
+		acl.Namespace = ns
+	}
+	var err error
+	if v := r.PostFormValue("user"); v != "" {
+		acl.UserID, err = strconv.ParseInt(v, 10, 64)
+	} else {
+		acl.GroupID, err = strconv.ParseInt(r.PostFormValue("group"), 10, 64)
+	}
+	if err != nil || acl.UserID == 0 && acl.GroupID == 0 {
+		return &httputil.HTTPError{Status: http.StatusBadRequest, Err: err}
+	}
+	if err := c.Store.InsertACL(&acl); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/admin/acl", http.StatusFound)
+	return nil
+}
+
+// Delete deletes the ACL entry given by id form value.
+func (c *ACL) Delete(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.ParseInt(r.PostFormValue("id"), 10, 64)
+	if err != nil {
+		return &httputil.HTTPError{Status: http.StatusBadRequest, Err: err}
+	}
+	if err := c.Store.DeleteACL(id); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/admin/acl", http.StatusFound)
+	return nil
+}
@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/model"
+)
+
+var (
+	errArticleNotFound = errors.New("article not found")
+	errTitleRequired   = errors.New("title is required")
+	errConflict        = errors.New("article has been updated since the revision")
+)
+
+// ArticlesResponse is the response of article list API.
+type ArticlesResponse struct {
+	Articles []model.Article `json:"articles"`
+	Total    int             `json:"total"`
+	Page     int             `json:"page"`
+	PerPage  int             `json:"per_page"`
+}
+
+// ArticleRequest is the request body to create or update an article.
+// If Revision is given on update, the update is rejected when the article
+// has newer revision.
+type ArticleRequest struct {
+	Title    string `json:"title"`
+	Body     string `json:"body"`
+	Revision int64  `json:"revision,omitempty"`
+}
+
+// writeJSON writes v as JSON response with status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+// readArticleRequest decodes the request body.
+func readArticleRequest(r *http.Request) (ArticleRequest, error) {
+	var req ArticleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, &httputil.HTTPError{Status: http.StatusBadRequest, Err: err}
+	}
+	if strings.TrimSpace(req.Title) == "" {
+		return req, &httputil.HTTPError{Status: http.StatusBadRequest, Err: errTitleRequired}
+	}
+	return req, nil
+}
+
+// apiArticleID returns the article id of path like /api/v1/articles/{id}.
+func apiArticleID(path string) (int64, error) {
+	id, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(path, "/api/v1/articles/"), "/"), 10, 64)
+	if err != nil {
+		return 0, &httputil.HTTPError{Status: http.StatusNotFound, Err: errArticleNotFound}
+	}
+	return id, nil
+}
+
+// apiNotFound makes errors for missing articles into 404 errors.
+func apiNotFound(err error) error {
+	if errors.Cause(err) == model.ErrNotFound {
+		return &httputil.HTTPError{Status: http.StatusNotFound, Err: errArticleNotFound}
+	}
+	return err
+}
+
+// APIList returns articles as JSON.
+// page and sort parameters work as same as the top page.
+func (t *Article) APIList(w http.ResponseWriter, r *http.Request) error {
+	sort := r.FormValue("sort")
+	if !model.IsArticleSort(sort) {
+		sort = model.SortUpdated
+	}
+	page := pageNumber(r)
+	articles, err := t.Store.ArticlesPage(principal(r), sort, (page-1)*articlesPerPage, articlesPerPage)
+	if err != nil {
+		return err
+	}
+	total, err := t.Store.ArticlesCount(principal(r))
+	if err != nil {
+		return err
+	}
+	if articles == nil {
+		articles = []model.Article{}
+	}
+	return writeJSON(w, http.StatusOK, ArticlesResponse{
+		Articles: articles,
+		Total:    total,
+		Page:     page,
+		PerPage:  articlesPerPage,
+	})
+}
+
+// APIGet returns the article as JSON.
+func (t *Article) APIGet(w http.ResponseWriter, r *http.Request) error {
+	id, err := apiArticleID(r.URL.Path)
+	if err != nil {
+		return err
+	}
+	article, err := t.Store.ArticleOne(principal(r), id)
+	if err != nil {
+		return apiNotFound(err)
+	}
+	return writeJSON(w, http.StatusOK, article)
+}
+
+// APICreate creates new article from JSON request,
+// and returns the created article.
+func (t *Article) APICreate(w http.ResponseWriter, r *http.Request) error {
+	req, err := readArticleRequest(r)
+	if err != nil {
+		return err
+	}
+	m := &model.Article{Title: req.Title, Body: req.Body}
+	if err := t.authorize(r, *m, model.PermEdit); err != nil {
+		return err
+	}
+	if err := t.Store.InsertArticle(m, edit(r, m)); err != nil {
+		return err
+	}
+	t.indexArticle(m)
+	article, err := t.Store.ArticleOne(principal(r), m.ID)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/api/v1/articles/"+strconv.FormatInt(m.ID, 10))
+	return writeJSON(w, http.StatusCreated, article)
+}
+
+// APIUpdate updates the article by JSON request,
+// and returns the updated article.
+func (t *Article) APIUpdate(w http.ResponseWriter, r *http.Request) error {
+	id, err := apiArticleID(r.URL.Path)
+	if err != nil {
+		return err
+	}
+	req, err := readArticleRequest(r)
+	if err != nil {
+		return err
+	}
+	m := &model.Article{ID: id, Title: req.Title, Body: req.Body}
+	if err := t.authorizeUpdate(r, m, model.PermEdit); err != nil {
+		return apiNotFound(err)
+	}
+	e := edit(r, m)
+	e.BaseRevision = req.Revision
+	if err := t.Store.UpdateArticle(m, e); err != nil {
+		if errors.Cause(err) == model.ErrConflict {
+			return &httputil.HTTPError{Status: http.StatusConflict, Err: errConflict}
+		}
+		return apiNotFound(err)
+	}
+	t.indexArticle(m)
+	if t.Locks != nil {
+		t.Locks.Release(id, CurrentUserID(r))
+	}
+	article, err := t.Store.ArticleOne(principal(r), id)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, article)
+}
+
+// APIDelete deletes the article.
+func (t *Article) APIDelete(w http.ResponseWriter, r *http.Request) error {
+	id, err := apiArticleID(r.URL.Path)
+	if err != nil {
+		return err
+	}
+	article, err := t.Store.ArticleOne(principal(r), id)
+	if err != nil {
+		return apiNotFound(err)
+	}
+	if err := t.authorize(r, article, model.PermDelete); err != nil {
+		return err
+	}
+	if err := t.Store.DeleteArticle(id); err != nil {
+		return err
+	}
+	if t.Index != nil {
+		t.Index.Remove(id)
+	}
+	if t.Locks != nil {
+		t.Locks.Remove(id)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
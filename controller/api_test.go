@@ -0,0 +1,188 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/suzuken/wiki/controller"
+	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/model"
+)
+
+// admin is the user who can do everything.
+var admin = model.User{ID: 1, Name: "admin", Role: model.RoleAdmin}
+
+// as returns the request sent by the user.
+func as(u model.User, r *http.Request) *http.Request {
+	return controller.WithUser(r, u)
+}
+
+func TestArticleAPI(t *testing.T) {
+	store := model.NewMemoryStore()
+	article := &controller.Article{Store: store, Users: store}
+
+	rec := httptest.NewRecorder()
+	req := as(admin, httptest.NewRequest("POST", "/api/v1/articles", strings.NewReader(`{"title":"Go","body":"gopher"}`)))
+	if err := article.APICreate(rec, req); err != nil {
+		t.Fatalf("create failed: %s", err)
+	}
+	if rec.Code != http.StatusCreated {
+		t.Errorf("want %d, got %d", http.StatusCreated, rec.Code)
+	}
+	var created model.Article
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == 0 || created.Title != "Go" || created.Body != "gopher" {
+		t.Errorf("unexpected article: %+v", created)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/api/v1/articles/1" {
+		t.Errorf("unexpected location: %s", loc)
+	}
+
+	rec = httptest.NewRecorder()
+	req = as(admin, httptest.NewRequest("PUT", "/api/v1/articles/1", strings.NewReader(`{"title":"Go","body":"gopher!"}`)))
+	if err := article.APIUpdate(rec, req); err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+
+	rec = httptest.NewRecorder()
+	req = as(admin, httptest.NewRequest("GET", "/api/v1/articles", nil))
+	if err := article.APIList(rec, req); err != nil {
+		t.Fatalf("list failed: %s", err)
+	}
+	var list controller.ArticlesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 1 || len(list.Articles) != 1 || list.Articles[0].Body != "gopher!" {
+		t.Errorf("unexpected list: %+v", list)
+	}
+
+	rec = httptest.NewRecorder()
+	req = as(admin, httptest.NewRequest("DELETE", "/api/v1/articles/1", nil))
+	if err := article.APIDelete(rec, req); err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("want %d, got %d", http.StatusNoContent, rec.Code)
+	}
+}
+
+func TestArticleAPIErrors(t *testing.T) {
+	store := model.NewMemoryStore()
+	article := &controller.Article{Store: store, Users: store}
+	tests := []struct {
+		h      func(w http.ResponseWriter, r *http.Request) error
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{article.APIGet, "GET", "/api/v1/articles/1", "", http.StatusNotFound},
+		{article.APIGet, "GET", "/api/v1/articles/abc", "", http.StatusNotFound},
+		{article.APICreate, "POST", "/api/v1/articles", `{"body":"no title"}`, http.StatusBadRequest},
+		{article.APICreate, "POST", "/api/v1/articles", `{`, http.StatusBadRequest},
+		{article.APIUpdate, "PUT", "/api/v1/articles/1", `{"title":"missing"}`, http.StatusNotFound},
+		{article.APIDelete, "DELETE", "/api/v1/articles/1", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := as(admin, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		err := tt.h(httptest.NewRecorder(), req)
+		e, ok := err.(*httputil.HTTPError)
+		if !ok {
+			t.Errorf("%s %s: want HTTPError, got %v", tt.method, tt.path, err)
+			continue
+		}
+		if e.Status != tt.status {
+			t.Errorf("%s %s: want %d, got %d", tt.method, tt.path, tt.status, e.Status)
+		}
+	}
+}
+
+func TestArticleAPIConflict(t *testing.T) {
+	store := model.NewMemoryStore()
+	article := &controller.Article{Store: store, Users: store}
+	m := &model.Article{Title: "Go", Body: "v1"}
+	if err := store.InsertArticle(m, model.Edit{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateArticle(&model.Article{ID: m.ID, Title: "Go", Body: "v2"}, model.Edit{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the update based on the first revision is stale.
+	req := as(admin, httptest.NewRequest("PUT", "/api/v1/articles/1", strings.NewReader(`{"title":"Go","body":"v3","revision":1}`)))
+	err := article.APIUpdate(httptest.NewRecorder(), req)
+	if e, ok := err.(*httputil.HTTPError); !ok || e.Status != http.StatusConflict {
+		t.Errorf("want conflict, got %v", err)
+	}
+	req = as(admin, httptest.NewRequest("PUT", "/api/v1/articles/1", strings.NewReader(`{"title":"Go","body":"v3","revision":2}`)))
+	if err := article.APIUpdate(httptest.NewRecorder(), req); err != nil {
+		t.Errorf("update on the latest revision failed: %s", err)
+	}
+}
+
+func TestArticleAPIACL(t *testing.T) {
+	store := model.NewMemoryStore()
+	article := &controller.Article{Store: store, Users: store}
+	for _, title := range []string{"Home", "HR/Payroll"} {
+		if err := store.InsertArticle(&model.Article{Title: title}, model.Edit{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader := model.User{ID: 2, Role: model.RoleEditor, EmailVerified: true}
+	other := model.User{ID: 3, Role: model.RoleEditor, EmailVerified: true}
+	if err := store.InsertACL(&model.ACL{Namespace: "HR/", UserID: reader.ID, Permission: model.PermRead}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user   model.User
+		h      func(w http.ResponseWriter, r *http.Request) error
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{reader, article.APIGet, "GET", "/api/v1/articles/2", "", http.StatusOK},
+		{reader, article.APIUpdate, "PUT", "/api/v1/articles/2", `{"title":"HR/Payroll"}`, http.StatusForbidden},
+		{reader, article.APICreate, "POST", "/api/v1/articles", `{"title":"HR/New"}`, http.StatusForbidden},
+		// editors can not move articles into the restricted namespace.
+		{reader, article.APIUpdate, "PUT", "/api/v1/articles/1", `{"title":"HR/Home"}`, http.StatusForbidden},
+		{other, article.APIGet, "GET", "/api/v1/articles/2", "", http.StatusNotFound},
+		{other, article.APIUpdate, "PUT", "/api/v1/articles/2", `{"title":"HR/Payroll"}`, http.StatusNotFound},
+		{other, article.APIDelete, "DELETE", "/api/v1/articles/2", "", http.StatusNotFound},
+		{admin, article.APIGet, "GET", "/api/v1/articles/2", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := as(tt.user, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		status := http.StatusOK
+		if err := tt.h(httptest.NewRecorder(), req); err != nil {
+			e, ok := err.(*httputil.HTTPError)
+			if !ok {
+				t.Errorf("user %d %s %s: want HTTPError, got %v", tt.user.ID, tt.method, tt.path, err)
+				continue
+			}
+			status = e.Status
+		}
+		if status != tt.status {
+			t.Errorf("user %d %s %s: want %d, got %d", tt.user.ID, tt.method, tt.path, tt.status, status)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	if err := article.APIList(rec, as(other, httptest.NewRequest("GET", "/api/v1/articles", nil))); err != nil {
+		t.Fatal(err)
+	}
+	var list controller.ArticlesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 1 || len(list.Articles) != 1 || list.Articles[0].Title != "Home" {
+		t.Errorf("restricted article should not be listed: %+v", list)
+	}
+}
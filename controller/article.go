@@ -1,52 +1,398 @@
 package controller
 
 import (
-	"database/sql"
-	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/pkg/errors"
+	"github.com/suzuken/wiki/diff"
+	"github.com/suzuken/wiki/editlock"
 	"github.com/suzuken/wiki/httputil"
 	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/search"
 	"github.com/suzuken/wiki/view"
 )
 
+const (
+	// searchPerPage is the number of search results in a page.
+	searchPerPage = 10
+	// articlesPerPage is the number of articles in a page of the top page.
+	articlesPerPage = 20
+)
+
 // Article is controller for requests to articles.
 type Article struct {
-	DB *sql.DB
+	Store model.ArticleStore
+	// Users is used for showing who edited articles.
+	Users model.UserStore
+	Index *search.Index
+	// Locks tells who is editing articles. Optional.
+	Locks *editlock.Table
+}
+
+// edit returns the edit of the article made by the request.
+func edit(r *http.Request, m *model.Article) model.Edit {
+	return model.Edit{
+		UserID:     CurrentUserID(r),
+		LinkIDs:    view.ArticleRefs(m.Body),
+		LinkTitles: view.WikiLinkTitles(m.Body),
+	}
+}
+
+// indexArticle updates search index for the article.
+func (t *Article) indexArticle(m *model.Article) {
+	if t.Index == nil {
+		return
+	}
+	t.Index.Add(search.Document{ID: m.ID, Title: m.Title, Body: m.Body})
+}
+
+// authorize checks if current user can do p with the article. The article
+// is not found for users who can not even read it.
+func (t *Article) authorize(r *http.Request, a model.Article, p model.Permission) error {
+	u, _ := CurrentUser(r)
+	access, err := t.Store.ArticleAccess(u.Principal(), a)
+	if err != nil {
+		return err
+	}
+	switch {
+	case access.Allows(&u, p):
+		return nil
+	case a.ID != 0 && !access.Allows(&u, model.PermRead):
+		return &httputil.HTTPError{Status: http.StatusNotFound, Err: errArticleNotFound}
+	}
+	return &httputil.HTTPError{Status: http.StatusForbidden, Err: ErrForbidden}
+}
+
+// permissions returns what current user can do with the article,
+// keyed by names of permissions for templates.
+func (t *Article) permissions(r *http.Request, a model.Article) (map[string]bool, error) {
+	u, _ := CurrentUser(r)
+	access, err := t.Store.ArticleAccess(u.Principal(), a)
+	if err != nil {
+		return nil, err
+	}
+	can := make(map[string]bool, len(model.ACLPermissions))
+	for _, p := range model.ACLPermissions {
+		can[string(p)] = access.Allows(&u, p)
+	}
+	return can, nil
+}
+
+// editingLock returns the lock of the article by other than current user.
+func (t *Article) editingLock(r *http.Request, id int64) *editlock.Lock {
+	if t.Locks == nil {
+		return nil
+	}
+	l, ok := t.Locks.Holder(id)
+	if !ok || l.UserID == CurrentUserID(r) {
+		return nil
+	}
+	return &l
+}
+
+// links resolves wiki links in the body to ids of articles. Articles
+// current user can not read are left unresolved, as if they were missing.
+func (t *Article) links(r *http.Request, body string) (map[string]int64, error) {
+	links, err := t.Store.ArticleIDsByTitles(view.WikiLinkTitles(body))
+	if err != nil {
+		return nil, err
+	}
+	hidden, err := t.Store.HiddenArticleIDs(principal(r))
+	if err != nil {
+		return nil, err
+	}
+	for title, id := range links {
+		if hidden[id] {
+			delete(links, title)
+		}
+	}
+	return links, nil
+}
+
+// Search finds articles by the query given by q parameter.
+// Articles current user can not read are excluded.
+func (t *Article) Search(w http.ResponseWriter, r *http.Request) error {
+	q := r.FormValue("q")
+	var result search.Result
+	page := pageNumber(r)
+	if t.Index != nil {
+		hidden, err := t.Store.HiddenArticleIDs(principal(r))
+		if err != nil {
+			return err
+		}
+		result = t.Index.SearchExcept(q, (page-1)*searchPerPage, searchPerPage, hidden)
+	}
+	return view.Default(w, r, http.StatusOK, "search.tmpl", map[string]interface{}{
+		"title":  fmt.Sprintf("Search: %s - go-wiki", q),
+		"q":      q,
+		"result": result,
+		"pager":  NewPager(r, result.Total, searchPerPage),
+	})
 }
 
 // Root indicates / path as top page.
+// Articles are paginated by page parameter, and ordered by sort parameter
+// which is one of updated (default), created and title.
 func (t *Article) Root(w http.ResponseWriter, r *http.Request) error {
 	if r.URL.Path != "/" {
 		http.NotFound(w, r)
 		return nil
 	}
-	articles, err := model.ArticlesAll(t.DB)
+	sort := r.FormValue("sort")
+	if !model.IsArticleSort(sort) {
+		sort = model.SortUpdated
+	}
+	page := pageNumber(r)
+	articles, err := t.Store.ArticlesPage(principal(r), sort, (page-1)*articlesPerPage, articlesPerPage)
+	if err != nil {
+		return err
+	}
+	total, err := t.Store.ArticlesCount(principal(r))
+	if err != nil {
+		return err
+	}
+	ids := make([]int64, 0, len(articles))
+	for _, a := range articles {
+		ids = append(ids, a.AuthorID)
+	}
+	users, err := t.Users.UserNames(ids)
 	if err != nil {
 		return err
 	}
 	return view.Default(w, r, http.StatusOK, "index.tmpl", map[string]interface{}{
 		"title":    "TOP - wiki",
 		"articles": articles,
+		"users":    users,
+		"sort":     sort,
+		"pager":    NewPager(r, total, articlesPerPage),
 	})
 }
 
 // Get returns specified article.
+// Sub resources of the article such as /article/{id}/history are also
+// dispatched from here.
 func (t *Article) Get(w http.ResponseWriter, r *http.Request) error {
-	var id int64
-	if _, err := fmt.Sscanf(r.URL.Path, "/article/%d", &id); err != nil {
+	id, sub, err := articlePath(r.URL.Path)
+	if err != nil {
 		return err
 	}
-	article, err := model.ArticleOne(t.DB, id)
+	switch {
+	case len(sub) == 0:
+		return t.Show(w, r, id)
+	case len(sub) == 1 && sub[0] == "history":
+		return t.History(w, r, id)
+	case len(sub) == 1 && sub[0] == "diff":
+		return t.Diff(w, r, id)
+	case len(sub) == 1 && sub[0] == "backlinks":
+		return t.Backlinks(w, r, id)
+	case len(sub) == 2 && sub[0] == "revision":
+		rev, err := strconv.ParseInt(sub[1], 10, 64)
+		if err != nil {
+			return &httputil.HTTPError{Status: http.StatusNotFound, Err: err}
+		}
+		return t.Revision(w, r, id, rev)
+	}
+	http.NotFound(w, r)
+	return nil
+}
+
+// articlePath splits path like /article/{id}/history into
+// the article id and rest of the path.
+func articlePath(path string) (int64, []string, error) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/article/"), "/"), "/")
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, nil, &httputil.HTTPError{Status: http.StatusNotFound, Err: err}
+	}
+	return id, parts[1:], nil
+}
+
+// Show renders the article.
+func (t *Article) Show(w http.ResponseWriter, r *http.Request, id int64) error {
+	article, err := t.Store.ArticleOne(principal(r), id)
+	if err != nil {
+		return notFound(err)
+	}
+	can, err := t.permissions(r, article)
+	if err != nil {
+		return err
+	}
+	links, err := t.links(r, article.Body)
+	if err != nil {
+		return err
+	}
+	backlinks, err := t.Store.Backlinks(principal(r), article.ID, article.Title)
+	if err != nil {
+		return err
+	}
+	users, err := t.Users.UserNames([]int64{article.AuthorID, article.LastEditorID})
 	if err != nil {
 		return err
 	}
 	return view.Default(w, r, http.StatusOK, "article.tmpl", map[string]interface{}{
-		"title":   fmt.Sprintf("%s - go-wiki", article.Title),
-		"article": article,
+		"title":     fmt.Sprintf("%s - go-wiki", article.Title),
+		"article":   article,
+		"links":     view.Links(links),
+		"backlinks": backlinks,
+		"users":     users,
+		"lock":      t.editingLock(r, id),
+		"can":       can,
+	})
+}
+
+// Backlinks lists articles linking to the article.
+func (t *Article) Backlinks(w http.ResponseWriter, r *http.Request, id int64) error {
+	article, err := t.Store.ArticleOne(principal(r), id)
+	if err != nil {
+		return notFound(err)
+	}
+	backlinks, err := t.Store.Backlinks(principal(r), article.ID, article.Title)
+	if err != nil {
+		return err
+	}
+	return view.Default(w, r, http.StatusOK, "backlinks.tmpl", map[string]interface{}{
+		"title":     fmt.Sprintf("What links to %s - go-wiki", article.Title),
+		"article":   article,
+		"backlinks": backlinks,
+	})
+}
+
+// Orphans lists articles which no other article links to.
+func (t *Article) Orphans(w http.ResponseWriter, r *http.Request) error {
+	articles, err := t.Store.OrphanArticles(principal(r))
+	if err != nil {
+		return err
+	}
+	return view.Default(w, r, http.StatusOK, "orphans.tmpl", map[string]interface{}{
+		"title":    "Orphan articles - go-wiki",
+		"articles": articles,
+	})
+}
+
+// BrokenLinks lists links to articles which do not exist.
+func (t *Article) BrokenLinks(w http.ResponseWriter, r *http.Request) error {
+	links, err := t.Store.BrokenLinks(principal(r))
+	if err != nil {
+		return err
+	}
+	return view.Default(w, r, http.StatusOK, "brokenlinks.tmpl", map[string]interface{}{
+		"title": "Broken links - go-wiki",
+		"links": links,
+	})
+}
+
+// History lists revisions of the article.
+func (t *Article) History(w http.ResponseWriter, r *http.Request, id int64) error {
+	article, err := t.Store.ArticleOne(principal(r), id)
+	if err != nil {
+		return notFound(err)
+	}
+	revisions, err := t.Store.Revisions(id)
+	if err != nil {
+		return err
+	}
+	ids := make([]int64, 0, len(revisions))
+	for _, rev := range revisions {
+		ids = append(ids, rev.UserID)
+	}
+	users, err := t.Users.UserNames(ids)
+	if err != nil {
+		return err
+	}
+	return view.Default(w, r, http.StatusOK, "history.tmpl", map[string]interface{}{
+		"title":     fmt.Sprintf("History of %s - go-wiki", article.Title),
+		"article":   article,
+		"revisions": revisions,
+		"users":     users,
+	})
+}
+
+// Revision renders the article as of given revision.
+func (t *Article) Revision(w http.ResponseWriter, r *http.Request, id, rev int64) error {
+	article, err := t.Store.ArticleOne(principal(r), id)
+	if err != nil {
+		return notFound(err)
+	}
+	can, err := t.permissions(r, article)
+	if err != nil {
+		return err
+	}
+	revision, err := t.Store.RevisionOne(id, rev)
+	if err != nil {
+		return notFound(err)
+	}
+	users, err := t.Users.UserNames([]int64{revision.UserID})
+	if err != nil {
+		return err
+	}
+	links, err := t.links(r, revision.Body)
+	if err != nil {
+		return err
+	}
+	return view.Default(w, r, http.StatusOK, "revision.tmpl", map[string]interface{}{
+		"title":    fmt.Sprintf("%s (revision %d) - go-wiki", revision.Title, revision.Revision),
+		"revision": revision,
+		"users":    users,
+		"links":    view.Links(links),
+		"can":      can,
+	})
+}
+
+// Diff shows line-based difference between two revisions of the article.
+// Revisions are given by query parameters from and to. If omitted, to is
+// the latest revision and from is the one before it.
+func (t *Article) Diff(w http.ResponseWriter, r *http.Request, id int64) error {
+	if _, err := t.Store.ArticleOne(principal(r), id); err != nil {
+		return notFound(err)
+	}
+	revisions, err := t.Store.Revisions(id)
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		return &httputil.HTTPError{Status: http.StatusNotFound}
+	}
+	to := revisions[0].Revision
+	if v := r.FormValue("to"); v != "" {
+		if to, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return &httputil.HTTPError{Status: http.StatusBadRequest, Err: err}
+		}
+	}
+	from := to - 1
+	v := r.FormValue("from")
+	if v != "" {
+		if from, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return &httputil.HTTPError{Status: http.StatusBadRequest, Err: err}
+		}
+	}
+
+	var old, cur *model.Revision
+	for i := range revisions {
+		switch revisions[i].Revision {
+		case from:
+			old = &revisions[i]
+		case to:
+			cur = &revisions[i]
+		}
+	}
+	// revisions given explicitly must exist, not to show a stale URL as
+	// the whole article added.
+	if cur == nil || (old == nil && v != "") {
+		return &httputil.HTTPError{Status: http.StatusNotFound}
+	}
+	if old == nil {
+		// diff from the empty article, e.g. for the first revision.
+		old = &model.Revision{ArticleID: id, Revision: from}
+	}
+	return view.Default(w, r, http.StatusOK, "diff.tmpl", map[string]interface{}{
+		"title": fmt.Sprintf("%s (revision %d to %d) - go-wiki", cur.Title, old.Revision, cur.Revision),
+		"from":  old,
+		"to":    cur,
+		"lines": diff.Lines(old.Body, cur.Body),
 	})
 }
 
@@ -57,58 +403,126 @@ func (t *Article) Edit(w http.ResponseWriter, r *http.Request) error {
 		log.Printf("err: %s, %s", r.URL.Path, err)
 		return err
 	}
-	article, err := model.ArticleOne(t.DB, id)
+	article, err := t.Store.ArticleOne(principal(r), id)
 	if err != nil {
+		return notFound(err)
+	}
+	if err := t.authorize(r, article, model.PermEdit); err != nil {
 		return err
 	}
-	if article == (model.Article{}) {
-		return &httputil.HTTPError{
-			Status: http.StatusUnauthorized,
-			Err:    errors.New("non-allowed operation."),
+	can, err := t.permissions(r, article)
+	if err != nil {
+		return err
+	}
+	latest, err := t.Store.LatestRevision(id)
+	if err != nil && errors.Cause(err) != model.ErrNotFound {
+		return err
+	}
+	var lock *editlock.Lock
+	if t.Locks != nil {
+		if l, ok := t.Locks.Acquire(id, CurrentUserID(r), CurrentName(r)); !ok {
+			lock = &l
 		}
 	}
 	return view.Default(w, r, http.StatusOK, "edit.tmpl", map[string]interface{}{
-		"title":   fmt.Sprintf("%s - go-wiki", article.Title),
-		"article": article,
+		"title":    fmt.Sprintf("%s - go-wiki", article.Title),
+		"article":  article,
+		"revision": latest.Revision,
+		"lock":     lock,
+		"can":      can,
 	})
 }
 
 // New works as endpoint to create new article.
 // If successed, redirect to created one.
 func (t *Article) New(w http.ResponseWriter, r *http.Request, m *model.Article) error {
-	var id int64
-	if err := TXHandler(t.DB, func(tx *sql.Tx) error {
-		result, err := m.Insert(tx)
-		if err != nil {
-			return err
-		}
-		if err := tx.Commit(); err != nil {
-			return err
-		}
-		id, err = result.LastInsertId()
+	if err := t.authorize(r, *m, model.PermEdit); err != nil {
 		return err
-	}); err != nil {
+	}
+	if err := t.Store.InsertArticle(m, edit(r, m)); err != nil {
 		return err
 	}
-	http.Redirect(w, r, fmt.Sprintf("/article/%d", id), 301)
+	t.indexArticle(m)
+	http.Redirect(w, r, fmt.Sprintf("/article/%d", m.ID), 301)
 	return nil
 }
 
 // Update works for updating the specified article.
 // After updating, redirect to one.
+// The edit is based on the revision given by revision form value. If the
+// article has been updated since then, the conflict page is shown instead.
 func (t *Article) Update(w http.ResponseWriter, r *http.Request, m *model.Article) error {
-	if err := TXHandler(t.DB, func(tx *sql.Tx) error {
-		if _, err := m.Update(tx); err != nil {
-			return err
+	if err := t.authorizeUpdate(r, m, model.PermEdit); err != nil {
+		return notFound(err)
+	}
+	e := edit(r, m)
+	if v := r.PostFormValue("revision"); v != "" {
+		base, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return &httputil.HTTPError{Status: http.StatusBadRequest, Err: err}
 		}
-		return tx.Commit()
-	}); err != nil {
-		return err
+		e.BaseRevision = base
+	}
+	if err := t.Store.UpdateArticle(m, e); err != nil {
+		if errors.Cause(err) == model.ErrConflict {
+			return t.conflict(w, r, m, e.BaseRevision)
+		}
+		return notFound(err)
+	}
+	t.indexArticle(m)
+	if t.Locks != nil {
+		t.Locks.Release(m.ID, CurrentUserID(r))
 	}
 	http.Redirect(w, r, fmt.Sprintf("/article/%d", m.ID), 301)
 	return nil
 }
 
+// authorizeUpdate checks if current user can do p with the article and
+// change it to m. Both namespaces before and after renamed are checked.
+// ErrNotFound is returned if the article does not exist.
+func (t *Article) authorizeUpdate(r *http.Request, m *model.Article, p model.Permission) error {
+	old, err := t.Store.ArticleOne(principal(r), m.ID)
+	if err != nil {
+		return err
+	}
+	if err := t.authorize(r, old, p); err != nil {
+		return err
+	}
+	if old.Title == m.Title {
+		return nil
+	}
+	return t.authorize(r, *m, p)
+}
+
+// conflict renders the page to resolve the conflict between the edit m
+// based on the base revision and the latest revision. It shows both
+// versions side by side, and the form prefilled with three-way merge of them.
+func (t *Article) conflict(w http.ResponseWriter, r *http.Request, m *model.Article, base int64) error {
+	latest, err := t.Store.LatestRevision(m.ID)
+	if err != nil {
+		return err
+	}
+	var baseBody string
+	rev, err := t.Store.RevisionOne(m.ID, base)
+	switch {
+	case err == nil:
+		baseBody = rev.Body
+	case errors.Cause(err) != model.ErrNotFound:
+		return err
+	}
+	merged, clean := diff.Merge3(baseBody, m.Body, latest.Body)
+	return view.Default(w, r, http.StatusConflict, "conflict.tmpl", map[string]interface{}{
+		"title":   fmt.Sprintf("Conflict: %s - go-wiki", m.Title),
+		"article": m,
+		"latest":  latest,
+		"base":    base,
+		"mine":    diff.Split(m.Body),
+		"theirs":  diff.Split(latest.Body),
+		"merged":  merged,
+		"clean":   clean,
+	})
+}
+
 // Save is endpoint for updating or creating documents.
 // This accepts form request from browser.
 // If id is specified, dealing with Update.
@@ -130,9 +544,43 @@ func (t *Article) Save(w http.ResponseWriter, r *http.Request) error {
 	return t.Update(w, r, &article)
 }
 
+// Revert restores title and body of the article from an earlier revision
+// given by the revision form value. The restoration is recorded as a new
+// revision, so the history is never rewritten.
+func (t *Article) Revert(w http.ResponseWriter, r *http.Request) error {
+	id, sub, err := articlePath(r.URL.Path)
+	if err != nil {
+		return err
+	}
+	if len(sub) != 1 || sub[0] != "revert" {
+		http.NotFound(w, r)
+		return nil
+	}
+	rev, err := strconv.ParseInt(r.PostFormValue("revision"), 10, 64)
+	if err != nil {
+		return &httputil.HTTPError{Status: http.StatusBadRequest, Err: err}
+	}
+	revision, err := t.Store.RevisionOne(id, rev)
+	if err != nil {
+		return notFound(err)
+	}
+
+	article := model.Article{ID: id, Title: revision.Title, Body: revision.Body}
+	if err := t.authorizeUpdate(r, &article, model.PermEdit); err != nil {
+		return notFound(err)
+	}
+	e := edit(r, &article)
+	e.RevertedFrom = rev
+	if err := t.Store.UpdateArticle(&article, e); err != nil {
+		return notFound(err)
+	}
+	t.indexArticle(&article)
+	http.Redirect(w, r, fmt.Sprintf("/article/%d/history", id), http.StatusFound)
+	return nil
+}
+
 // Delete is endpont for deleting the document.
 func (t *Article) Delete(w http.ResponseWriter, r *http.Request) error {
-	var article model.Article
 	id := r.PostFormValue("id")
 	if id == "" {
 		return &httputil.HTTPError{Status: http.StatusBadRequest}
@@ -141,15 +589,22 @@ func (t *Article) Delete(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
-	article.ID = aid
-	if err := TXHandler(t.DB, func(tx *sql.Tx) error {
-		if _, err := article.Delete(tx); err != nil {
-			return err
-		}
-		return tx.Commit()
-	}); err != nil {
+	article, err := t.Store.ArticleOne(principal(r), aid)
+	if err != nil {
+		return notFound(err)
+	}
+	if err := t.authorize(r, article, model.PermDelete); err != nil {
+		return err
+	}
+	if err := t.Store.DeleteArticle(aid); err != nil {
 		return err
 	}
+	if t.Index != nil {
+		t.Index.Remove(aid)
+	}
+	if t.Locks != nil {
+		t.Locks.Remove(aid)
+	}
 
 	http.Redirect(w, r, "/", 301)
 	return nil
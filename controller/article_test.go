@@ -1,11 +1,17 @@
 package controller_test
 
 import (
+	"html/template"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/suzuken/wiki/controller"
+	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/view"
 )
 
 type testHandler func(w http.ResponseWriter, r *http.Request) error
@@ -35,3 +41,138 @@ func TestCSRFProtection(t *testing.T) {
 	// POST to article
 	// maybe block
 }
+
+// errStatus returns the status of the HTTP error, or 0 for other errors.
+func errStatus(err error) int {
+	if e, ok := err.(*httputil.HTTPError); ok {
+		return e.Status
+	}
+	return 0
+}
+
+func TestDiffNotFound(t *testing.T) {
+	store := model.NewMemoryStore()
+	article := &controller.Article{Store: store, Users: store}
+	m := &model.Article{Title: "Go", Body: "v1"}
+	if err := store.InsertArticle(m, model.Edit{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateArticle(&model.Article{ID: m.ID, Title: "Go", Body: "v2"}, model.Edit{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{"from=5", "from=0", "to=5", "from=1&to=5"} {
+		req := as(admin, httptest.NewRequest("GET", "/article/1/diff?"+query, nil))
+		if err := article.Diff(httptest.NewRecorder(), req, m.ID); errStatus(err) != http.StatusNotFound {
+			t.Errorf("%s: want not found, got %v", query, err)
+		}
+	}
+}
+
+func TestRevert(t *testing.T) {
+	store := model.NewMemoryStore()
+	article := &controller.Article{Store: store, Users: store}
+	m := &model.Article{Title: "Go", Body: "v1"}
+	if err := store.InsertArticle(m, model.Edit{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateArticle(&model.Article{ID: m.ID, Title: "Golang", Body: "v2"}, model.Edit{}); err != nil {
+		t.Fatal(err)
+	}
+	revert := func(u model.User, revision string) error {
+		req := httptest.NewRequest("POST", "/article/1/revert", strings.NewReader("revision="+revision))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return article.Revert(httptest.NewRecorder(), as(u, req))
+	}
+
+	viewer := model.User{ID: 2, Role: model.RoleViewer, EmailVerified: true}
+	if err := revert(viewer, "1"); errStatus(err) != http.StatusForbidden {
+		t.Errorf("viewers should not revert, got %v", err)
+	}
+	if err := revert(admin, "5"); errStatus(err) != http.StatusNotFound {
+		t.Errorf("want not found for missing revision, got %v", err)
+	}
+	if err := revert(admin, "x"); errStatus(err) != http.StatusBadRequest {
+		t.Errorf("want bad request for invalid revision, got %v", err)
+	}
+
+	if err := revert(admin, "1"); err != nil {
+		t.Fatalf("revert failed: %s", err)
+	}
+	revisions, err := store.Revisions(m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("want 3 revisions, got %d", len(revisions))
+	}
+	latest := revisions[0]
+	if latest.Revision != 3 || latest.Title != "Go" || latest.Body != "v1" || latest.RevertedFrom != 1 || latest.UserID != admin.ID {
+		t.Errorf("unexpected revision: %+v", latest)
+	}
+	if a, _ := store.ArticleOne(admin.Principal(), m.ID); a.Title != "Go" || a.Body != "v1" {
+		t.Errorf("article should be reverted: %+v", a)
+	}
+}
+
+// initView loads templates from the root of the repository.
+func initView(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	view.Init(template.FuncMap{
+		"LoggedIn":      controller.LoggedIn,
+		"CurrentName":   controller.CurrentName,
+		"CurrentUserID": controller.CurrentUserID,
+		"Can":           controller.Can,
+		"Flash":         controller.Flash,
+		"Markdown":      view.Markdown,
+		"Since":         view.Since,
+	}, false)
+}
+
+func TestShowHidesDeniedLinks(t *testing.T) {
+	initView(t)
+	store := model.NewMemoryStore()
+	article := &controller.Article{Store: store, Users: store}
+	home := &model.Article{Title: "Home", Body: "see [[HR/Payroll]]"}
+	for _, m := range []*model.Article{home, {Title: "HR/Payroll"}} {
+		if err := store.InsertArticle(m, model.Edit{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader := model.User{ID: 2, Role: model.RoleViewer, EmailVerified: true}
+	if err := store.InsertACL(&model.ACL{Namespace: "HR/", UserID: reader.ID, Permission: model.PermRead}); err != nil {
+		t.Fatal(err)
+	}
+	viewer := model.User{ID: 3, Role: model.RoleViewer, EmailVerified: true}
+
+	tests := []struct {
+		user    model.User
+		want    string
+		notWant string
+	}{
+		{reader, `href="/article/2"`, `href="/new?title=HR%2FPayroll"`},
+		// the denied article is shown as missing, not to reveal it exists.
+		{viewer, `href="/new?title=HR%2FPayroll"`, `href="/article/2"`},
+	}
+	for _, tt := range tests {
+		for _, show := range []func(w http.ResponseWriter, r *http.Request) error{
+			func(w http.ResponseWriter, r *http.Request) error { return article.Show(w, r, home.ID) },
+			func(w http.ResponseWriter, r *http.Request) error { return article.Revision(w, r, home.ID, 1) },
+		} {
+			w := httptest.NewRecorder()
+			if err := show(w, as(tt.user, httptest.NewRequest("GET", "/article/1", nil))); err != nil {
+				t.Fatalf("user %d: show failed: %s", tt.user.ID, err)
+			}
+			if body := w.Body.String(); !strings.Contains(body, tt.want) || strings.Contains(body, tt.notWant) {
+				t.Errorf("user %d: want link %s, not %s", tt.user.ID, tt.want, tt.notWant)
+			}
+		}
+	}
+}
@@ -1,32 +1,25 @@
 package controller
 
 import (
-	"database/sql"
 	"fmt"
-	"log"
 	"net/http"
 
 	"github.com/pkg/errors"
+	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/model"
 )
 
-// TXHandler is handler for working with transaction.
-// This is wrapper function for commit and rollback.
-func TXHandler(db *sql.DB, f func(*sql.Tx) error) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return errors.Wrap(err, "start transaction failed")
-	}
-	defer func() {
-		if err := recover(); err != nil {
-			tx.Rollback()
-			log.Print("rollback operation.")
-			return
-		}
-	}()
-	if err := f(tx); err != nil {
-		return errors.Wrap(err, "transaction: operation failed")
+// ErrForbidden is the reason of requests rejected since current user is
+// not allowed to do that.
+var ErrForbidden = errors.New("forbidden")
+
+// notFound makes errors for missing records into 404 errors.
+// Other errors are returned as they are.
+func notFound(err error) error {
+	if errors.Cause(err) == model.ErrNotFound {
+		return &httputil.HTTPError{Status: http.StatusNotFound, Err: err}
 	}
-	return nil
+	return err
 }
 
 func Error(w http.ResponseWriter, err error, code int) {
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/view"
+)
+
+// Lockouts lists accounts and IP addresses which must wait for next login
+// because of failed attempts, for admins.
+func (u *User) Lockouts(w http.ResponseWriter, r *http.Request) error {
+	accounts, err := u.Accounts.Locks()
+	if err != nil {
+		return err
+	}
+	ips, err := u.IPs.Locks()
+	if err != nil {
+		return err
+	}
+	return view.Default(w, r, http.StatusOK, "lockouts.tmpl", map[string]interface{}{
+		"title":    "Lockouts - go-wiki",
+		"accounts": accounts,
+		"ips":      ips,
+	})
+}
+
+// Unlock forgets failed logins of the account or the IP address given by
+// account or ip form value.
+func (u *User) Unlock(w http.ResponseWriter, r *http.Request) error {
+	var err error
+	switch {
+	case r.PostFormValue("account") != "":
+		err = u.Accounts.Reset(r.PostFormValue("account"))
+	case r.PostFormValue("ip") != "":
+		err = u.IPs.Reset(r.PostFormValue("ip"))
+	default:
+		return &httputil.HTTPError{Status: http.StatusBadRequest}
+	}
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/admin/lockouts", http.StatusFound)
+	return nil
+}
@@ -0,0 +1,400 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image/png"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/sessions"
+	"github.com/suzuken/wiki/view"
+)
+
+var (
+	errMFAEnabled     = errors.New("two-factor authentication is already enabled")
+	errMFANotEnrolled = errors.New("two-factor authentication is not set up")
+	errMFARequired    = errors.New("two-factor authentication is required by the policy")
+	errInvalidCode    = errors.New("the code is invalid")
+)
+
+// mfaIssuer is the name of the wiki shown in authenticator apps.
+const mfaIssuer = "go-wiki"
+
+// mfaLoginTTL is how long the second step of login waits for a code
+// after the password is checked.
+const mfaLoginTTL = 5 * time.Minute
+
+// recoveryCodeCount is the number of recovery codes given at once.
+const recoveryCodeCount = 10
+
+// MFARequired reports whether the policy requires all users to enable
+// two-factor authentication.
+func MFARequired(settings model.SettingStore) (bool, error) {
+	v, err := settings.Setting(model.SettingMFARequired)
+	return v == "true", err
+}
+
+// logIn marks the session authenticated as the user. The session gets a
+// new ID, so that the ID before login cannot be used to hijack it.
+func logIn(w http.ResponseWriter, r *http.Request, m model.User) error {
+	sess, _ := sessions.Get(r, "user")
+	if err := sessions.Renew(sess); err != nil {
+		return err
+	}
+	delete(sess.Values, "mfa_user")
+	delete(sess.Values, "mfa_at")
+	sess.Values["id"] = m.ID
+	sess.Values["email"] = m.Email
+	sess.Values["name"] = m.Name
+	if err := sessions.Save(r, w, sess); err != nil {
+		log.Printf("session can't save: %s", err)
+		return err
+	}
+	return nil
+}
+
+// startMFALogin remembers the user who passed the password in the session,
+// which is not authenticated until the second factor passes.
+func startMFALogin(w http.ResponseWriter, r *http.Request, m model.User) error {
+	sess, _ := sessions.Get(r, "user")
+	sess.Values["mfa_user"] = m.ID
+	sess.Values["mfa_at"] = time.Now().Unix()
+	if err := sessions.Save(r, w, sess); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/login/mfa", http.StatusFound)
+	return nil
+}
+
+// mfaLoginUser returns id of the user who passed the password within
+// mfaLoginTTL and must give the second factor. It returns 0 if none.
+func mfaLoginUser(r *http.Request) int64 {
+	sess, _ := sessions.Get(r, "user")
+	id, _ := sess.Values["mfa_user"].(int64)
+	at, _ := sess.Values["mfa_at"].(int64)
+	if time.Since(time.Unix(at, 0)) > mfaLoginTTL {
+		return 0
+	}
+	return id
+}
+
+// MFALoginHandler is the second step of login for users who enabled
+// two-factor authentication. It asks a TOTP code or a recovery code.
+func (u *User) MFALoginHandler(w http.ResponseWriter, r *http.Request) error {
+	if mfaLoginUser(r) == 0 {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return nil
+	}
+	switch r.Method {
+	case "GET":
+		return view.Default(w, r, http.StatusOK, "login_mfa.tmpl", map[string]interface{}{
+			"title": "Two-factor authentication - go-wiki",
+		})
+	case "POST":
+		return u.mfaLogin(w, r)
+	default:
+		return &httputil.HTTPError{Status: http.StatusMethodNotAllowed}
+	}
+}
+
+// mfaLogin checks the code, and logs in the user if it passes. Wrong codes
+// are limited as wrong passwords.
+func (u *User) mfaLogin(w http.ResponseWriter, r *http.Request) error {
+	m, err := u.Store.UserOne(mfaLoginUser(r))
+	if err != nil {
+		return notFound(err)
+	}
+	account, ip := strings.ToLower(m.Email), remoteIP(r)
+	wait, err := u.waitLogin(account, ip)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return mfaLoginFailed(w, r, fmt.Sprintf("too many failed attempts. try again in %s.", ceilSecond(wait)))
+	}
+	recovery, err := u.checkCode(m, r.PostFormValue("code"))
+	if errors.Cause(err) == errInvalidCode {
+		wait, err := u.failLogin(account, ip)
+		if err != nil {
+			return err
+		}
+		if wait > 0 {
+			return mfaLoginFailed(w, r, fmt.Sprintf("the code is invalid. try again in %s.", ceilSecond(wait)))
+		}
+		return mfaLoginFailed(w, r, "the code is invalid.")
+	}
+	if err != nil {
+		return err
+	}
+	if err := u.Accounts.Reset(account); err != nil {
+		return err
+	}
+	if recovery {
+		left, err := u.MFA.RecoveryCodesLeft(m.ID)
+		if err != nil {
+			return err
+		}
+		sess, _ := sessions.Get(r, "user")
+		sess.AddFlash(fmt.Sprintf("you logged in by a recovery code. %d codes are left.", left))
+	}
+	if err := logIn(w, r, m); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+	return nil
+}
+
+// mfaLoginFailed tells why the second step of login failed by the flash
+// message.
+func mfaLoginFailed(w http.ResponseWriter, r *http.Request, message string) error {
+	sess, _ := sessions.Get(r, "user")
+	sess.AddFlash(message)
+	if err := sessions.Save(r, w, sess); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/login/mfa", http.StatusFound)
+	return nil
+}
+
+// checkCode checks the TOTP code or the recovery code of the user, and uses
+// it up. recovery is true if a recovery code is used. Wrong or used codes
+// are errInvalidCode.
+func (u *User) checkCode(m model.User, code string) (recovery bool, err error) {
+	if !m.MFAEnabled {
+		return false, errMFANotEnrolled
+	}
+	if counter, ok := model.TOTPCounter(m.TOTPSecret, code, m.TOTPCounter, time.Now()); ok {
+		err := u.MFA.UseTOTP(m.ID, counter)
+		if errors.Cause(err) == model.ErrConflict {
+			return false, errInvalidCode
+		}
+		return false, err
+	}
+	err = u.MFA.UseRecoveryCode(m.ID, model.HashRecoveryCode(code))
+	if errors.Cause(err) == model.ErrNotFound {
+		return false, errInvalidCode
+	}
+	return err == nil, err
+}
+
+// MFASettings shows two-factor authentication of current user. While
+// enrolling, the key is shown by QR code and otpauth URI with the form to
+// confirm a code of it.
+func (u *User) MFASettings(w http.ResponseWriter, r *http.Request) error {
+	return u.renderMFA(w, r, nil)
+}
+
+// renderMFA renders the settings page of two-factor authentication.
+// codes are recovery codes just created, which are shown only this time.
+func (u *User) renderMFA(w http.ResponseWriter, r *http.Request, codes []string) error {
+	user, ok := CurrentUser(r)
+	if !ok {
+		return &httputil.HTTPError{Status: http.StatusUnauthorized}
+	}
+	required, err := MFARequired(u.Settings)
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"title":    "Two-factor authentication - go-wiki",
+		"enabled":  user.MFAEnabled,
+		"required": required,
+		"codes":    codes,
+	}
+	switch {
+	case user.MFAEnabled:
+		left, err := u.MFA.RecoveryCodesLeft(user.ID)
+		if err != nil {
+			return err
+		}
+		data["left"] = left
+	case user.TOTPSecret != "":
+		key, err := model.TOTPKey(mfaIssuer, user)
+		if err != nil {
+			return err
+		}
+		img, err := key.Image(200, 200)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return err
+		}
+		data["secret"] = key.Secret()
+		data["uri"] = key.URL()
+		data["qr"] = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+	}
+	return view.Default(w, r, http.StatusOK, "mfa.tmpl", data)
+}
+
+// EnrollMFA creates new TOTP secret of current user to enroll. Secrets
+// created before and not confirmed are replaced.
+func (u *User) EnrollMFA(w http.ResponseWriter, r *http.Request) error {
+	user, ok := CurrentUser(r)
+	if !ok {
+		return &httputil.HTTPError{Status: http.StatusUnauthorized}
+	}
+	if user.MFAEnabled {
+		return &httputil.HTTPError{Status: http.StatusBadRequest, Err: errMFAEnabled}
+	}
+	key, err := model.NewTOTPKey(mfaIssuer, user)
+	if err != nil {
+		return err
+	}
+	if err := u.MFA.SetTOTPSecret(user.ID, key.Secret()); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/settings/mfa", http.StatusFound)
+	return nil
+}
+
+// ConfirmMFA enables two-factor authentication of current user if code
+// form value is the code of the secret enrolling, and shows new recovery
+// codes.
+func (u *User) ConfirmMFA(w http.ResponseWriter, r *http.Request) error {
+	user, ok := CurrentUser(r)
+	if !ok {
+		return &httputil.HTTPError{Status: http.StatusUnauthorized}
+	}
+	if user.MFAEnabled {
+		return &httputil.HTTPError{Status: http.StatusBadRequest, Err: errMFAEnabled}
+	}
+	if user.TOTPSecret == "" {
+		return &httputil.HTTPError{Status: http.StatusBadRequest, Err: errMFANotEnrolled}
+	}
+	counter, ok := model.TOTPCounter(user.TOTPSecret, r.PostFormValue("code"), 0, time.Now())
+	if !ok {
+		return mfaSettingsFlash(w, r, "the code is invalid. check the time of your device and try again.")
+	}
+	codes, hashes, err := model.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return err
+	}
+	if err := u.MFA.EnableMFA(user.ID, counter, hashes); err != nil {
+		return err
+	}
+	user.MFAEnabled = true
+	return u.renderMFA(w, WithUser(r, user), codes)
+}
+
+// RegenerateRecoveryCodes replaces recovery codes of current user by new
+// ones if code form value is the current code.
+func (u *User) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) error {
+	user, ok := CurrentUser(r)
+	if !ok {
+		return &httputil.HTTPError{Status: http.StatusUnauthorized}
+	}
+	if _, err := u.checkCode(user, r.PostFormValue("code")); err != nil {
+		return u.mfaCodeError(w, r, err)
+	}
+	codes, hashes, err := model.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return err
+	}
+	if err := u.MFA.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		return err
+	}
+	return u.renderMFA(w, r, codes)
+}
+
+// DisableMFA disables two-factor authentication of current user if code
+// form value is the current code, unless the policy requires it.
+func (u *User) DisableMFA(w http.ResponseWriter, r *http.Request) error {
+	user, ok := CurrentUser(r)
+	if !ok {
+		return &httputil.HTTPError{Status: http.StatusUnauthorized}
+	}
+	required, err := MFARequired(u.Settings)
+	if err != nil {
+		return err
+	}
+	if required {
+		return &httputil.HTTPError{Status: http.StatusForbidden, Err: errMFARequired}
+	}
+	if _, err := u.checkCode(user, r.PostFormValue("code")); err != nil {
+		return u.mfaCodeError(w, r, err)
+	}
+	if err := u.MFA.DisableMFA(user.ID); err != nil {
+		return err
+	}
+	return mfaSettingsFlash(w, r, "two-factor authentication is disabled.")
+}
+
+// mfaCodeError makes errors of checkCode into responses.
+func (u *User) mfaCodeError(w http.ResponseWriter, r *http.Request, err error) error {
+	switch errors.Cause(err) {
+	case errInvalidCode:
+		return mfaSettingsFlash(w, r, "the code is invalid.")
+	case errMFANotEnrolled:
+		return &httputil.HTTPError{Status: http.StatusBadRequest, Err: err}
+	}
+	return err
+}
+
+// mfaSettingsFlash redirects to the settings page with the flash message.
+func mfaSettingsFlash(w http.ResponseWriter, r *http.Request, message string) error {
+	sess, _ := sessions.Get(r, "user")
+	sess.AddFlash(message)
+	if err := sessions.Save(r, w, sess); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/settings/mfa", http.StatusFound)
+	return nil
+}
+
+// MFAPolicy shows whether users enabled two-factor authentication with
+// the form to require it, for admins.
+func (u *User) MFAPolicy(w http.ResponseWriter, r *http.Request) error {
+	users, err := u.Store.UsersAll()
+	if err != nil {
+		return err
+	}
+	required, err := MFARequired(u.Settings)
+	if err != nil {
+		return err
+	}
+	return view.Default(w, r, http.StatusOK, "admin_mfa.tmpl", map[string]interface{}{
+		"title":    "Two-factor authentication - go-wiki",
+		"users":    users,
+		"required": required,
+	})
+}
+
+// SetMFAPolicy requires all users to enable two-factor authentication if
+// required form value is true. Users without it are asked to enable it
+// on next request.
+func (u *User) SetMFAPolicy(w http.ResponseWriter, r *http.Request) error {
+	required, err := strconv.ParseBool(r.PostFormValue("required"))
+	if err != nil {
+		return &httputil.HTTPError{Status: http.StatusBadRequest, Err: err}
+	}
+	if err := u.Settings.SetSetting(model.SettingMFARequired, strconv.FormatBool(required)); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/admin/mfa", http.StatusFound)
+	return nil
+}
+
+// ResetMFA disables two-factor authentication of the user given by id form
+// value, such as one who lost both the device and recovery codes.
+func (u *User) ResetMFA(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.ParseInt(r.PostFormValue("id"), 10, 64)
+	if err != nil {
+		return &httputil.HTTPError{Status: http.StatusBadRequest, Err: err}
+	}
+	if err := u.MFA.DisableMFA(id); err != nil {
+		return notFound(err)
+	}
+	http.Redirect(w, r, "/admin/mfa", http.StatusFound)
+	return nil
+}
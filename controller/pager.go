@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Pager holds page numbers for navigation between pages of a list.
+// Prev and Next are 0 if there is no such page.
+type Pager struct {
+	Page int
+	Prev int
+	Next int
+	Last int
+	// Query is kept in links to other pages, such as search words.
+	Query url.Values
+}
+
+// NewPager returns pager for the page of total items requested by r.
+func NewPager(r *http.Request, total, perPage int) Pager {
+	page := pageNumber(r)
+	last := (total + perPage - 1) / perPage
+	if last < 1 {
+		last = 1
+	}
+	p := Pager{Page: page, Last: last, Query: r.URL.Query()}
+	if page > 1 {
+		p.Prev = page - 1
+	}
+	if page < last {
+		p.Next = page + 1
+	}
+	return p
+}
+
+// URL returns relative URL to given page.
+func (p Pager) URL(page int) string {
+	q := url.Values{}
+	for k, v := range p.Query {
+		q[k] = v
+	}
+	q.Set("page", strconv.Itoa(page))
+	return "?" + q.Encode()
+}
+
+// pageNumber returns page number given by page parameter.
+// It defaults to the first page.
+func pageNumber(r *http.Request) int {
+	page, err := strconv.Atoi(r.FormValue("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
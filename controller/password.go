@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/mail"
+	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/sessions"
+	"github.com/suzuken/wiki/view"
+)
+
+var (
+	errPasswordRequired = errors.New("password is required")
+	errPasswordMismatch = errors.New("passwords do not match")
+	errPasswordTooLong  = errors.Errorf("password should be at most %d bytes", model.MaxPasswordLength)
+)
+
+// ForgotPasswordHandler shows the form to request a password reset, and
+// sends the link to reset the password to the email address posted.
+func (u *User) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return view.Default(w, r, http.StatusOK, "forgot.tmpl", map[string]interface{}{
+			"title": "Forgot password - go-wiki",
+		})
+	case "POST":
+		return u.forgotPassword(w, r)
+	default:
+		return &httputil.HTTPError{Status: http.StatusMethodNotAllowed}
+	}
+}
+
+// forgotPassword sends the reset link if the email is registered.
+// The response is the same whether or not it is registered, so that
+// registered addresses are not revealed. Requests are limited for each
+// email address and each IP address, so that mailboxes are not flooded.
+func (u *User) forgotPassword(w http.ResponseWriter, r *http.Request) error {
+	email := strings.TrimSpace(r.PostFormValue("email"))
+	wait, err := u.limitReset(strings.ToLower(email), remoteIP(r))
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return view.Default(w, r, http.StatusTooManyRequests, "forgot.tmpl", map[string]interface{}{
+			"title": "Forgot password - go-wiki",
+			"error": fmt.Sprintf("too many requests. try again in %s.", ceilSecond(wait)),
+		})
+	}
+	if err := u.sendPasswordReset(email); err != nil {
+		log.Printf("/password/forgot: sending reset link failed: %s", err)
+	}
+	return view.Default(w, r, http.StatusOK, "forgot.tmpl", map[string]interface{}{
+		"title": "Forgot password - go-wiki",
+		"sent":  true,
+	})
+}
+
+// limitReset returns how long requests of reset links for the account
+// from the IP address must wait, whichever is longer, or records the
+// request if they need not.
+func (u *User) limitReset(account, ip string) (time.Duration, error) {
+	a, err := u.ResetAccounts.Wait(account)
+	if err != nil {
+		return 0, err
+	}
+	i, err := u.ResetIPs.Wait(ip)
+	if err != nil {
+		return 0, err
+	}
+	if wait := longer(a, i); wait > 0 {
+		return wait, nil
+	}
+	if _, err := u.ResetAccounts.Fail(account); err != nil {
+		return 0, err
+	}
+	_, err = u.ResetIPs.Fail(ip)
+	return 0, err
+}
+
+// sendPasswordReset creates a reset token for the user of the email and
+// mails the link with the token.
+func (u *User) sendPasswordReset(email string) error {
+	user, err := u.Store.UserByEmail(email)
+	if errors.Cause(err) == model.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	reset, token, err := model.NewPasswordReset(user.ID, model.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	if err := u.Resets.InsertPasswordReset(reset); err != nil {
+		return err
+	}
+	link := u.BaseURL + "/password/reset?token=" + url.QueryEscape(token)
+	return u.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password of go-wiki",
+		Body: fmt.Sprintf(`Hi %s,
+
+Someone requested to reset your password of go-wiki.
+Open the link below to set new password. The link expires in %.0f minutes,
+and can be used only once.
+
+%s
+
+If you did not request this, you can ignore this email.
+`, user.Name, model.PasswordResetTTL.Minutes(), link),
+	})
+}
+
+// ResetPasswordHandler shows the form to set new password for the token
+// given by token parameter, and sets the password posted.
+func (u *User) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) error {
+	// do not leak the token to other sites by referer.
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	switch r.Method {
+	case "GET":
+		token := r.FormValue("token")
+		if _, err := u.Resets.PasswordResetByHash(model.HashPasswordResetToken(token)); err != nil {
+			return u.resetPasswordError(w, r, err)
+		}
+		return u.renderResetPassword(w, r, http.StatusOK, token, nil)
+	case "POST":
+		return u.resetPassword(w, r)
+	default:
+		return &httputil.HTTPError{Status: http.StatusMethodNotAllowed}
+	}
+}
+
+// resetPassword sets the password and lets the user log in with it.
+func (u *User) resetPassword(w http.ResponseWriter, r *http.Request) error {
+	token := r.PostFormValue("token")
+	password := r.PostFormValue("password")
+	switch {
+	case password == "":
+		return u.renderResetPassword(w, r, http.StatusBadRequest, token, errPasswordRequired)
+	case password != r.PostFormValue("confirm"):
+		return u.renderResetPassword(w, r, http.StatusBadRequest, token, errPasswordMismatch)
+	case len(password) > model.MaxPasswordLength:
+		return u.renderResetPassword(w, r, http.StatusBadRequest, token, errPasswordTooLong)
+	}
+	m, err := u.Resets.ResetPassword(model.HashPasswordResetToken(token), password)
+	if err != nil {
+		return u.resetPasswordError(w, r, err)
+	}
+	// sessions stolen before the reset should not survive it.
+	if u.Sessions != nil {
+		if err := u.Sessions.DeleteByUser(m.ID); err != nil {
+			return err
+		}
+	}
+	sess, _ := sessions.Get(r, "user")
+	sess.AddFlash("your password has been reset. please log in with new password.")
+	if err := sessions.Save(r, w, sess); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/login", http.StatusFound)
+	return nil
+}
+
+// renderResetPassword renders the form to set new password with err.
+func (u *User) renderResetPassword(w http.ResponseWriter, r *http.Request, status int, token string, err error) error {
+	return view.Default(w, r, status, "reset.tmpl", map[string]interface{}{
+		"title": "Reset password - go-wiki",
+		"token": token,
+		"error": err,
+	})
+}
+
+// resetPasswordError tells that the token is invalid if err is
+// model.ErrNotFound. Otherwise err is returned.
+func (u *User) resetPasswordError(w http.ResponseWriter, r *http.Request, err error) error {
+	if errors.Cause(err) != model.ErrNotFound {
+		return err
+	}
+	return view.Default(w, r, http.StatusNotFound, "reset.tmpl", map[string]interface{}{
+		"title":   "Reset password - go-wiki",
+		"invalid": true,
+	})
+}
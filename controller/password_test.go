@@ -0,0 +1,121 @@
+package controller_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/suzuken/wiki/controller"
+	"github.com/suzuken/wiki/mail"
+	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/ratelimit"
+)
+
+func TestLongPassword(t *testing.T) {
+	initView(t)
+	store := model.NewMemoryStore()
+	user := &controller.User{Store: store, Resets: store}
+	alice := &model.User{Name: "alice", Email: "alice@example.com"}
+	if err := store.InsertUser(alice, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	reset, token, err := model.NewPasswordReset(alice.ID, model.PasswordResetTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InsertPasswordReset(reset); err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("a", 100)
+
+	tests := []struct {
+		h    func(w http.ResponseWriter, r *http.Request) error
+		path string
+		form url.Values
+	}{
+		{user.SignupHandler, "/signup", url.Values{"name": {"bob"}, "email": {"bob@example.com"}, "password": {long}}},
+		{user.ResetPasswordHandler, "/password/reset", url.Values{"token": {token}, "password": {long}, "confirm": {long}}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := tt.h(w, req); err != nil {
+			t.Errorf("%s: %s", tt.path, err)
+			continue
+		}
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: want %d, got %d", tt.path, http.StatusBadRequest, w.Code)
+		}
+	}
+	if ok, _ := store.UserExists("bob@example.com"); ok {
+		t.Error("user should not be created with too long password")
+	}
+	if _, err := store.Auth(alice.Email, "secret"); err != nil {
+		t.Errorf("password should not be reset: %s", err)
+	}
+}
+
+func TestForgotPasswordLimit(t *testing.T) {
+	initView(t)
+	store := model.NewMemoryStore()
+	failures := ratelimit.NewMemoryStore()
+	var sent bytes.Buffer
+	user := &controller.User{
+		Store:         store,
+		Resets:        store,
+		Mailer:        mail.NewLog(&sent, "wiki@example.com"),
+		Accounts:      ratelimit.New(failures, "account:", ratelimit.DefaultAccountPolicy),
+		IPs:           ratelimit.New(failures, "ip:", ratelimit.DefaultIPPolicy),
+		ResetAccounts: ratelimit.New(failures, "reset-account:", ratelimit.DefaultResetPolicy),
+		ResetIPs:      ratelimit.New(failures, "reset-ip:", ratelimit.DefaultResetIPPolicy),
+	}
+	if err := store.InsertUser(&model.User{Name: "alice", Email: "alice@example.com"}, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	forgot := func(email, ip string) int {
+		req := httptest.NewRequest("POST", "/password/forgot", strings.NewReader(url.Values{"email": {email}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		if err := user.ForgotPasswordHandler(w, req); err != nil {
+			t.Fatalf("request failed: %s", err)
+		}
+		return w.Code
+	}
+
+	free := ratelimit.DefaultResetPolicy.Free
+	for i := 0; i < free; i++ {
+		if status := forgot("alice@example.com", "192.0.2.1"); status != http.StatusOK {
+			t.Fatalf("request %d: want %d, got %d", i, http.StatusOK, status)
+		}
+	}
+	// the email is limited from any address.
+	if status := forgot("Alice@example.com", "192.0.2.2"); status != http.StatusTooManyRequests {
+		t.Errorf("want %d for the email, got %d", http.StatusTooManyRequests, status)
+	}
+	if n := strings.Count(sent.String(), "Subject: Reset your password"); n != free {
+		t.Errorf("want %d emails sent, got %d", free, n)
+	}
+	// the IP address is limited for any email.
+	for i := 0; i < ratelimit.DefaultResetIPPolicy.Free; i++ {
+		forgot(fmt.Sprintf("user%d@example.com", i), "192.0.2.3")
+	}
+	if status := forgot("bob@example.com", "192.0.2.3"); status != http.StatusTooManyRequests {
+		t.Errorf("want %d for the IP address, got %d", http.StatusTooManyRequests, status)
+	}
+	// logins are neither limited nor listed as lockouts by requests of
+	// reset links.
+	if wait, _ := user.Accounts.Wait("alice@example.com"); wait != 0 {
+		t.Errorf("login of the account should not wait, got %s", wait)
+	}
+	for _, l := range []*ratelimit.Limiter{user.Accounts, user.IPs} {
+		if locks, _ := l.Locks(); len(locks) != 0 {
+			t.Errorf("want no lockouts of login, got %+v", locks)
+		}
+	}
+}
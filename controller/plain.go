@@ -14,9 +14,13 @@ func AuthTestHandler(w http.ResponseWriter, _ *http.Request) error {
 	return err
 }
 
+// NewArticleHandler renders the form for new article.
+// The title can be prefilled by title query parameter,
+// which is given by links to missing articles.
 func NewArticleHandler(w http.ResponseWriter, r *http.Request) error {
 	return view.HTML(w, 200, "new.tmpl", map[string]interface{}{
 		"title":          "New: go-wiki",
+		"articleTitle":   r.FormValue("title"),
 		csrf.TemplateTag: csrf.TemplateField(r),
 		"request":        r,
 	})
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/sessions"
+	"github.com/suzuken/wiki/view"
+)
+
+// Session is controller for active sessions of current user.
+type Session struct {
+	Store sessions.Store
+}
+
+// List shows sessions of current user which are not expired.
+func (s *Session) List(w http.ResponseWriter, r *http.Request) error {
+	records, err := s.Store.ByUser(CurrentUserID(r))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	active := records[:0]
+	for _, rec := range records {
+		if rec.Expires.After(now) {
+			active = append(active, rec)
+		}
+	}
+	sess, _ := sessions.Get(r, "user")
+	return view.Default(w, r, http.StatusOK, "sessions.tmpl", map[string]interface{}{
+		"title":    "Sessions - go-wiki",
+		"sessions": active,
+		"current":  sessions.RecordID(sess),
+	})
+}
+
+// Revoke signs out the session given by id form value.
+func (s *Session) Revoke(w http.ResponseWriter, r *http.Request) error {
+	id := r.PostFormValue("id")
+	rec, err := s.Store.Get(id)
+	if err == sessions.ErrNotFound || (err == nil && rec.UserID != CurrentUserID(r)) {
+		return &httputil.HTTPError{Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.Store.Delete(id); err != nil {
+		return err
+	}
+	sess, _ := sessions.Get(r, "user")
+	if id == sessions.RecordID(sess) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return nil
+	}
+	sess.AddFlash("the session is signed out.")
+	if err := sessions.Save(r, w, sess); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/settings/sessions", http.StatusFound)
+	return nil
+}
+
+// RevokeAll signs out all sessions of current user, including this one.
+func (s *Session) RevokeAll(w http.ResponseWriter, r *http.Request) error {
+	if err := s.Store.DeleteByUser(CurrentUserID(r)); err != nil {
+		return err
+	}
+	sess, _ := sessions.Get(r, "user")
+	if err := sessions.Clear(r, w, sess); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/login", http.StatusFound)
+	return nil
+}
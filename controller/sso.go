@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/sessions"
+	"github.com/suzuken/wiki/sso"
+)
+
+var errSSOState = errors.New("state of the login is invalid or expired")
+
+// SSO is controller for single sign-on by OpenID Connect.
+type SSO struct {
+	Provider   *sso.Provider
+	Users      model.UserStore
+	Identities model.IdentityStore
+}
+
+// Login redirects to the provider to log in. State, nonce and PKCE code
+// verifier of the login are kept in the session until the callback.
+func (s *SSO) Login(w http.ResponseWriter, r *http.Request) error {
+	var secrets [3]string
+	for i := range secrets {
+		v, err := sso.NewSecret()
+		if err != nil {
+			return err
+		}
+		secrets[i] = v
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+	sess, _ := sessions.Get(r, "user")
+	sess.Values["oidc_state"] = state
+	sess.Values["oidc_nonce"] = nonce
+	sess.Values["oidc_verifier"] = verifier
+	if err := sessions.Save(r, w, sess); err != nil {
+		return err
+	}
+	http.Redirect(w, r, s.Provider.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+	return nil
+}
+
+// Callback logs in the user by the authorization code given by the
+// provider. Users unknown to the wiki are created, or linked to the local
+// user of the same email address if the provider verified it.
+func (s *SSO) Callback(w http.ResponseWriter, r *http.Request) error {
+	sess, _ := sessions.Get(r, "user")
+	state, _ := sess.Values["oidc_state"].(string)
+	nonce, _ := sess.Values["oidc_nonce"].(string)
+	verifier, _ := sess.Values["oidc_verifier"].(string)
+	// the state can be used only once.
+	delete(sess.Values, "oidc_state")
+	delete(sess.Values, "oidc_nonce")
+	delete(sess.Values, "oidc_verifier")
+	if err := sessions.Save(r, w, sess); err != nil {
+		return err
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(r.FormValue("state"))) != 1 {
+		return &httputil.HTTPError{Status: http.StatusBadRequest, Err: errSSOState}
+	}
+	if e := r.FormValue("error"); e != "" {
+		log.Printf("/login/oidc: provider returned error: %s: %s", e, r.FormValue("error_description"))
+		return loginFailed(w, r, "login by single sign-on is canceled or denied.")
+	}
+	claims, err := s.Provider.Exchange(r.Context(), r.FormValue("code"), verifier, nonce)
+	if err != nil {
+		log.Printf("/login/oidc: exchange failed: %s", err)
+		return loginFailed(w, r, "login by single sign-on failed.")
+	}
+	if claims.Email == "" {
+		return loginFailed(w, r, "the provider gave no email address.")
+	}
+	m, created, err := s.user(claims)
+	if errors.Cause(err) == model.ErrDuplicated {
+		return loginFailed(w, r, "the email address is used by a local account. log in by password, or ask an admin.")
+	}
+	if err != nil {
+		return err
+	}
+	// roles of new users are mapped when provisioned, except the first
+	// user, who becomes an admin and should not be demoted here.
+	if role, ok := s.Provider.Role(claims.Groups); ok && !created && role != m.Role {
+		if err := s.Users.UpdateUserRole(m.ID, role); err != nil {
+			return err
+		}
+		m.Role = role
+	}
+	if m.MFAEnabled {
+		return startMFALogin(w, r, m)
+	}
+	if err := logIn(w, r, m); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+	return nil
+}
+
+// user returns the user of the claims, who is linked or created on first
+// login. created is true if the user is created. Local users of unverified
+// email addresses are ErrDuplicated, since the address may not be theirs.
+func (s *SSO) user(c sso.Claims) (m model.User, created bool, err error) {
+	m, err = s.Identities.UserByIdentity(c.Issuer, c.Subject)
+	if errors.Cause(err) != model.ErrNotFound {
+		return m, false, err
+	}
+	identity := &model.Identity{Issuer: c.Issuer, Subject: c.Subject}
+	m, err = s.Users.UserByEmail(c.Email)
+	switch {
+	case err == nil && c.EmailVerified:
+		identity.UserID = m.ID
+		return m, false, s.Identities.InsertIdentity(identity)
+	case err == nil:
+		return model.User{}, false, model.ErrDuplicated
+	case errors.Cause(err) != model.ErrNotFound:
+		return model.User{}, false, err
+	}
+	m = model.User{Name: c.Name, Email: c.Email, EmailVerified: true}
+	if m.Name == "" {
+		m.Name = c.Email
+	}
+	if role, ok := s.Provider.Role(c.Groups); ok {
+		m.Role = role
+	}
+	if err := s.Identities.ProvisionUser(&m, identity); err != nil {
+		return model.User{}, false, err
+	}
+	return m, true, nil
+}
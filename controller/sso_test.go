@@ -0,0 +1,162 @@
+package controller_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/suzuken/wiki/controller"
+	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/sso"
+	"github.com/suzuken/wiki/sso/ssotest"
+)
+
+// statusHandler responds status of HTTP errors.
+type statusHandler func(w http.ResponseWriter, r *http.Request) error
+
+func (h statusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h(w, r); err != nil {
+		status := http.StatusInternalServerError
+		if e, ok := err.(*httputil.HTTPError); ok {
+			status = e.Status
+		}
+		http.Error(w, err.Error(), status)
+	}
+}
+
+// ssoServer serves login by single sign-on of the fake provider for the
+// store at url. login logs in by the claims, and returns the response.
+func ssoServer(t *testing.T, store *model.MemoryStore) (url string, login func(claims map[string]interface{}) string, stop func()) {
+	idp := ssotest.NewServer("wiki", "secret")
+	c := &controller.SSO{Users: store, Identities: store}
+
+	mux := http.NewServeMux()
+	mux.Handle("/login/oidc", statusHandler(c.Login))
+	mux.Handle("/login/oidc/callback", statusHandler(c.Callback))
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Join(controller.Flash(r, w), "\n"))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "user %d", controller.CurrentUserID(r))
+	})
+	ts := httptest.NewServer(mux)
+
+	p, err := sso.New(context.Background(), sso.Config{
+		Issuer:       idp.URL,
+		ClientID:     "wiki",
+		ClientSecret: "secret",
+		RedirectURL:  ts.URL + "/login/oidc/callback",
+		Roles:        map[string]string{"wiki-admins": "admin", "staff": "editor"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Provider = p
+
+	login = func(claims map[string]interface{}) string {
+		t.Helper()
+		idp.SetClaims(claims)
+		jar, _ := cookiejar.New(nil)
+		resp, err := (&http.Client{Jar: jar}).Get(ts.URL + "/login/oidc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return string(b)
+	}
+	return ts.URL, login, func() {
+		ts.Close()
+		idp.Close()
+	}
+}
+
+func TestSSO(t *testing.T) {
+	store := model.NewMemoryStore()
+	url, login, stop := ssoServer(t, store)
+	defer stop()
+
+	// the local admin signed up before single sign-on.
+	local := &model.User{Name: "admin", Email: "admin@example.com", EmailVerified: true}
+	if err := store.InsertUser(local, "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := map[string]interface{}{
+		"sub":    "alice-id",
+		"email":  "alice@example.com",
+		"name":   "alice",
+		"groups": []string{"staff"},
+	}
+	if got := login(alice); got != "user 2" {
+		t.Fatalf("alice should be created, got %q", got)
+	}
+	u, err := store.UserOne(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "alice" || u.Role != model.RoleEditor || !u.EmailVerified {
+		t.Errorf("unexpected user: %+v", u)
+	}
+
+	// roles follow groups on every login, and users are keyed by subject.
+	alice["groups"] = []string{"sales"}
+	alice["email"] = "alice@new.example.com"
+	if got := login(alice); got != "user 2" {
+		t.Fatalf("alice should be found by subject, got %q", got)
+	}
+	if u, _ := store.UserOne(2); u.Role != model.RoleViewer {
+		t.Errorf("want viewer, got %s", u.Role)
+	}
+
+	// local users are linked only by verified email addresses.
+	admin := map[string]interface{}{
+		"sub":    "admin-id",
+		"email":  "admin@example.com",
+		"groups": []string{"wiki-admins"},
+	}
+	if got := login(admin); !strings.Contains(got, "used by a local account") {
+		t.Errorf("unverified address should not be linked, got %q", got)
+	}
+	admin["email_verified"] = true
+	if got := login(admin); got != "user 1" {
+		t.Errorf("admin should be linked, got %q", got)
+	}
+	if users, _ := store.UsersAll(); len(users) != 2 {
+		t.Errorf("want 2 users, got %d", len(users))
+	}
+
+	// callbacks without the state of the session are rejected.
+	resp, err := http.Get(url + "/login/oidc/callback?code=x&state=forged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("want %d for forged state, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestSSOFirstUser(t *testing.T) {
+	store := model.NewMemoryStore()
+	_, login, stop := ssoServer(t, store)
+	defer stop()
+
+	// the first user becomes an admin even if no group is mapped to a role.
+	if got := login(map[string]interface{}{
+		"sub":    "alice-id",
+		"email":  "alice@example.com",
+		"groups": []string{"sales"},
+	}); got != "user 1" {
+		t.Fatalf("alice should be created, got %q", got)
+	}
+	if u, _ := store.UserOne(1); u.Role != model.RoleAdmin {
+		t.Errorf("the first user should be an admin, got %s", u.Role)
+	}
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/view"
+)
+
+// Token is controller for personal access tokens of current user.
+type Token struct {
+	Store model.AccessTokenStore
+}
+
+// List shows access tokens of current user.
+func (t *Token) List(w http.ResponseWriter, r *http.Request) error {
+	return t.render(w, r, "")
+}
+
+// render renders the settings page of tokens. created is the token just
+// created, which is shown only this time.
+func (t *Token) render(w http.ResponseWriter, r *http.Request, created string) error {
+	tokens, err := t.Store.AccessTokens(CurrentUserID(r))
+	if err != nil {
+		return err
+	}
+	return view.Default(w, r, http.StatusOK, "tokens.tmpl", map[string]interface{}{
+		"title":   "Access tokens - go-wiki",
+		"tokens":  tokens,
+		"created": created,
+	})
+}
+
+// Create creates new access token named by name form value.
+func (t *Token) Create(w http.ResponseWriter, r *http.Request) error {
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	if name == "" {
+		return &httputil.HTTPError{Status: http.StatusBadRequest}
+	}
+	token, err := model.NewAccessTokenString()
+	if err != nil {
+		return err
+	}
+	m := &model.AccessToken{
+		UserID: CurrentUserID(r),
+		Name:   name,
+		Hash:   model.HashAccessToken(token),
+	}
+	if err := t.Store.InsertAccessToken(m); err != nil {
+		return err
+	}
+	return t.render(w, r, token)
+}
+
+// Revoke deletes the access token given by id form value.
+func (t *Token) Revoke(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.ParseInt(r.PostFormValue("id"), 10, 64)
+	if err != nil {
+		return &httputil.HTTPError{Status: http.StatusBadRequest, Err: err}
+	}
+	if err := t.Store.DeleteAccessToken(CurrentUserID(r), id); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/settings/tokens", http.StatusFound)
+	return nil
+}
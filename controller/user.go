@@ -1,20 +1,92 @@
 package controller
 
 import (
-	"database/sql"
+	"context"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	netmail "net/mail"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/mail"
 	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/ratelimit"
 	"github.com/suzuken/wiki/sessions"
 	"github.com/suzuken/wiki/view"
 )
 
+var (
+	errGroupNameRequired = errors.New("name of group is required")
+	errGroupNameTaken    = errors.New("name of group is already used")
+	errInvalidEmail      = errors.New("email address is invalid")
+)
+
 // User is controller for requests to user.
 type User struct {
-	DB *sql.DB
+	Store model.UserStore
+	// Auth checks passwords on login, such as local ones and ones of
+	// LDAP directories.
+	Auth model.Authenticator
+	// Articles is used for showing articles of users.
+	Articles model.ArticleStore
+	// Groups is used for managing groups of users.
+	Groups model.GroupStore
+	// Resets and Verifications are used for resetting passwords and
+	// verifying email addresses by links mailed by Mailer.
+	// BaseURL is like https://wiki.example.com, used for links in emails.
+	Resets        model.PasswordResetStore
+	Verifications model.EmailVerificationStore
+	Mailer        mail.Mailer
+	BaseURL       string
+	// Accounts and IPs limit failed logins by email addresses and by
+	// IP addresses respectively.
+	Accounts *ratelimit.Limiter
+	IPs      *ratelimit.Limiter
+	// ResetAccounts and ResetIPs limit requests of password reset links
+	// by email addresses and by IP addresses, apart from failed logins.
+	ResetAccounts *ratelimit.Limiter
+	ResetIPs      *ratelimit.Limiter
+	// MFA and Settings are used for two-factor authentication and its
+	// policy.
+	MFA      model.MFAStore
+	Settings model.SettingStore
+	// SSO shows the link to log in by single sign-on.
+	SSO bool
+	// Sessions are signed out when the password is reset, if not nil.
+	Sessions sessions.Store
+}
+
+// Profile shows the user given by path like /user/{id}
+// with articles created by the user and groups of the user.
+func (u *User) Profile(w http.ResponseWriter, r *http.Request) error {
+	var id int64
+	if _, err := fmt.Sscanf(r.URL.Path, "/user/%d", &id); err != nil {
+		return &httputil.HTTPError{Status: http.StatusNotFound, Err: err}
+	}
+	user, err := u.Store.UserOne(id)
+	if err != nil {
+		return notFound(err)
+	}
+	articles, err := u.Articles.ArticlesByAuthor(principal(r), id)
+	if err != nil {
+		return err
+	}
+	groups, err := u.Groups.GroupsByUser(id)
+	if err != nil {
+		return err
+	}
+	return view.Default(w, r, http.StatusOK, "user.tmpl", map[string]interface{}{
+		"title":    fmt.Sprintf("%s - go-wiki", user.Name),
+		"user":     user,
+		"articles": articles,
+		"groups":   groups,
+	})
 }
 
 func (u *User) SignupHandler(w http.ResponseWriter, r *http.Request) error {
@@ -28,14 +100,33 @@ func (u *User) SignupHandler(w http.ResponseWriter, r *http.Request) error {
 	}
 }
 
+// validEmail reports whether s is a bare email address, such as
+// alice@example.com, to which verification links can be sent.
+func validEmail(s string) bool {
+	addr, err := netmail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
 // signUp makes user signup.
 func (u *User) signUp(w http.ResponseWriter, r *http.Request) error {
 	var m model.User
 	m.Name = r.PostFormValue("name")
-	m.Email = r.PostFormValue("email")
+	m.Email = strings.TrimSpace(r.PostFormValue("email"))
 	password := r.PostFormValue("password")
+	var formErr error
+	switch {
+	case !validEmail(m.Email):
+		formErr = errInvalidEmail
+	case len(password) > model.MaxPasswordLength:
+		formErr = errPasswordTooLong
+	}
+	if formErr != nil {
+		return view.Default(w, r, http.StatusBadRequest, "signup.tmpl", map[string]interface{}{
+			"error": formErr,
+		})
+	}
 
-	b, err := model.UserExists(u.DB, m.Email)
+	b, err := u.Store.UserExists(m.Email)
 	if err != nil {
 		return err
 	}
@@ -45,23 +136,29 @@ func (u *User) signUp(w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}
 
-	if err := TXHandler(u.DB, func(tx *sql.Tx) error {
-		if _, err := m.Insert(tx, password); err != nil {
-			return err
-		}
-		return tx.Commit()
-	}); err != nil {
+	if err := u.Store.InsertUser(&m, password); err != nil {
+		return err
+	}
+	sess, _ := sessions.Get(r, "user")
+	if err := u.sendVerification(m); err != nil {
+		log.Printf("/signup: sending verification link failed: %s", err)
+	} else {
+		sess.AddFlash(fmt.Sprintf("the link to verify your email address is sent to %s.", m.Email))
+	}
+	if err := sessions.Save(r, w, sess); err != nil {
 		return err
 	}
 
-	http.Redirect(w, r, "/", 301)
+	http.Redirect(w, r, "/", http.StatusFound)
 	return nil
 }
 
 func (u *User) LoginHandler(w http.ResponseWriter, r *http.Request) error {
 	switch r.Method {
 	case "GET":
-		return view.Default(w, r, http.StatusOK, "login.tmpl", nil)
+		return view.Default(w, r, http.StatusOK, "login.tmpl", map[string]interface{}{
+			"sso": u.SSO,
+		})
 	case "POST":
 		return u.login(w, r)
 	default:
@@ -69,29 +166,43 @@ func (u *User) LoginHandler(w http.ResponseWriter, r *http.Request) error {
 	}
 }
 
-// Login try login.
+// Login try login. Failed attempts are limited for each account and
+// each IP address. Users who enabled two-factor authentication are asked
+// a code by MFALoginHandler before logged in.
 func (u *User) login(w http.ResponseWriter, r *http.Request) error {
-	m, err := model.Auth(u.DB, r.PostFormValue("email"), r.PostFormValue("password"))
+	email := r.PostFormValue("email")
+	account, ip := strings.ToLower(strings.TrimSpace(email)), remoteIP(r)
+	wait, err := u.waitLogin(account, ip)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return loginFailed(w, r, fmt.Sprintf("too many failed attempts. try again in %s.", ceilSecond(wait)))
+	}
+	m, err := u.Auth.Authenticate(email, r.PostFormValue("password"))
 	if err != nil {
 		log.Printf("/login: login failed: %s", err)
-		sess, _ := sessions.Get(r, "user")
-		sess.AddFlash("login failed.")
-		if err := sessions.Save(r, w, sess); err != nil {
-			log.Printf("/login: save session failed: %s", err)
+		wait, err := u.failLogin(account, ip)
+		if err != nil {
 			return err
 		}
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return nil
+		if wait > 0 {
+			return loginFailed(w, r, fmt.Sprintf("login failed. try again in %s.", ceilSecond(wait)))
+		}
+		return loginFailed(w, r, "login failed.")
+	}
+	// failures of the account are forgotten after the second factor passes,
+	// so that codes can not be guessed by logging in again.
+	if m.MFAEnabled {
+		return startMFALogin(w, r, m)
+	}
+	if err := u.Accounts.Reset(account); err != nil {
+		return err
 	}
 
 	log.Printf("authed: %#v", m)
 
-	sess, _ := sessions.Get(r, "user")
-	sess.Values["id"] = m.ID
-	sess.Values["email"] = m.Email
-	sess.Values["name"] = m.Name
-	if err := sessions.Save(r, w, sess); err != nil {
-		log.Printf("session can't save: %s", err)
+	if err := logIn(w, r, m); err != nil {
 		return err
 	}
 
@@ -120,17 +231,157 @@ func (u *User) logout(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// loginFailed tells why login failed by the flash message.
+func loginFailed(w http.ResponseWriter, r *http.Request, message string) error {
+	sess, _ := sessions.Get(r, "user")
+	sess.AddFlash(message)
+	if err := sessions.Save(r, w, sess); err != nil {
+		log.Printf("/login: save session failed: %s", err)
+		return err
+	}
+	http.Redirect(w, r, "/login", http.StatusFound)
+	return nil
+}
+
+// waitLogin returns how long the account and the IP address must wait
+// before next login, whichever is longer.
+func (u *User) waitLogin(account, ip string) (time.Duration, error) {
+	a, err := u.Accounts.Wait(account)
+	if err != nil {
+		return 0, err
+	}
+	i, err := u.IPs.Wait(ip)
+	if err != nil {
+		return 0, err
+	}
+	return longer(a, i), nil
+}
+
+// failLogin records failed login of the account from the IP address and
+// returns how long they must wait, whichever is longer.
+func (u *User) failLogin(account, ip string) (time.Duration, error) {
+	a, err := u.Accounts.Fail(account)
+	if err != nil {
+		return 0, err
+	}
+	i, err := u.IPs.Fail(ip)
+	if err != nil {
+		return 0, err
+	}
+	return longer(a, i), nil
+}
+
+// longer returns the longer duration.
+func longer(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// ceilSecond rounds up d to seconds for showing to users.
+func ceilSecond(d time.Duration) time.Duration {
+	return (d + time.Second - 1).Truncate(time.Second)
+}
+
+// remoteIP returns IP address of the client.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// contextKey is type of keys for values in request context.
+type contextKey int
+
+const (
+	// userKey is key of the user authenticated without sessions.
+	userKey contextKey = iota
+	// groupsKey is key of groups current user is member of.
+	groupsKey
+)
+
+// WithUser returns the request authenticated as the user by other than
+// sessions, such as access tokens.
+func WithUser(r *http.Request, u model.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey, u))
+}
+
+// contextUser returns the user given by WithUser.
+func contextUser(r *http.Request) (model.User, bool) {
+	u, ok := r.Context().Value(userKey).(model.User)
+	return u, ok
+}
+
+// WithGroups returns the request whose user is member of the groups.
+func WithGroups(r *http.Request, groups []model.Group) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), groupsKey, groups))
+}
+
+// InGroup reports whether current user is member of any of the groups
+// given by names. Groups are given by WithGroups beforehand.
+func InGroup(r *http.Request, names ...string) bool {
+	if r == nil {
+		return false
+	}
+	groups, _ := r.Context().Value(groupsKey).([]model.Group)
+	for _, g := range groups {
+		for _, name := range names {
+			if g.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CurrentUser returns the user who sent the request.
+// The user is loaded for each request, so the role is up to date.
+func CurrentUser(r *http.Request) (model.User, bool) {
+	if r == nil {
+		return model.User{}, false
+	}
+	return contextUser(r)
+}
+
+// principal returns who sent the request for access control of articles.
+func principal(r *http.Request) model.Principal {
+	u, _ := CurrentUser(r)
+	return u.Principal()
+}
+
+// Can reports whether current user has the permission, such as edit.
+func Can(r *http.Request, permission string) bool {
+	u, ok := CurrentUser(r)
+	return ok && u.Can(model.Permission(permission))
+}
+
 // LoggedIn returns if current session user is logged in or not.
+// Users authenticated by access tokens are also logged in. The user must
+// be loaded by LoadUser or TokenAuth, so that sessions of deleted users
+// are not logged in.
 func LoggedIn(r *http.Request) bool {
+	_, ok := CurrentUser(r)
+	return ok
+}
+
+// CurrentUserID returns id of current user who logged in.
+// If not logged in, returns 0.
+func CurrentUserID(r *http.Request) int64 {
 	if r == nil {
-		return false
+		return 0
+	}
+	if u, ok := contextUser(r); ok {
+		return u.ID
 	}
 	sess, _ := sessions.Get(r, "user")
-	id, ok := sess.Values["id"]
+	id, ok := sess.Values["id"].(int64)
 	if !ok {
-		return false
+		return 0
 	}
-	return id.(int64) != 0
+	return id
 }
 
 // CurrentName returns current user name who logged in.
@@ -138,6 +389,9 @@ func CurrentName(r *http.Request) string {
 	if r == nil {
 		return ""
 	}
+	if u, ok := contextUser(r); ok {
+		return u.Name
+	}
 	sess, _ := sessions.Get(r, "user")
 	rawname, ok := sess.Values["name"]
 	if !ok {
@@ -179,6 +433,38 @@ func Flash(r *http.Request, w http.ResponseWriter) []string {
 	return messages
 }
 
+// Roles lists users with their roles for admins.
+func (u *User) Roles(w http.ResponseWriter, r *http.Request) error {
+	users, err := u.Store.UsersAll()
+	if err != nil {
+		return err
+	}
+	return view.Default(w, r, http.StatusOK, "roles.tmpl", map[string]interface{}{
+		"title": "Users - go-wiki",
+		"users": users,
+		"roles": model.Roles,
+	})
+}
+
+// SetRole changes role of the user given by id form value to role form
+// value. Admins can not change their own role, so that at least one admin
+// is left.
+func (u *User) SetRole(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.ParseInt(r.PostFormValue("id"), 10, 64)
+	if err != nil {
+		return &httputil.HTTPError{Status: http.StatusBadRequest, Err: err}
+	}
+	role := r.PostFormValue("role")
+	if !model.IsRole(role) || id == CurrentUserID(r) {
+		return &httputil.HTTPError{Status: http.StatusBadRequest}
+	}
+	if err := u.Store.UpdateUserRole(id, role); err != nil {
+		return notFound(err)
+	}
+	http.Redirect(w, r, "/admin/users", http.StatusFound)
+	return nil
+}
+
 // AuthRequired returns a handler function which checks
 // if user logged in or not.
 func AuthRequired() http.HandlerFunc {
@@ -188,3 +474,145 @@ func AuthRequired() http.HandlerFunc {
 		}
 	}
 }
+
+// ListGroups lists groups with the form to create a group, for admins.
+func (u *User) ListGroups(w http.ResponseWriter, r *http.Request) error {
+	groups, err := u.Groups.GroupsAll()
+	if err != nil {
+		return err
+	}
+	return view.Default(w, r, http.StatusOK, "groups.tmpl", map[string]interface{}{
+		"title":  "Groups - go-wiki",
+		"groups": groups,
+	})
+}
+
+// groupName returns the name form value, which must not be empty.
+func groupName(r *http.Request) (string, error) {
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	if name == "" {
+		return "", &httputil.HTTPError{Status: http.StatusBadRequest, Err: errGroupNameRequired}
+	}
+	return name, nil
+}
+
+// groupError makes errors of group stores into HTTP errors.
+func groupError(err error) error {
+	if errors.Cause(err) == model.ErrDuplicated {
+		return &httputil.HTTPError{Status: http.StatusBadRequest, Err: errGroupNameTaken}
+	}
+	return notFound(err)
+}
+
+// CreateGroup creates new group named by name form value.
+func (u *User) CreateGroup(w http.ResponseWriter, r *http.Request) error {
+	name, err := groupName(r)
+	if err != nil {
+		return err
+	}
+	g := &model.Group{Name: name}
+	if err := u.Groups.InsertGroup(g); err != nil {
+		return groupError(err)
+	}
+	http.Redirect(w, r, fmt.Sprintf("/admin/groups/%d", g.ID), http.StatusFound)
+	return nil
+}
+
+// groupPath splits path like /admin/groups/{id}/rename into the group id
+// and rest of the path.
+func groupPath(path string) (int64, string, error) {
+	parts := strings.SplitN(strings.Trim(strings.TrimPrefix(path, "/admin/groups/"), "/"), "/", 2)
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", &httputil.HTTPError{Status: http.StatusNotFound, Err: err}
+	}
+	if len(parts) == 1 {
+		return id, "", nil
+	}
+	return id, parts[1], nil
+}
+
+// ShowGroup shows the group given by path like /admin/groups/{id}
+// with its members and forms to manage it.
+func (u *User) ShowGroup(w http.ResponseWriter, r *http.Request) error {
+	id, sub, err := groupPath(r.URL.Path)
+	if err != nil {
+		return err
+	}
+	if sub != "" {
+		http.NotFound(w, r)
+		return nil
+	}
+	group, err := u.Groups.GroupOne(id)
+	if err != nil {
+		return notFound(err)
+	}
+	members, err := u.Groups.GroupMembers(id)
+	if err != nil {
+		return err
+	}
+	users, err := u.Store.UsersAll()
+	if err != nil {
+		return err
+	}
+	return view.Default(w, r, http.StatusOK, "group.tmpl", map[string]interface{}{
+		"title":   fmt.Sprintf("Group %s - go-wiki", group.Name),
+		"group":   group,
+		"members": members,
+		"users":   users,
+	})
+}
+
+// EditGroup changes the group by path like /admin/groups/{id}/{action}.
+// Actions are rename by name form value, delete, and add and remove of
+// the member given by user form value.
+func (u *User) EditGroup(w http.ResponseWriter, r *http.Request) error {
+	id, action, err := groupPath(r.URL.Path)
+	if err != nil {
+		return err
+	}
+	next := fmt.Sprintf("/admin/groups/%d", id)
+	switch action {
+	case "rename":
+		name, err := groupName(r)
+		if err != nil {
+			return err
+		}
+		if err := u.Groups.UpdateGroup(&model.Group{ID: id, Name: name}); err != nil {
+			return groupError(err)
+		}
+	case "delete":
+		err := u.Groups.DeleteGroup(id)
+		if errors.Cause(err) == model.ErrInUse {
+			// articles restricted to the group would be open to everyone.
+			sess, _ := sessions.Get(r, "user")
+			sess.AddFlash("the group is named by ACL entries. remove them before deleting the group.")
+			if err := sessions.Save(r, w, sess); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		next = "/admin/groups"
+	case "add", "remove":
+		userID, err := strconv.ParseInt(r.PostFormValue("user"), 10, 64)
+		if err != nil {
+			return &httputil.HTTPError{Status: http.StatusBadRequest, Err: err}
+		}
+		if action == "add" {
+			err = u.Groups.AddGroupMember(id, userID)
+		} else {
+			err = u.Groups.RemoveGroupMember(id, userID)
+		}
+		if err != nil {
+			return notFound(err)
+		}
+	default:
+		http.NotFound(w, r)
+		return nil
+	}
+	http.Redirect(w, r, next, http.StatusFound)
+	return nil
+}
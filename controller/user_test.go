@@ -0,0 +1,34 @@
+package controller_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/suzuken/wiki/controller"
+	"github.com/suzuken/wiki/model"
+)
+
+func TestSignupInvalidEmail(t *testing.T) {
+	initView(t)
+	store := model.NewMemoryStore()
+	user := &controller.User{Store: store}
+	for _, email := range []string{"", "alice", "alice@", "Alice <alice@example.com>", "alice@example.com\r\nBcc: bob@example.com"} {
+		form := url.Values{"name": {"alice"}, "email": {email}, "password": {"secret"}}
+		req := httptest.NewRequest("POST", "/signup", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := user.SignupHandler(w, req); err != nil {
+			t.Errorf("%q: %s", email, err)
+			continue
+		}
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "email address is invalid") {
+			t.Errorf("%q: want form error, got %d", email, w.Code)
+		}
+	}
+	if users, _ := store.UsersAll(); len(users) != 0 {
+		t.Errorf("users should not be created: %+v", users)
+	}
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/mail"
+	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/sessions"
+)
+
+var (
+	errVerificationInvalid = errors.New("the link is invalid, expired or already used")
+	errAlreadyVerified     = errors.New("email address is already verified")
+)
+
+// sendVerification creates a token to verify the email address of the user
+// and mails the link with the token to the address.
+func (u *User) sendVerification(user model.User) error {
+	v, token, err := model.NewEmailVerification(user, model.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	if err := u.Verifications.InsertEmailVerification(v); err != nil {
+		return err
+	}
+	link := u.BaseURL + "/verify?token=" + url.QueryEscape(token)
+	return u.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address of go-wiki",
+		Body: fmt.Sprintf(`Hi %s,
+
+Thank you for signing up for go-wiki.
+Open the link below to verify your email address. You can edit articles
+after verified. The link expires in %.0f hours.
+
+%s
+
+If you did not sign up, you can ignore this email.
+`, user.Name, model.EmailVerificationTTL.Hours(), link),
+	})
+}
+
+// VerifyEmail verifies the email address by the token given by token
+// parameter, which is sent by the link in the email.
+func (u *User) VerifyEmail(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	user, err := u.Verifications.VerifyEmail(model.HashEmailVerificationToken(r.FormValue("token")))
+	if errors.Cause(err) == model.ErrNotFound {
+		return &httputil.HTTPError{Status: http.StatusNotFound, Err: errVerificationInvalid}
+	}
+	if err != nil {
+		return err
+	}
+	sess, _ := sessions.Get(r, "user")
+	sess.AddFlash(fmt.Sprintf("%s is verified.", user.Email))
+	if err := sessions.Save(r, w, sess); err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+	return nil
+}
+
+// ResendVerification sends the link to verify the email address of current
+// user again.
+func (u *User) ResendVerification(w http.ResponseWriter, r *http.Request) error {
+	user, ok := CurrentUser(r)
+	if !ok {
+		return &httputil.HTTPError{Status: http.StatusUnauthorized}
+	}
+	if user.EmailVerified {
+		return &httputil.HTTPError{Status: http.StatusBadRequest, Err: errAlreadyVerified}
+	}
+	if err := u.sendVerification(user); err != nil {
+		return err
+	}
+	sess, _ := sessions.Get(r, "user")
+	sess.AddFlash(fmt.Sprintf("the link to verify is sent to %s.", user.Email))
+	if err := sessions.Save(r, w, sess); err != nil {
+		return err
+	}
+	http.Redirect(w, r, fmt.Sprintf("/user/%d", user.ID), http.StatusFound)
+	return nil
+}
@@ -2,10 +2,13 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 
+	"github.com/suzuken/wiki/ldapauth"
+	"github.com/suzuken/wiki/model"
 	"gopkg.in/yaml.v1"
 )
 
@@ -21,12 +24,42 @@ func (cs Configs) Open(env string) (*sql.DB, error) {
 	return config.Open()
 }
 
+// Store opens the storage for each environment.
+func (cs Configs) Store(env string) (model.Store, error) {
+	config, ok := cs[env]
+	if !ok {
+		return nil, fmt.Errorf("no database configuration for %s", env)
+	}
+	return config.Store()
+}
+
 // Config is a database configuration.
 // It's save as sql-migrate schema style.
 //
 // see also: https://github.com/rubenv/sql-migrate
 type Config struct {
+	// Dialect is one of mysql, sqlite3 and memory. Default is mysql.
+	Dialect    string `yaml:"dialect"`
 	Datasource string `yaml:"datasource"`
+	// Auth lists how users log in, tried in order. Default is local only.
+	Auth []AuthConfig `yaml:"auth"`
+}
+
+// AuthConfig is a configuration of authentication. Type is local for
+// passwords saved in the database, or ldap for an LDAP directory
+// configured by the other fields.
+type AuthConfig struct {
+	Type            string `yaml:"type"`
+	ldapauth.Config `yaml:",inline"`
+}
+
+// Authenticator returns the authenticator for each environment.
+func (cs Configs) Authenticator(env string, store model.Store) (model.Authenticator, error) {
+	config, ok := cs[env]
+	if !ok {
+		return nil, fmt.Errorf("no database configuration for %s", env)
+	}
+	return config.Authenticator(store)
 }
 
 // DSN returns data source name configured.
@@ -35,9 +68,62 @@ func (c *Config) DSN() string {
 }
 
 // Open connets database.
-// NOTE: supports mysql only.
+// Database driver for the dialect should be imported by the main package.
 func (c *Config) Open() (*sql.DB, error) {
-	return sql.Open("mysql", c.DSN())
+	switch c.Dialect {
+	case "", "mysql":
+		return sql.Open("mysql", c.DSN())
+	case "sqlite3":
+		db, err := sql.Open("sqlite3", c.DSN())
+		if err != nil {
+			return nil, err
+		}
+		// SQLite allows only one writer at once.
+		db.SetMaxOpenConns(1)
+		return db, nil
+	}
+	return nil, fmt.Errorf("unsupported dialect: %s", c.Dialect)
+}
+
+// Store opens the storage for the dialect.
+// memory dialect makes the store which keeps data in memory only.
+func (c *Config) Store() (model.Store, error) {
+	if c.Dialect == "memory" {
+		return model.NewMemoryStore(), nil
+	}
+	db, err := c.Open()
+	if err != nil {
+		return nil, err
+	}
+	dialect := c.Dialect
+	if dialect == "" {
+		dialect = "mysql"
+	}
+	return model.NewSQLStore(db, dialect), nil
+}
+
+// Authenticator returns the authenticator trying configurations of Auth
+// in order. Users of LDAP directories are created in the store.
+func (c *Config) Authenticator(store model.Store) (model.Authenticator, error) {
+	if len(c.Auth) == 0 {
+		return model.LocalAuth{Users: store}, nil
+	}
+	var as model.Authenticators
+	for _, ac := range c.Auth {
+		switch ac.Type {
+		case "local":
+			as = append(as, model.LocalAuth{Users: store})
+		case "ldap":
+			a, err := ldapauth.New(ac.Config, store, store)
+			if err != nil {
+				return nil, err
+			}
+			as = append(as, a)
+		default:
+			return nil, fmt.Errorf("unsupported auth type: %s", ac.Type)
+		}
+	}
+	return as, nil
 }
 
 // NewConfigsFromFile reads settings from file.
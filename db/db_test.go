@@ -3,6 +3,8 @@ package db
 import (
 	"strings"
 	"testing"
+
+	"github.com/suzuken/wiki/model"
 )
 
 func TestReadConfig(t *testing.T) {
@@ -12,6 +14,9 @@ development:
 
 test:
   datasource: root@localhost/test
+
+local:
+  dialect: memory
 `)
 
 	configs, err := NewConfigs(r)
@@ -28,3 +33,71 @@ test:
 		t.Fatalf("want %s, got %s", ex, c.DSN())
 	}
 }
+
+func TestMemoryStore(t *testing.T) {
+	configs, err := NewConfigs(strings.NewReader(`
+local:
+  dialect: memory
+unknown:
+  dialect: oracle
+`))
+	if err != nil {
+		t.Fatalf("read config failed: %s", err)
+	}
+	s, err := configs.Store("local")
+	if err != nil {
+		t.Fatalf("open store failed: %s", err)
+	}
+	defer s.Close()
+	if _, err := configs.Store("unknown"); err == nil {
+		t.Error("unsupported dialect should be error")
+	}
+	if _, err := configs.Store("production"); err == nil {
+		t.Error("missing environment should be error")
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	configs, err := NewConfigs(strings.NewReader(`
+local:
+  dialect: memory
+ldap:
+  dialect: memory
+  auth:
+    - type: ldap
+      url: ldap://ldap.example.com
+      base_dn: ou=people,dc=example,dc=com
+      user_dn: uid=%s,ou=people,dc=example,dc=com
+    - type: local
+broken:
+  dialect: memory
+  auth:
+    - type: kerberos
+`))
+	if err != nil {
+		t.Fatalf("read config failed: %s", err)
+	}
+	c := configs["ldap"]
+	if len(c.Auth) != 2 || c.Auth[0].Type != "ldap" || c.Auth[0].BaseDN != "ou=people,dc=example,dc=com" ||
+		c.Auth[0].UserDN != "uid=%s,ou=people,dc=example,dc=com" || c.Auth[1].Type != "local" {
+		t.Fatalf("unexpected auth configuration: %+v", c.Auth)
+	}
+	s, err := configs.Store("ldap")
+	if err != nil {
+		t.Fatalf("open store failed: %s", err)
+	}
+	defer s.Close()
+	a, err := configs.Authenticator("ldap", s)
+	if err != nil {
+		t.Fatalf("auth initialization failed: %s", err)
+	}
+	if as, ok := a.(model.Authenticators); !ok || len(as) != 2 {
+		t.Errorf("want 2 authenticators, got %#v", a)
+	}
+	if a, err := configs.Authenticator("local", s); err != nil || a != (model.LocalAuth{Users: s}) {
+		t.Errorf("want local auth by default, got %#v, %v", a, err)
+	}
+	if _, err := configs.Authenticator("broken", s); err == nil {
+		t.Error("unsupported auth type should be error")
+	}
+}
@@ -0,0 +1,120 @@
+// Package diff computes line-based differences between texts.
+package diff
+
+import "strings"
+
+// Op is a kind of operation for a line.
+type Op int
+
+const (
+	// Equal means the line is in both texts.
+	Equal Op = iota
+	// Insert means the line is only in the new text.
+	Insert
+	// Delete means the line is only in the old text.
+	Delete
+)
+
+func (o Op) String() string {
+	switch o {
+	case Insert:
+		return "insert"
+	case Delete:
+		return "delete"
+	}
+	return "equal"
+}
+
+// Line is a line of the difference.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Prefix returns unified diff style prefix for the line.
+func (l Line) Prefix() string {
+	switch l.Op {
+	case Insert:
+		return "+"
+	case Delete:
+		return "-"
+	}
+	return " "
+}
+
+// Split splits text into lines. CRLF sent from browsers is treated as LF.
+func Split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// Lines returns line-based difference from a to b.
+func Lines(a, b string) []Line {
+	return diff(Split(a), Split(b))
+}
+
+// diff computes the difference by longest common subsequence.
+// Common prefix and suffix are trimmed beforehand, which keeps
+// the table small for usual edits.
+func diff(a, b []string) []Line {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]Line, 0, len(a)+len(b))
+	for _, s := range a[:prefix] {
+		lines = append(lines, Line{Op: Equal, Text: s})
+	}
+
+	x, y := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	// lcs[i][j] is the length of LCS of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			lines = append(lines, Line{Op: Equal, Text: x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Op: Delete, Text: x[i]})
+			i++
+		default:
+			lines = append(lines, Line{Op: Insert, Text: y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		lines = append(lines, Line{Op: Delete, Text: x[i]})
+	}
+	for ; j < len(y); j++ {
+		lines = append(lines, Line{Op: Insert, Text: y[j]})
+	}
+
+	for _, s := range a[len(a)-suffix:] {
+		lines = append(lines, Line{Op: Equal, Text: s})
+	}
+	return lines
+}
@@ -0,0 +1,33 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want []Line
+	}{
+		{"", "", []Line{}},
+		{"a\nb\n", "a\nb\n", []Line{{Equal, "a"}, {Equal, "b"}}},
+		{"", "a", []Line{{Insert, "a"}}},
+		{"a", "", []Line{{Delete, "a"}}},
+		{
+			"a\r\nb\r\nc\r\n",
+			"a\nx\nc\n",
+			[]Line{{Equal, "a"}, {Delete, "b"}, {Insert, "x"}, {Equal, "c"}},
+		},
+		{
+			"a\nb\nc\nd",
+			"b\nc\ne\nd",
+			[]Line{{Delete, "a"}, {Equal, "b"}, {Equal, "c"}, {Insert, "e"}, {Equal, "d"}},
+		},
+	}
+	for _, c := range cases {
+		if got := Lines(c.a, c.b); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Lines(%q, %q): want %v, got %v", c.a, c.b, c.want, got)
+		}
+	}
+}
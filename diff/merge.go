@@ -0,0 +1,128 @@
+package diff
+
+import "strings"
+
+// Conflict markers written by Merge3 around conflicting lines.
+const (
+	MarkerMine   = "<<<<<<< yours"
+	MarkerSep    = "======="
+	MarkerTheirs = ">>>>>>> theirs"
+)
+
+// hunk is a change to base, which replaces base[start:end] by lines.
+type hunk struct {
+	start, end int
+	lines      []string
+}
+
+// hunks returns changes in the difference from base.
+func hunks(ls []Line) []hunk {
+	var (
+		hs  []hunk
+		cur *hunk
+		i   int
+	)
+	for _, l := range ls {
+		if l.Op == Equal {
+			if cur != nil {
+				hs = append(hs, *cur)
+				cur = nil
+			}
+			i++
+			continue
+		}
+		if cur == nil {
+			cur = &hunk{start: i, end: i}
+		}
+		if l.Op == Delete {
+			cur.end++
+			i++
+		} else {
+			cur.lines = append(cur.lines, l.Text)
+		}
+	}
+	if cur != nil {
+		hs = append(hs, *cur)
+	}
+	return hs
+}
+
+// apply returns base[start:end] changed by hs, which are in the range.
+func apply(base []string, start, end int, hs []hunk) []string {
+	var out []string
+	pos := start
+	for _, h := range hs {
+		out = append(out, base[pos:h.start]...)
+		out = append(out, h.lines...)
+		pos = h.end
+	}
+	return append(out, base[pos:end]...)
+}
+
+// Merge3 merges mine and theirs, which are both edited from base.
+// Changes to different lines are merged. If both change the same lines
+// differently, both versions are kept between conflict markers and
+// ok is false. Lines of the result are joined by LF without trailing one.
+func Merge3(base, mine, theirs string) (merged string, ok bool) {
+	b := Split(base)
+	hm, ht := hunks(Lines(base, mine)), hunks(Lines(base, theirs))
+	var out []string
+	ok = true
+	pos, i, j := 0, 0, 0
+	for i < len(hm) || j < len(ht) {
+		// start a group of overlapping changes by the earliest one.
+		var start, end int
+		if j == len(ht) || (i < len(hm) && hm[i].start <= ht[j].start) {
+			start, end = hm[i].start, hm[i].end
+		} else {
+			start, end = ht[j].start, ht[j].end
+		}
+		gi, gj := i, j
+		for grown := true; grown; {
+			grown = false
+			for ; i < len(hm) && (hm[i].start < end || hm[i].start == start); i++ {
+				if hm[i].end > end {
+					end = hm[i].end
+				}
+				grown = true
+			}
+			for ; j < len(ht) && (ht[j].start < end || ht[j].start == start); j++ {
+				if ht[j].end > end {
+					end = ht[j].end
+				}
+				grown = true
+			}
+		}
+		out = append(out, b[pos:start]...)
+		m := apply(b, start, end, hm[gi:i])
+		t := apply(b, start, end, ht[gj:j])
+		switch {
+		case gi == i:
+			out = append(out, t...)
+		case gj == j, equal(m, t):
+			out = append(out, m...)
+		default:
+			ok = false
+			out = append(out, MarkerMine)
+			out = append(out, m...)
+			out = append(out, MarkerSep)
+			out = append(out, t...)
+			out = append(out, MarkerTheirs)
+		}
+		pos = end
+	}
+	out = append(out, b[pos:]...)
+	return strings.Join(out, "\n"), ok
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
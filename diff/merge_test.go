@@ -0,0 +1,32 @@
+package diff
+
+import "testing"
+
+func TestMerge3(t *testing.T) {
+	base := "a\nb\nc\nd\ne"
+	tests := []struct {
+		mine, theirs string
+		want         string
+		ok           bool
+	}{
+		// only one side changed.
+		{base, "a\nB\nc\nd\ne", "a\nB\nc\nd\ne", true},
+		{"a\nb\nc\nd\ne\nf", base, "a\nb\nc\nd\ne\nf", true},
+		// changes to different lines.
+		{"A\nb\nc\nd\ne", "a\nb\nc\nd\nE", "A\nb\nc\nd\nE", true},
+		{"a\nb\nx\nc\nd\ne", "a\nb\nc\nd", "a\nb\nx\nc\nd", true},
+		// same change by both.
+		{"a\nB\nc\nd\ne", "a\nB\nc\nd\ne", "a\nB\nc\nd\ne", true},
+		// CRLF from browsers is same as LF.
+		{"a\r\nB\r\nc\r\nd\r\ne", base, "a\nB\nc\nd\ne", true},
+		// conflicts.
+		{"a\nB\nc\nd\ne", "a\nb2\nc\nd\ne", "a\n<<<<<<< yours\nB\n=======\nb2\n>>>>>>> theirs\nc\nd\ne", false},
+		{"a\nb\nc\nd\ne\nmine", "a\nb\nc\nd\ne\ntheirs", "a\nb\nc\nd\ne\n<<<<<<< yours\nmine\n=======\ntheirs\n>>>>>>> theirs", false},
+	}
+	for _, tt := range tests {
+		got, ok := Merge3(base, tt.mine, tt.theirs)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Merge3(%q, %q): want %q, %v, got %q, %v", tt.mine, tt.theirs, tt.want, tt.ok, got, ok)
+		}
+	}
+}
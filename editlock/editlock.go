@@ -0,0 +1,104 @@
+// Package editlock provides soft locks of articles being edited.
+//
+// Locks are advisory: they are used to tell others that someone is
+// editing the article, and never prevent saving. Locks expire after TTL,
+// so locks of users who left the edit page without saving disappear.
+package editlock
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultTTL is the default lifetime of locks.
+const DefaultTTL = 10 * time.Minute
+
+// Lock is a lock of an article by a user.
+type Lock struct {
+	ArticleID int64
+	UserID    int64
+	UserName  string
+	// Since is when the user started editing.
+	Since time.Time
+	// Expires is when the lock expires.
+	Expires time.Time
+}
+
+// Table holds locks of articles in memory.
+// It is safe for concurrent use.
+type Table struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	locks map[int64]Lock
+
+	// now is replaceable for testing.
+	now func() time.Time
+}
+
+// New returns an empty table whose locks live for ttl.
+func New(ttl time.Duration) *Table {
+	return &Table{
+		ttl:   ttl,
+		locks: make(map[int64]Lock),
+		now:   time.Now,
+	}
+}
+
+// live returns the lock of the article if it is not expired.
+// Expired lock is removed.
+func (t *Table) live(articleID int64) (Lock, bool) {
+	l, ok := t.locks[articleID]
+	if !ok {
+		return Lock{}, false
+	}
+	if !t.now().Before(l.Expires) {
+		delete(t.locks, articleID)
+		return Lock{}, false
+	}
+	return l, true
+}
+
+// Acquire locks the article for the user. If other user holds the lock,
+// it is kept and returned with false. The user can take over own lock,
+// e.g. from another tab, which restarts the lock.
+func (t *Table) Acquire(articleID, userID int64, userName string) (Lock, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if l, ok := t.live(articleID); ok && l.UserID != userID {
+		return l, false
+	}
+	now := t.now()
+	l := Lock{
+		ArticleID: articleID,
+		UserID:    userID,
+		UserName:  userName,
+		Since:     now,
+		Expires:   now.Add(t.ttl),
+	}
+	t.locks[articleID] = l
+	return l, true
+}
+
+// Holder returns the live lock of the article.
+func (t *Table) Holder(articleID int64) (Lock, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.live(articleID)
+}
+
+// Release unlocks the article if the user holds the lock.
+func (t *Table) Release(articleID, userID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if l, ok := t.locks[articleID]; ok && l.UserID == userID {
+		delete(t.locks, articleID)
+	}
+}
+
+// Remove unlocks the article regardless of the holder,
+// e.g. when the article is deleted.
+func (t *Table) Remove(articleID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.locks, articleID)
+}
@@ -0,0 +1,49 @@
+package editlock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTable(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	table := New(time.Minute)
+	table.now = func() time.Time { return now }
+
+	if _, ok := table.Acquire(1, 10, "alice"); !ok {
+		t.Fatal("alice should get the lock")
+	}
+	l, ok := table.Acquire(1, 20, "bob")
+	if ok || l.UserName != "alice" {
+		t.Errorf("bob should see alice's lock, got %+v, %v", l, ok)
+	}
+
+	// alice opens another tab.
+	now = now.Add(30 * time.Second)
+	if l, ok := table.Acquire(1, 10, "alice"); !ok || !l.Since.Equal(now) {
+		t.Errorf("alice should take over own lock, got %+v, %v", l, ok)
+	}
+
+	// bob can not release alice's lock.
+	table.Release(1, 20)
+	if _, ok := table.Holder(1); !ok {
+		t.Error("lock should be held by alice")
+	}
+	table.Release(1, 10)
+	if _, ok := table.Holder(1); ok {
+		t.Error("lock should be released")
+	}
+
+	table.Acquire(2, 10, "alice")
+	now = now.Add(time.Minute)
+	if _, ok := table.Holder(2); ok {
+		t.Error("lock should be expired")
+	}
+	if _, ok := table.Acquire(2, 20, "bob"); !ok {
+		t.Error("bob should get the expired lock")
+	}
+	table.Remove(2)
+	if _, ok := table.Holder(2); ok {
+		t.Error("lock should be removed")
+	}
+}
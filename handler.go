@@ -10,21 +10,39 @@ package wiki
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"runtime/debug"
+	"strings"
 
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/securecookie"
 	"github.com/suzuken/wiki/controller"
 	"github.com/suzuken/wiki/httputil"
+	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/sessions"
 )
 
-var errUnauthrized = errors.New("unauthorized")
+var (
+	errUnauthrized  = errors.New("unauthorized")
+	errForbidden    = controller.ErrForbidden
+	errInvalidToken = errors.New("invalid access token")
+	errUnverified   = errors.New("email address is not verified")
+	errMFARequired  = errors.New("two-factor authentication is required")
+)
 
-// Auth verify if session user is logged in.
-func Auth(h handler) handler {
+// Auth verify if the user is logged in by session or access token.
+// Access tokens are resolved by TokenAuth beforehand.
+// It is for pages of users themselves, such as settings, and for
+// operations on articles, which are authorized by roles and ACLs
+// in the article controller.
+// If names of groups are given, the user must be member of any of them,
+// otherwise the request is forbidden. Groups are loaded by LoadUser.
+func Auth(h handler, groups ...string) handler {
 	return func(w http.ResponseWriter, r *http.Request) error {
 		if !controller.LoggedIn(r) {
 			return &httputil.HTTPError{
@@ -32,9 +50,214 @@ func Auth(h handler) handler {
 				Err:    errUnauthrized,
 			}
 		}
+		if len(groups) > 0 && !controller.InGroup(r, groups...) {
+			return &httputil.HTTPError{
+				Status: http.StatusForbidden,
+				Err:    errForbidden,
+			}
+		}
+		return h(w, r)
+	}
+}
+
+// Require verifies if current user has the permission by the role.
+// Users not logged in are unauthorized, and users without the permission
+// are forbidden. Current user is loaded by LoadUser or TokenAuth beforehand.
+func Require(p model.Permission, h handler) handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		u, ok := controller.CurrentUser(r)
+		if !ok {
+			return &httputil.HTTPError{
+				Status: http.StatusUnauthorized,
+				Err:    errUnauthrized,
+			}
+		}
+		if !u.Can(p) {
+			err := errForbidden
+			if !u.EmailVerified {
+				err = errUnverified
+			}
+			return &httputil.HTTPError{
+				Status: http.StatusForbidden,
+				Err:    err,
+			}
+		}
+		return h(w, r)
+	}
+}
+
+// LoadUser loads the user logged in by session for each request,
+// so that changes of roles take effect immediately. Groups of the user,
+// including one authenticated by TokenAuth, are also loaded.
+func LoadUser(users model.UserStore, groups model.GroupStore, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := controller.CurrentUser(r); !ok {
+			if id := controller.CurrentUserID(r); id != 0 {
+				u, err := users.UserOne(id)
+				switch {
+				case err == nil:
+					r = controller.WithUser(r, u)
+				case err == model.ErrNotFound:
+					// the user has been deleted since logging in.
+					sess, _ := sessions.Get(r, "user")
+					if err := sessions.Clear(r, w, sess); err != nil {
+						logError(r, err, nil)
+					}
+				default:
+					logError(r, err, nil)
+				}
+			}
+		}
+		if u, ok := controller.CurrentUser(r); ok {
+			gs, err := groups.GroupsByUser(u.ID)
+			if err != nil {
+				logError(r, err, nil)
+			}
+			r = controller.WithGroups(r, gs)
+		}
 		h.ServeHTTP(w, r)
-		return nil
+	})
+}
+
+// mfaExempt are paths users without two-factor authentication can access
+// while the policy requires it, to enable it or to log out.
+var mfaExempt = []string{"/settings/mfa", "/logout", "/verify", "/static"}
+
+// RequireMFA makes users who have not enabled two-factor authentication
+// enable it, if the policy requires it. Pages redirect to the settings, and
+// APIs are forbidden. Current user is loaded by LoadUser beforehand.
+func RequireMFA(settings model.SettingStore, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := controller.CurrentUser(r)
+		if !ok || u.MFAEnabled {
+			h.ServeHTTP(w, r)
+			return
+		}
+		for _, p := range mfaExempt {
+			if r.URL.Path == p || strings.HasPrefix(r.URL.Path, p+"/") {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		required, err := controller.MFARequired(settings)
+		if err != nil {
+			logError(r, err, nil)
+			handleError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		switch {
+		case !required:
+			h.ServeHTTP(w, r)
+		case strings.HasPrefix(r.URL.Path, "/api/"):
+			handleJSONError(w, r, http.StatusForbidden, errMFARequired)
+		default:
+			http.Redirect(w, r, "/settings/mfa", http.StatusFound)
+		}
+	})
+}
+
+// TokenAuth authenticates requests with Authorization: Bearer header by
+// access tokens. CSRF check is skipped for them, since browsers never send
+// the header by themselves. Requests with invalid tokens are rejected.
+func TokenAuth(store model.AccessTokenStore, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		u, err := store.UserByAccessToken(model.HashAccessToken(token))
+		if err != nil {
+			if err != model.ErrNotFound {
+				logError(r, err, nil)
+			}
+			handleJSONError(w, r, http.StatusUnauthorized, errInvalidToken)
+			return
+		}
+		h.ServeHTTP(w, csrf.UnsafeSkipCheck(controller.WithUser(r, u)))
+	})
+}
+
+// csrfCookie is the cookie of CSRF tokens, which is the default of
+// gorilla/csrf.
+const csrfCookie = "_gorilla_csrf"
+
+// csrfMaxAge is how long CSRF tokens are valid in seconds.
+const csrfMaxAge = 12 * 60 * 60
+
+// ProtectCSRF checks CSRF tokens signed by the first of keys. Tokens signed
+// by the other keys, which are old ones before rotation, are signed again by
+// the first key, so that forms rendered before rotation are still accepted.
+// When you serve on TLS, make secure true.
+func ProtectCSRF(keys [][]byte, secure bool, h http.Handler) http.Handler {
+	protect := csrf.Protect(keys[0], csrf.Secure(secure), csrf.Path("/"), csrf.MaxAge(csrfMaxAge))(h)
+	if len(keys) == 1 {
+		return protect
+	}
+	codecs := make([]*securecookie.SecureCookie, len(keys))
+	for i, k := range keys {
+		// the same as the codec of gorilla/csrf.
+		codecs[i] = securecookie.New(k, nil).MaxAge(csrfMaxAge)
+		codecs[i].SetSerializer(securecookie.JSONEncoder{})
 	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(csrfCookie)
+		var token []byte
+		if err != nil || codecs[0].Decode(csrfCookie, c.Value, &token) == nil {
+			protect.ServeHTTP(w, r)
+			return
+		}
+		for _, old := range codecs[1:] {
+			if old.Decode(csrfCookie, c.Value, &token) != nil {
+				continue
+			}
+			v, err := codecs[0].Encode(csrfCookie, token)
+			if err != nil {
+				break
+			}
+			r = withCookie(r, csrfCookie, v)
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookie,
+				Value:    v,
+				Path:     "/",
+				MaxAge:   csrfMaxAge,
+				HttpOnly: true,
+				Secure:   secure,
+			})
+			break
+		}
+		protect.ServeHTTP(w, r)
+	})
+}
+
+// withCookie returns a copy of the request whose cookie of the name has the
+// value.
+func withCookie(r *http.Request, name, value string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.Header = make(http.Header)
+	for k, v := range r.Header {
+		if k != "Cookie" {
+			r2.Header[k] = v
+		}
+	}
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			c.Value = value
+		}
+		r2.AddCookie(c)
+	}
+	return r2
+}
+
+// bearerToken returns the token given by Authorization header.
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(auth[len(prefix):])
 }
 
 func m(method string, h handler) handler {
@@ -42,18 +265,49 @@ func m(method string, h handler) handler {
 		if r.Method != method {
 			return &httputil.HTTPError{Status: http.StatusMethodNotAllowed}
 		}
-		h.ServeHTTP(w, r)
-		return nil
+		return h(w, r)
 	}
 }
 
 func GET(h handler) handler  { return m("GET", h) }
 func POST(h handler) handler { return m("POST", h) }
 
+// byMethod dispatches the request to the handler for its method.
+func byMethod(hs map[string]handler) handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		h, ok := hs[r.Method]
+		if !ok {
+			return &httputil.HTTPError{Status: http.StatusMethodNotAllowed}
+		}
+		return h(w, r)
+	}
+}
+
+// Limits of request bodies. Most forms are small, but articles are saved
+// with their whole body.
+const (
+	maxFormBytes    = 2048
+	maxArticleBytes = 1 << 20
+)
+
 type handler func(w http.ResponseWriter, r *http.Request) error
 
 func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	runHandler(w, r, h, handleError)
+	runHandler(w, r, h, handleError, maxFormBytes)
+}
+
+// articleHandler is handler which accepts bodies as large as articles.
+type articleHandler func(w http.ResponseWriter, r *http.Request) error
+
+func (h articleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	runHandler(w, r, h, handleError, maxArticleBytes)
+}
+
+// apiHandler is handler for API. Errors are responded as JSON.
+type apiHandler func(w http.ResponseWriter, r *http.Request) error
+
+func (h apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	runHandler(w, r, h, handleJSONError, maxArticleBytes)
 }
 
 type errFn func(w http.ResponseWriter, r *http.Request, status int, err error)
@@ -71,7 +325,7 @@ func logError(req *http.Request, err error, rv interface{}) {
 }
 
 func runHandler(w http.ResponseWriter, r *http.Request,
-	fn func(w http.ResponseWriter, r *http.Request) error, errfn errFn) {
+	fn func(w http.ResponseWriter, r *http.Request) error, errfn errFn, maxBytes int64) {
 	defer func() {
 		if rv := recover(); rv != nil {
 			err := errors.New("handler panic")
@@ -80,7 +334,7 @@ func runHandler(w http.ResponseWriter, r *http.Request,
 		}
 	}()
 
-	r.Body = http.MaxBytesReader(w, r.Body, 2048)
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
 	r.ParseForm()
 	var buf httputil.ResponseBuffer
 	err := fn(&buf, r)
@@ -98,8 +352,11 @@ func runHandler(w http.ResponseWriter, r *http.Request,
 }
 
 func errorText(err error) string {
-	if err == errUnauthrized {
+	switch err {
+	case errUnauthrized:
 		return "You are unauthorized."
+	case errForbidden:
+		return "You are not allowed to do this."
 	}
 	return "Internal Server error."
 }
@@ -109,3 +366,11 @@ func handleError(w http.ResponseWriter, r *http.Request, status int, err error)
 	w.WriteHeader(status)
 	io.WriteString(w, errorText(err))
 }
+
+func handleJSONError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(httputil.NewErrorResponse(status, err)); err != nil {
+		log.Printf("write error response failed: %s", err)
+	}
+}
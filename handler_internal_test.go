@@ -0,0 +1,33 @@
+package wiki
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIHandlerLargeBody(t *testing.T) {
+	body := strings.Repeat("a", 16*1024)
+	var got int
+	h := apiHandler(func(w http.ResponseWriter, r *http.Request) error {
+		b, err := ioutil.ReadAll(r.Body)
+		got = len(b)
+		return err
+	})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/articles", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Errorf("want %d, got %d", http.StatusOK, w.Code)
+	}
+	if got != len(body) {
+		t.Errorf("want %d bytes read, got %d", len(body), got)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/articles", strings.NewReader(strings.Repeat("a", maxArticleBytes+1))))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("bodies over the limit should be rejected, got %d", w.Code)
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/gorilla/csrf"
 	"github.com/suzuken/wiki"
+	"github.com/suzuken/wiki/controller"
+	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/sessions"
 )
 
 func TestGETHandler(t *testing.T) {
@@ -43,3 +47,171 @@ func TestPOSTHandler(t *testing.T) {
 		t.Errorf("want %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
 	}
 }
+
+func TestTokenAuth(t *testing.T) {
+	store := model.NewMemoryStore()
+	u := &model.User{Name: "bot", Email: "bot@example.com"}
+	if err := store.InsertUser(u, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	token, err := model.NewAccessTokenString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InsertAccessToken(&model.AccessToken{UserID: u.ID, Name: "test", Hash: model.HashAccessToken(token)}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := wiki.POST(wiki.Auth(func(w http.ResponseWriter, r *http.Request) error {
+		if id := controller.CurrentUserID(r); id != u.ID {
+			t.Errorf("want user %d, got %d", u.ID, id)
+		}
+		return nil
+	}))
+	CSRF := csrf.Protect([]byte("32-byte-long-auth-key-for-tests!"), csrf.Secure(false))
+	ts := httptest.NewServer(wiki.TokenAuth(store, CSRF(h)))
+	defer ts.Close()
+
+	tests := []struct {
+		auth   string
+		status int
+	}{
+		{"Bearer " + token, http.StatusOK},
+		{"Bearer wrong", http.StatusUnauthorized},
+		// without token, CSRF protection works as usual.
+		{"", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest("POST", ts.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST failed: %s", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%q: want %d, got %d", tt.auth, tt.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) error {
+		return nil
+	}
+	tests := []struct {
+		role   string
+		perm   model.Permission
+		status int
+	}{
+		{"", model.PermEdit, http.StatusUnauthorized},
+		{model.RoleViewer, model.PermEdit, http.StatusForbidden},
+		{model.RoleEditor, model.PermEdit, http.StatusOK},
+		{model.RoleEditor, model.PermDelete, http.StatusForbidden},
+		{model.RoleAdmin, model.PermDelete, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/", nil)
+		if tt.role != "" {
+			req = controller.WithUser(req, model.User{ID: 1, Role: tt.role, EmailVerified: true})
+		}
+		rec := httptest.NewRecorder()
+		wiki.Require(tt.perm, h).ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%q for %s: want %d, got %d", tt.role, tt.perm, tt.status, rec.Code)
+		}
+	}
+}
+
+func TestAuthGroups(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) error {
+		return nil
+	}
+	tests := []struct {
+		groups []model.Group
+		status int
+	}{
+		{nil, http.StatusForbidden},
+		{[]model.Group{{ID: 1, Name: "dev"}}, http.StatusForbidden},
+		{[]model.Group{{ID: 1, Name: "dev"}, {ID: 2, Name: "ops"}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := controller.WithUser(httptest.NewRequest("GET", "/", nil), model.User{ID: 1})
+		req = controller.WithGroups(req, tt.groups)
+		rec := httptest.NewRecorder()
+		wiki.Auth(h, "ops", "infra").ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%+v: want %d, got %d", tt.groups, tt.status, rec.Code)
+		}
+	}
+}
+
+func TestProtectCSRFRotation(t *testing.T) {
+	oldKey := []byte("0123456789abcdef0123456789abcdef")
+	newKey := []byte("fedcba9876543210fedcba9876543210")
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(csrf.Token(r)))
+	})
+
+	// a form rendered before rotation.
+	w := httptest.NewRecorder()
+	wiki.ProtectCSRF([][]byte{oldKey}, false, h).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	token := w.Body.String()
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("want CSRF cookie, got %v", cookies)
+	}
+	post := func(keys [][]byte, c *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("X-CSRF-Token", token)
+		r.AddCookie(c)
+		w := httptest.NewRecorder()
+		wiki.ProtectCSRF(keys, false, h).ServeHTTP(w, r)
+		return w
+	}
+
+	w = post([][]byte{newKey, oldKey}, cookies[0])
+	if w.Code != http.StatusOK {
+		t.Fatalf("token signed by old key should be accepted, got %d", w.Code)
+	}
+	resigned := w.Result().Cookies()
+	if len(resigned) != 1 || resigned[0].Value == cookies[0].Value {
+		t.Fatalf("want cookie signed by new key, got %v", resigned)
+	}
+	if w := post([][]byte{newKey}, resigned[0]); w.Code != http.StatusOK {
+		t.Errorf("token signed again should be accepted, got %d", w.Code)
+	}
+	if w := post([][]byte{newKey}, cookies[0]); w.Code != http.StatusForbidden {
+		t.Errorf("token signed by removed key should be rejected, got %d", w.Code)
+	}
+}
+
+func TestAuthDeletedUser(t *testing.T) {
+	store := model.NewMemoryStore()
+	h := wiki.LoadUser(store, store, wiki.Auth(func(w http.ResponseWriter, r *http.Request) error {
+		return nil
+	}))
+
+	// the session of the user who has been deleted since logging in.
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	sess, _ := sessions.Get(req, "user")
+	sess.Values["id"] = int64(5)
+	if err := sessions.Save(req, w, sess); err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("want %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
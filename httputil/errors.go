@@ -1,6 +1,9 @@
 package httputil
 
-import "fmt"
+import (
+	"fmt"
+	"net/http"
+)
 
 type HTTPError struct {
 	Status int
@@ -13,3 +16,26 @@ func (err *HTTPError) Error() string {
 	}
 	return fmt.Sprintf("Status %d", err.Status)
 }
+
+// ErrorResponse is the JSON envelope of errors for API clients.
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// ErrorBody describes the error in ErrorResponse.
+// Detail is given only for errors caused by clients.
+type ErrorBody struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// NewErrorResponse makes the error envelope for status and err.
+// Reasons of server errors are not exposed to clients.
+func NewErrorResponse(status int, err error) ErrorResponse {
+	body := ErrorBody{Status: status, Message: http.StatusText(status)}
+	if err != nil && status >= 400 && status < 500 {
+		body.Detail = err.Error()
+	}
+	return ErrorResponse{Error: body}
+}
@@ -0,0 +1,221 @@
+// Package ldapauth authenticates users of the wiki by an LDAP directory.
+//
+// Passwords are checked by binding to the directory as the user. Users are
+// created in the wiki on their first login, keyed by their DNs, with names
+// and email addresses taken from attributes of their entries.
+package ldapauth
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+	"github.com/suzuken/wiki/model"
+)
+
+// ErrNoEmail is returned when the entry of the user has no email address.
+var ErrNoEmail = errors.New("ldapauth: no email address in the entry")
+
+// Config is configuration of an LDAP directory.
+type Config struct {
+	// URL is like ldaps://ldap.example.com or ldap://ldap.example.com:389.
+	URL string `yaml:"url"`
+	// StartTLS upgrades ldap:// connections to TLS.
+	StartTLS bool `yaml:"start_tls"`
+	// BaseDN is where users are searched, like ou=people,dc=example,dc=com.
+	BaseDN string `yaml:"base_dn"`
+	// Filter finds the entry of the login name given by %s.
+	// Default is (mail=%s).
+	Filter string `yaml:"filter"`
+	// UserDN is the DN of the login name given by %s, like
+	// uid=%s,ou=people,dc=example,dc=com. If set, users are bound directly
+	// and search their entries by themselves. Otherwise entries are searched
+	// as BindDN, or anonymously if BindDN is empty, and then users are bound
+	// by the DNs found.
+	UserDN string `yaml:"user_dn"`
+	// BindDN is the DN of the account to search users, whose password is
+	// read from the environment variable named by BindPasswordEnv.
+	BindDN          string `yaml:"bind_dn"`
+	BindPasswordEnv string `yaml:"bind_password_env"`
+	// NameAttr and EmailAttr are attributes of names and email addresses
+	// of users. Defaults are cn and mail.
+	NameAttr  string `yaml:"name_attr"`
+	EmailAttr string `yaml:"email_attr"`
+}
+
+// Conn is a connection to the directory.
+// *ldap.Conn implements it.
+type Conn interface {
+	Bind(username, password string) error
+	Search(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// Authenticator authenticates users by the directory.
+type Authenticator struct {
+	config     Config
+	users      model.UserStore
+	identities model.IdentityStore
+
+	// dial is replaceable for testing.
+	dial func() (Conn, error)
+}
+
+// New returns an authenticator of the directory, which creates users in the
+// stores on their first login.
+func New(c Config, users model.UserStore, identities model.IdentityStore) (*Authenticator, error) {
+	if c.URL == "" || c.BaseDN == "" {
+		return nil, errors.New("ldapauth: url and base_dn are required")
+	}
+	if c.Filter == "" {
+		c.Filter = "(mail=%s)"
+	}
+	if c.NameAttr == "" {
+		c.NameAttr = "cn"
+	}
+	if c.EmailAttr == "" {
+		c.EmailAttr = "mail"
+	}
+	a := &Authenticator{config: c, users: users, identities: identities}
+	a.dial = a.dialURL
+	return a, nil
+}
+
+// dialURL connects to the directory of the configuration.
+func (a *Authenticator) dialURL() (Conn, error) {
+	conn, err := ldap.DialURL(a.config.URL)
+	if err != nil {
+		return nil, err
+	}
+	if a.config.StartTLS {
+		u, err := url.Parse(a.config.URL)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname()}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// entry is the entry of a user in the directory.
+type entry struct {
+	DN    string
+	Name  string
+	Email string
+}
+
+// Authenticate implements model.Authenticator.
+func (a *Authenticator) Authenticate(login, password string) (model.User, error) {
+	// the directory may take binds without passwords as anonymous ones.
+	if login == "" || password == "" {
+		return model.User{}, model.ErrPasswordUnmatch
+	}
+	e, err := a.bind(login, password)
+	if err != nil {
+		return model.User{}, err
+	}
+	return a.user(e)
+}
+
+// bind checks the password of the user by binding as the user, and returns
+// the entry of the user.
+func (a *Authenticator) bind(login, password string) (entry, error) {
+	conn, err := a.dial()
+	if err != nil {
+		return entry{}, err
+	}
+	defer conn.Close()
+
+	if a.config.UserDN != "" {
+		dn := fmt.Sprintf(a.config.UserDN, ldap.EscapeDN(login))
+		if err := conn.Bind(dn, password); err != nil {
+			return entry{}, bindError(err)
+		}
+		return a.search(conn, login)
+	}
+	if a.config.BindDN != "" {
+		if err := conn.Bind(a.config.BindDN, os.Getenv(a.config.BindPasswordEnv)); err != nil {
+			return entry{}, err
+		}
+	}
+	e, err := a.search(conn, login)
+	if err != nil {
+		return entry{}, err
+	}
+	if err := conn.Bind(e.DN, password); err != nil {
+		return entry{}, bindError(err)
+	}
+	return e, nil
+}
+
+// bindError makes invalid credentials into ErrPasswordUnmatch.
+func bindError(err error) error {
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return model.ErrPasswordUnmatch
+	}
+	return err
+}
+
+// search returns the only entry of the login name. Users not found, or
+// found more than one, are model.ErrNotFound.
+func (a *Authenticator) search(conn Conn, login string) (entry, error) {
+	res, err := conn.Search(ldap.NewSearchRequest(
+		a.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(a.config.Filter, ldap.EscapeFilter(login)),
+		[]string{a.config.NameAttr, a.config.EmailAttr},
+		nil,
+	))
+	// the login name matches more than one entry.
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return entry{}, model.ErrNotFound
+	}
+	if err != nil {
+		return entry{}, err
+	}
+	if len(res.Entries) != 1 {
+		return entry{}, model.ErrNotFound
+	}
+	e := res.Entries[0]
+	return entry{
+		DN:    e.DN,
+		Name:  e.GetAttributeValue(a.config.NameAttr),
+		Email: e.GetAttributeValue(a.config.EmailAttr),
+	}, nil
+}
+
+// user returns the user of the entry, who is linked to the local user of
+// the same email address or created on first login.
+func (a *Authenticator) user(e entry) (model.User, error) {
+	u, err := a.identities.UserByIdentity(a.config.URL, e.DN)
+	if errors.Cause(err) != model.ErrNotFound {
+		return u, err
+	}
+	if e.Email == "" {
+		return model.User{}, ErrNoEmail
+	}
+	identity := &model.Identity{Issuer: a.config.URL, Subject: e.DN}
+	u, err = a.users.UserByEmail(e.Email)
+	switch {
+	case err == nil:
+		identity.UserID = u.ID
+		return u, a.identities.InsertIdentity(identity)
+	case errors.Cause(err) != model.ErrNotFound:
+		return model.User{}, err
+	}
+	u = model.User{Name: e.Name, Email: e.Email, EmailVerified: true}
+	if u.Name == "" {
+		u.Name = e.Email
+	}
+	if err := a.identities.ProvisionUser(&u, identity); err != nil {
+		return model.User{}, err
+	}
+	return u, nil
+}
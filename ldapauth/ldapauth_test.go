@@ -0,0 +1,129 @@
+package ldapauth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/suzuken/wiki/model"
+)
+
+// fakeConn is a directory of entries keyed by DNs.
+type fakeConn struct {
+	entries   map[string]map[string]string
+	passwords map[string]string
+	bound     string
+}
+
+func (c *fakeConn) Bind(dn, password string) error {
+	if p, ok := c.passwords[dn]; !ok || p != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, nil)
+	}
+	c.bound = dn
+	return nil
+}
+
+// Search supports only filters of an attribute like (mail=alice@example.com).
+func (c *fakeConn) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	f := strings.SplitN(strings.Trim(req.Filter, "()"), "=", 2)
+	res := &ldap.SearchResult{}
+	for dn, attrs := range c.entries {
+		if !strings.HasSuffix(dn, req.BaseDN) || attrs[f[0]] != f[1] {
+			continue
+		}
+		e := &ldap.Entry{DN: dn}
+		for _, a := range req.Attributes {
+			e.Attributes = append(e.Attributes, ldap.NewEntryAttribute(a, []string{attrs[a]}))
+		}
+		res.Entries = append(res.Entries, e)
+	}
+	return res, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{
+		entries: map[string]map[string]string{
+			"uid=alice,ou=people,dc=example,dc=com": {"uid": "alice", "cn": "Alice", "mail": "alice@example.com"},
+			"uid=bob,ou=people,dc=example,dc=com":   {"uid": "bob", "cn": "Bob", "mail": "bob@example.com"},
+		},
+		passwords: map[string]string{
+			"uid=alice,ou=people,dc=example,dc=com": "alice-password",
+			"uid=bob,ou=people,dc=example,dc=com":   "bob-password",
+		},
+	}
+}
+
+func newTestAuthenticator(t *testing.T, c Config, store model.Store) *Authenticator {
+	a, err := New(c, store, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := newFakeConn()
+	a.dial = func() (Conn, error) { return conn, nil }
+	return a
+}
+
+func TestAuthenticate(t *testing.T) {
+	configs := map[string]Config{
+		"search": {URL: "ldap://ldap.example.com", BaseDN: "ou=people,dc=example,dc=com"},
+		"user_dn": {
+			URL:    "ldap://ldap.example.com",
+			BaseDN: "ou=people,dc=example,dc=com",
+			Filter: "(uid=%s)",
+			UserDN: "uid=%s,ou=people,dc=example,dc=com",
+		},
+	}
+	logins := map[string]string{"search": "alice@example.com", "user_dn": "alice"}
+	for name, c := range configs {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAuthenticator(t, c, model.NewMemoryStore())
+			login := logins[name]
+
+			u, err := a.Authenticate(login, "alice-password")
+			if err != nil {
+				t.Fatalf("authenticate failed: %s", err)
+			}
+			if u.ID == 0 || u.Name != "Alice" || u.Email != "alice@example.com" || !u.EmailVerified {
+				t.Errorf("unexpected user: %+v", u)
+			}
+			again, err := a.Authenticate(login, "alice-password")
+			if err != nil {
+				t.Fatalf("authenticate again failed: %s", err)
+			}
+			if again.ID != u.ID {
+				t.Errorf("want user %d on next login, got %d", u.ID, again.ID)
+			}
+
+			for _, password := range []string{"wrong", "bob-password", ""} {
+				if _, err := a.Authenticate(login, password); err != model.ErrPasswordUnmatch {
+					t.Errorf("password %q: want ErrPasswordUnmatch, got %v", password, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthenticateUnknown(t *testing.T) {
+	a := newTestAuthenticator(t, Config{URL: "ldap://ldap.example.com", BaseDN: "dc=example,dc=com"}, model.NewMemoryStore())
+	if _, err := a.Authenticate("carol@example.com", "carol-password"); err != model.ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+}
+
+func TestAuthenticateLinksLocalUser(t *testing.T) {
+	store := model.NewMemoryStore()
+	local := &model.User{Name: "alice", Email: "alice@example.com"}
+	if err := store.InsertUser(local, "local-password"); err != nil {
+		t.Fatal(err)
+	}
+	a := newTestAuthenticator(t, Config{URL: "ldap://ldap.example.com", BaseDN: "dc=example,dc=com"}, store)
+	u, err := a.Authenticate("alice@example.com", "alice-password")
+	if err != nil {
+		t.Fatalf("authenticate failed: %s", err)
+	}
+	if u.ID != local.ID {
+		t.Errorf("want local user %d, got %d", local.ID, u.ID)
+	}
+}
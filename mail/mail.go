@@ -0,0 +1,102 @@
+// Package mail sends emails to users.
+//
+// Mailer is implemented by SMTP for production, and by Log, which writes
+// messages instead of sending them, for local development and tests.
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidHeader is returned when the address or the subject contains
+// line breaks, which could inject headers.
+var ErrInvalidHeader = errors.New("mail: invalid header")
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages.
+type Mailer interface {
+	Send(m Message) error
+}
+
+// validate checks headers of the message.
+func (m Message) validate() error {
+	if m.To == "" || strings.ContainsAny(m.To+m.Subject, "\r\n") {
+		return ErrInvalidHeader
+	}
+	return nil
+}
+
+// format returns the message in RFC 5322 format sent from from.
+func (m Message) format(from string, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	body := strings.Replace(m.Body, "\r\n", "\n", -1)
+	b.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	return b.Bytes()
+}
+
+// SMTP sends messages via SMTP server.
+type SMTP struct {
+	// Addr is host:port of the server.
+	Addr string
+	// From is the sender address.
+	From string
+	// Auth is used if not nil, such as smtp.PlainAuth.
+	Auth smtp.Auth
+}
+
+// Send sends the message.
+func (s *SMTP) Send(m Message) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	return smtp.SendMail(s.Addr, s.Auth, s.From, []string{m.To}, m.format(s.From, time.Now()))
+}
+
+// Log writes messages to the writer instead of sending them.
+// It is safe for concurrent use.
+type Log struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+// NewLog returns a mailer writing messages to w, such as os.Stderr or
+// a file, as if they are sent from from.
+func NewLog(w io.Writer, from string) *Log {
+	return &Log{w: w, from: from}
+}
+
+// Send writes the message followed by a separator line.
+func (l *Log) Send(m Message) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(m.format(l.from, time.Now())); err != nil {
+		return err
+	}
+	_, err := io.WriteString(l.w, "\r\n.\r\n")
+	return err
+}
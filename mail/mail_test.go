@@ -0,0 +1,44 @@
+package mail
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	var b bytes.Buffer
+	l := NewLog(&b, "wiki@example.com")
+	m := Message{To: "alice@example.com", Subject: "パスワード", Body: "line1\nline2"}
+	if err := l.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	s := b.String()
+	for _, want := range []string{
+		"From: wiki@example.com\r\n",
+		"To: alice@example.com\r\n",
+		"Subject: =?utf-8?q?",
+		"\r\n\r\nline1\r\nline2\r\n.\r\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("%q is not in %q", want, s)
+		}
+	}
+}
+
+func TestInvalidHeader(t *testing.T) {
+	var b bytes.Buffer
+	l := NewLog(&b, "wiki@example.com")
+	for _, m := range []Message{
+		{To: ""},
+		{To: "alice@example.com\r\nBcc: eve@example.com"},
+		{To: "alice@example.com", Subject: "hi\nBcc: eve@example.com"},
+	} {
+		if err := l.Send(m); err != ErrInvalidHeader {
+			t.Errorf("%+v: want ErrInvalidHeader, got %v", m, err)
+		}
+	}
+	if b.Len() != 0 {
+		t.Errorf("invalid messages are written: %q", b.String())
+	}
+}
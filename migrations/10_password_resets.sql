@@ -0,0 +1,15 @@
+-- +migrate Up
+CREATE TABLE `password_resets` (
+  `reset_id` int(11) NOT NULL AUTO_INCREMENT COMMENT 'ID',
+  `user_id` int(11) NOT NULL COMMENT 'whose password is reset',
+  `token_hash` char(64) NOT NULL COMMENT 'hex encoded SHA-256 of the token',
+  `expires` datetime NOT NULL COMMENT 'when the token expires',
+  `used` datetime NULL DEFAULT NULL COMMENT 'when the token was used',
+  `created` timestamp NOT NULL DEFAULT NOW() COMMENT 'when created',
+  PRIMARY KEY (`reset_id`),
+  UNIQUE KEY (`token_hash`),
+  KEY (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=utf8 COMMENT='one-time tokens for resetting passwords';
+
+-- +migrate Down
+DROP TABLE password_resets;
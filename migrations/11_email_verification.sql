@@ -0,0 +1,23 @@
+-- +migrate Up
+ALTER TABLE `users`
+  ADD COLUMN `email_verified` tinyint(1) NOT NULL DEFAULT 0 COMMENT 'whether the email address is verified';
+
+-- users signed up before verification are trusted.
+UPDATE `users` SET `email_verified` = 1;
+
+CREATE TABLE `email_verifications` (
+  `verification_id` int(11) NOT NULL AUTO_INCREMENT COMMENT 'ID',
+  `user_id` int(11) NOT NULL COMMENT 'whose email address is verified',
+  `email` varchar(255) NOT NULL COMMENT 'the address the token is sent to',
+  `token_hash` char(64) NOT NULL COMMENT 'hex encoded SHA-256 of the token',
+  `expires` datetime NOT NULL COMMENT 'when the token expires',
+  `used` datetime NULL DEFAULT NULL COMMENT 'when the token was used',
+  `created` timestamp NOT NULL DEFAULT NOW() COMMENT 'when created',
+  PRIMARY KEY (`verification_id`),
+  UNIQUE KEY (`token_hash`),
+  KEY (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=utf8 COMMENT='one-time tokens for verifying email addresses';
+
+-- +migrate Down
+DROP TABLE email_verifications;
+ALTER TABLE `users` DROP COLUMN `email_verified`;
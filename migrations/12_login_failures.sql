@@ -0,0 +1,10 @@
+-- +migrate Up
+CREATE TABLE `login_failures` (
+  `failure_key` varchar(255) NOT NULL COMMENT 'what failed, such as account:{email} or ip:{address}',
+  `failures` int(11) NOT NULL DEFAULT 0 COMMENT 'number of failures',
+  `last_failed` datetime NOT NULL COMMENT 'when the last failure happened',
+  PRIMARY KEY (`failure_key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='failed login attempts for rate limiting';
+
+-- +migrate Down
+DROP TABLE login_failures;
@@ -0,0 +1,26 @@
+-- +migrate Up
+ALTER TABLE `users`
+  ADD COLUMN `totp_secret` varchar(64) NOT NULL DEFAULT '' COMMENT 'base32 encoded TOTP secret, set on enrollment',
+  ADD COLUMN `mfa_enabled` tinyint(1) NOT NULL DEFAULT 0 COMMENT 'whether TOTP is confirmed and required on login',
+  ADD COLUMN `totp_counter` bigint NOT NULL DEFAULT 0 COMMENT 'time step of the last TOTP code used, to reject replays';
+
+CREATE TABLE `recovery_codes` (
+  `code_id` int(11) NOT NULL AUTO_INCREMENT COMMENT 'ID',
+  `user_id` int(11) NOT NULL COMMENT 'owner of the code',
+  `code_hash` char(64) NOT NULL COMMENT 'hex encoded SHA-256 of the code',
+  `used` datetime NULL DEFAULT NULL COMMENT 'when the code was used',
+  `created` timestamp NOT NULL DEFAULT NOW() COMMENT 'when created',
+  PRIMARY KEY (`code_id`),
+  KEY (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=utf8 COMMENT='single-use recovery codes for two-factor authentication';
+
+CREATE TABLE `settings` (
+  `name` varchar(64) NOT NULL COMMENT 'name of the setting',
+  `value` varchar(255) NOT NULL COMMENT 'value of the setting',
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='site-wide settings changed by admins';
+
+-- +migrate Down
+DROP TABLE settings;
+DROP TABLE recovery_codes;
+ALTER TABLE `users` DROP COLUMN `totp_counter`, DROP COLUMN `mfa_enabled`, DROP COLUMN `totp_secret`;
@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE `user_identities` (
+  `identity_id` int(11) NOT NULL AUTO_INCREMENT COMMENT 'ID',
+  `user_id` int(11) NOT NULL COMMENT 'the user logging in by the identity',
+  `issuer` varchar(255) NOT NULL COMMENT 'issuer URL of the OpenID Connect provider',
+  `subject` varchar(255) NOT NULL COMMENT 'sub claim identifying the user at the provider',
+  `created` timestamp NOT NULL DEFAULT NOW() COMMENT 'when created',
+  PRIMARY KEY (`identity_id`),
+  UNIQUE KEY (`issuer`, `subject`),
+  KEY (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=utf8 COMMENT='identities of users at OpenID Connect providers';
+
+-- +migrate Down
+DROP TABLE user_identities;
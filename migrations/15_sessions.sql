@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE TABLE `sessions` (
+  `session_id` char(64) NOT NULL COMMENT 'SHA-256 of the token in the cookie',
+  `user_id` int(11) NOT NULL DEFAULT 0 COMMENT 'the user logged in by the session, or 0',
+  `session_values` blob NOT NULL COMMENT 'values of the session encoded by gob',
+  `user_agent` varchar(255) NOT NULL DEFAULT '' COMMENT 'User-Agent of the client last seen',
+  `ip` varchar(45) NOT NULL DEFAULT '' COMMENT 'IP address of the client last seen',
+  `created` datetime NOT NULL COMMENT 'when created',
+  `last_seen` datetime NOT NULL COMMENT 'when the session is used last',
+  `expires` datetime NOT NULL COMMENT 'when the session expires',
+  PRIMARY KEY (`session_id`),
+  KEY (`user_id`),
+  KEY (`expires`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='sessions of users kept on the server';
+
+-- +migrate Down
+DROP TABLE sessions;
@@ -0,0 +1,19 @@
+-- +migrate Up
+CREATE TABLE `article_revisions` (
+  `revision_id` int(11) NOT NULL AUTO_INCREMENT COMMENT 'ID',
+  `article_id` int(11) NOT NULL COMMENT 'revised article',
+  `revision` int(11) NOT NULL COMMENT 'revision number in the article',
+  `title` varchar(256) NOT NULL COMMENT 'title at this revision',
+  `body` TEXT COMMENT 'article body at this revision',
+  `user_id` int(11) NOT NULL DEFAULT 0 COMMENT 'who made this revision',
+  `created` timestamp NOT NULL DEFAULT NOW() COMMENT 'when created',
+  PRIMARY KEY (`revision_id`),
+  UNIQUE KEY (`article_id`, `revision`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=utf8 COMMENT='history of articles';
+
+-- existing articles start their history from the current content.
+INSERT INTO `article_revisions` (`article_id`, `revision`, `title`, `body`, `created`)
+  SELECT `article_id`, 1, `title`, `body`, `updated` FROM `articles`;
+
+-- +migrate Down
+DROP TABLE article_revisions;
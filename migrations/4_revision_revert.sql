@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE `article_revisions`
+  ADD COLUMN `reverted_from` int(11) NOT NULL DEFAULT 0 COMMENT 'revision restored by this revision, 0 if not a revert';
+
+-- +migrate Down
+ALTER TABLE `article_revisions` DROP COLUMN `reverted_from`;
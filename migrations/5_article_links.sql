@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE `article_links` (
+  `link_id` int(11) NOT NULL AUTO_INCREMENT COMMENT 'ID',
+  `from_article_id` int(11) NOT NULL COMMENT 'linking article',
+  `to_article_id` int(11) NOT NULL DEFAULT 0 COMMENT 'article linked by /article/{id}, 0 if linked by title',
+  `to_title` varchar(256) NOT NULL DEFAULT '' COMMENT 'title linked by [[Title]], empty if linked by id',
+  PRIMARY KEY (`link_id`),
+  KEY (`from_article_id`),
+  KEY (`to_article_id`),
+  KEY (`to_title`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=utf8 COMMENT='links between articles';
+
+-- +migrate Down
+DROP TABLE article_links;
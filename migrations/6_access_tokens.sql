@@ -0,0 +1,15 @@
+-- +migrate Up
+CREATE TABLE `access_tokens` (
+  `token_id` int(11) NOT NULL AUTO_INCREMENT COMMENT 'ID',
+  `user_id` int(11) NOT NULL COMMENT 'owner of the token',
+  `name` varchar(255) NOT NULL COMMENT 'note for what the token is used',
+  `token_hash` char(64) NOT NULL COMMENT 'hex encoded SHA-256 of the token',
+  `created` timestamp NOT NULL DEFAULT NOW() COMMENT 'when created',
+  `last_used` timestamp NULL DEFAULT NULL COMMENT 'when last used',
+  PRIMARY KEY (`token_id`),
+  UNIQUE KEY (`token_hash`),
+  KEY (`user_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=utf8 COMMENT='personal access tokens for API';
+
+-- +migrate Down
+DROP TABLE access_tokens;
@@ -0,0 +1,17 @@
+-- +migrate Up
+ALTER TABLE `articles`
+  ADD COLUMN `author_id` int(11) NOT NULL DEFAULT 0 COMMENT 'user who created, 0 if unknown',
+  ADD COLUMN `last_editor_id` int(11) NOT NULL DEFAULT 0 COMMENT 'user who edited last, 0 if unknown',
+  ADD KEY (`author_id`);
+
+-- existing articles are attributed by their revisions.
+UPDATE `articles` a
+  JOIN `article_revisions` r ON r.article_id = a.article_id AND r.revision = 1
+  SET a.author_id = r.user_id;
+UPDATE `articles` a
+  JOIN (SELECT article_id, MAX(revision) AS revision FROM `article_revisions` GROUP BY article_id) l ON l.article_id = a.article_id
+  JOIN `article_revisions` r ON r.article_id = l.article_id AND r.revision = l.revision
+  SET a.last_editor_id = r.user_id;
+
+-- +migrate Down
+ALTER TABLE `articles` DROP COLUMN `author_id`, DROP COLUMN `last_editor_id`;
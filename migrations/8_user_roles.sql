@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE `users`
+  ADD COLUMN `role` varchar(16) NOT NULL DEFAULT 'editor' COMMENT 'one of viewer, editor and admin';
+
+-- the oldest user administrates the wiki.
+UPDATE `users` SET `role` = 'admin' ORDER BY `user_id` LIMIT 1;
+
+-- +migrate Down
+ALTER TABLE `users` DROP COLUMN `role`;
@@ -0,0 +1,33 @@
+-- +migrate Up
+CREATE TABLE `user_groups` (
+  `group_id` int(11) NOT NULL AUTO_INCREMENT COMMENT 'ID',
+  `name` varchar(255) NOT NULL COMMENT 'name of the group',
+  `created` timestamp NOT NULL DEFAULT NOW() COMMENT 'when created',
+  PRIMARY KEY (`group_id`),
+  UNIQUE KEY (`name`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8 COMMENT='groups of users';
+
+CREATE TABLE `group_members` (
+  `group_id` int(11) NOT NULL COMMENT 'group',
+  `user_id` int(11) NOT NULL COMMENT 'member of the group',
+  PRIMARY KEY (`group_id`, `user_id`),
+  KEY (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='members of groups';
+
+CREATE TABLE `article_acls` (
+  `acl_id` int(11) NOT NULL AUTO_INCREMENT COMMENT 'ID',
+  `article_id` int(11) NOT NULL DEFAULT 0 COMMENT 'article the entry applies to, or 0 for namespace',
+  `namespace` varchar(255) NOT NULL DEFAULT '' COMMENT 'prefix of titles ending with slash, such as HR/',
+  `user_id` int(11) NOT NULL DEFAULT 0 COMMENT 'user granted, or 0 for group',
+  `group_id` int(11) NOT NULL DEFAULT 0 COMMENT 'group granted, or 0 for user',
+  `permission` varchar(16) NOT NULL COMMENT 'one of read, edit and delete',
+  `created` timestamp NOT NULL DEFAULT NOW() COMMENT 'when created',
+  PRIMARY KEY (`acl_id`),
+  KEY (`article_id`),
+  KEY (`namespace`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8 COMMENT='access control lists of articles and namespaces';
+
+-- +migrate Down
+DROP TABLE article_acls;
+DROP TABLE group_members;
+DROP TABLE user_groups;
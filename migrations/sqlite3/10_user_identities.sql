@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE `user_identities` (
+  `identity_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `user_id` INTEGER NOT NULL,
+  `issuer` varchar(255) NOT NULL,
+  `subject` varchar(255) NOT NULL,
+  `created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (`issuer`, `subject`)
+);
+CREATE INDEX `user_identities_user` ON `user_identities` (`user_id`);
+
+-- +migrate Down
+DROP TABLE user_identities;
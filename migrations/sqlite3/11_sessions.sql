@@ -0,0 +1,16 @@
+-- +migrate Up
+CREATE TABLE `sessions` (
+  `session_id` char(64) NOT NULL PRIMARY KEY,
+  `user_id` INTEGER NOT NULL DEFAULT 0,
+  `session_values` blob NOT NULL,
+  `user_agent` varchar(255) NOT NULL DEFAULT '',
+  `ip` varchar(45) NOT NULL DEFAULT '',
+  `created` datetime NOT NULL,
+  `last_seen` datetime NOT NULL,
+  `expires` datetime NOT NULL
+);
+CREATE INDEX `sessions_user` ON `sessions` (`user_id`);
+CREATE INDEX `sessions_expires` ON `sessions` (`expires`);
+
+-- +migrate Down
+DROP TABLE sessions;
@@ -0,0 +1,48 @@
+-- +migrate Up
+-- SQLite schema for running the wiki without MySQL server.
+-- This corresponds to migrations 1 to 5 for MySQL.
+CREATE TABLE `articles` (
+  `article_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `title` varchar(256) NOT NULL COLLATE NOCASE,
+  `body` TEXT,
+  `created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE `users` (
+  `user_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `name` varchar(255) NOT NULL,
+  `email` varchar(255) NOT NULL COLLATE NOCASE UNIQUE,
+  `salt` varchar(255) NOT NULL,
+  `salted` varchar(255) NOT NULL,
+  `created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE `article_revisions` (
+  `revision_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `article_id` INTEGER NOT NULL,
+  `revision` INTEGER NOT NULL,
+  `title` varchar(256) NOT NULL,
+  `body` TEXT,
+  `user_id` INTEGER NOT NULL DEFAULT 0,
+  `created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `reverted_from` INTEGER NOT NULL DEFAULT 0,
+  UNIQUE (`article_id`, `revision`)
+);
+
+CREATE TABLE `article_links` (
+  `link_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `from_article_id` INTEGER NOT NULL,
+  `to_article_id` INTEGER NOT NULL DEFAULT 0,
+  `to_title` varchar(256) NOT NULL DEFAULT '' COLLATE NOCASE
+);
+CREATE INDEX `article_links_from` ON `article_links` (`from_article_id`);
+CREATE INDEX `article_links_to_id` ON `article_links` (`to_article_id`);
+CREATE INDEX `article_links_to_title` ON `article_links` (`to_title`);
+
+-- +migrate Down
+DROP TABLE article_links;
+DROP TABLE article_revisions;
+DROP TABLE users;
+DROP TABLE articles;
@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE `access_tokens` (
+  `token_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `user_id` INTEGER NOT NULL,
+  `name` varchar(255) NOT NULL,
+  `token_hash` char(64) NOT NULL UNIQUE,
+  `created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `last_used` timestamp NULL DEFAULT NULL
+);
+CREATE INDEX `access_tokens_user` ON `access_tokens` (`user_id`);
+
+-- +migrate Down
+DROP TABLE access_tokens;
@@ -0,0 +1,15 @@
+-- +migrate Up
+ALTER TABLE `articles` ADD COLUMN `author_id` INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE `articles` ADD COLUMN `last_editor_id` INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX `articles_author` ON `articles` (`author_id`);
+
+-- existing articles are attributed by their revisions.
+UPDATE `articles` SET
+  `author_id` = coalesce((SELECT r.user_id FROM `article_revisions` r
+    WHERE r.article_id = articles.article_id AND r.revision = 1), 0),
+  `last_editor_id` = coalesce((SELECT r.user_id FROM `article_revisions` r
+    WHERE r.article_id = articles.article_id ORDER BY r.revision DESC LIMIT 1), 0);
+
+-- +migrate Down
+-- SQLite before 3.35 can not drop columns.
+DROP INDEX `articles_author`;
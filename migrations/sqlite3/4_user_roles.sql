@@ -0,0 +1,8 @@
+-- +migrate Up
+ALTER TABLE `users` ADD COLUMN `role` varchar(16) NOT NULL DEFAULT 'editor';
+
+-- the oldest user administrates the wiki.
+UPDATE `users` SET `role` = 'admin' WHERE `user_id` = (SELECT min(`user_id`) FROM `users`);
+
+-- +migrate Down
+-- SQLite before 3.35 can not drop columns.
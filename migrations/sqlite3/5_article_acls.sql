@@ -0,0 +1,30 @@
+-- +migrate Up
+CREATE TABLE `user_groups` (
+  `group_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `name` varchar(255) NOT NULL UNIQUE,
+  `created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE `group_members` (
+  `group_id` INTEGER NOT NULL,
+  `user_id` INTEGER NOT NULL,
+  PRIMARY KEY (`group_id`, `user_id`)
+);
+CREATE INDEX `group_members_user` ON `group_members` (`user_id`);
+
+CREATE TABLE `article_acls` (
+  `acl_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `article_id` INTEGER NOT NULL DEFAULT 0,
+  `namespace` varchar(255) NOT NULL DEFAULT '' COLLATE NOCASE,
+  `user_id` INTEGER NOT NULL DEFAULT 0,
+  `group_id` INTEGER NOT NULL DEFAULT 0,
+  `permission` varchar(16) NOT NULL,
+  `created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX `article_acls_article` ON `article_acls` (`article_id`);
+CREATE INDEX `article_acls_namespace` ON `article_acls` (`namespace`);
+
+-- +migrate Down
+DROP TABLE article_acls;
+DROP TABLE group_members;
+DROP TABLE user_groups;
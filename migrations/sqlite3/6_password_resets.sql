@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE `password_resets` (
+  `reset_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `user_id` INTEGER NOT NULL,
+  `token_hash` char(64) NOT NULL UNIQUE,
+  `expires` datetime NOT NULL,
+  `used` datetime NULL DEFAULT NULL,
+  `created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX `password_resets_user` ON `password_resets` (`user_id`);
+
+-- +migrate Down
+DROP TABLE password_resets;
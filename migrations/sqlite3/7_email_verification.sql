@@ -0,0 +1,20 @@
+-- +migrate Up
+ALTER TABLE `users` ADD COLUMN `email_verified` boolean NOT NULL DEFAULT 0;
+
+-- users signed up before verification are trusted.
+UPDATE `users` SET `email_verified` = 1;
+
+CREATE TABLE `email_verifications` (
+  `verification_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `user_id` INTEGER NOT NULL,
+  `email` varchar(255) NOT NULL,
+  `token_hash` char(64) NOT NULL UNIQUE,
+  `expires` datetime NOT NULL,
+  `used` datetime NULL DEFAULT NULL,
+  `created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX `email_verifications_user` ON `email_verifications` (`user_id`);
+
+-- +migrate Down
+DROP TABLE email_verifications;
+-- SQLite before 3.35 can not drop columns.
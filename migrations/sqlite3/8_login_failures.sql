@@ -0,0 +1,9 @@
+-- +migrate Up
+CREATE TABLE `login_failures` (
+  `failure_key` varchar(255) NOT NULL PRIMARY KEY,
+  `failures` INTEGER NOT NULL DEFAULT 0,
+  `last_failed` datetime NOT NULL
+);
+
+-- +migrate Down
+DROP TABLE login_failures;
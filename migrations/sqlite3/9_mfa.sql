@@ -0,0 +1,23 @@
+-- +migrate Up
+ALTER TABLE `users` ADD COLUMN `totp_secret` varchar(64) NOT NULL DEFAULT '';
+ALTER TABLE `users` ADD COLUMN `mfa_enabled` boolean NOT NULL DEFAULT 0;
+ALTER TABLE `users` ADD COLUMN `totp_counter` INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE `recovery_codes` (
+  `code_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `user_id` INTEGER NOT NULL,
+  `code_hash` char(64) NOT NULL,
+  `used` datetime NULL DEFAULT NULL,
+  `created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX `recovery_codes_user` ON `recovery_codes` (`user_id`);
+
+CREATE TABLE `settings` (
+  `name` varchar(64) NOT NULL PRIMARY KEY,
+  `value` varchar(255) NOT NULL
+);
+
+-- +migrate Down
+DROP TABLE settings;
+DROP TABLE recovery_codes;
+-- SQLite before 3.35 can not drop columns.
@@ -0,0 +1,201 @@
+package model
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// PermRead is for reading articles. Everyone can read articles which
+// are not restricted by ACLs.
+const PermRead Permission = "read"
+
+// ACLPermissions lists permissions granted by ACLs from the weakest.
+// Each of them implies the weaker ones.
+var ACLPermissions = []Permission{PermRead, PermEdit, PermDelete}
+
+// aclRank returns the rank of the permission granted by ACLs, which is
+// higher for stronger permission. Other permissions have no rank.
+func aclRank(p Permission) int {
+	for i, q := range ACLPermissions {
+		if q == p {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// IsACLPermission reports whether p is one of ACLPermissions.
+func IsACLPermission(p Permission) bool {
+	return aclRank(p) > 0
+}
+
+// IsNamespace reports whether ns is a valid namespace. Namespaces are
+// prefixes of titles ending with slash, such as HR/. Articles in nested
+// namespaces like HR/Payroll/ are also in outer ones. Namespaces match
+// titles case-insensitively, so HR/ applies to hr/Payroll too.
+func IsNamespace(ns string) bool {
+	return len(ns) > 1 && strings.HasSuffix(ns, "/") && !strings.HasPrefix(ns, "/")
+}
+
+// Principal is who accesses articles.
+type Principal struct {
+	// UserID is 0 for guests.
+	UserID int64
+	// Admin can access all articles regardless of ACLs.
+	Admin bool
+}
+
+// Principal returns the principal of the user.
+func (u *User) Principal() Principal {
+	return Principal{UserID: u.ID, Admin: u.Role == RoleAdmin}
+}
+
+// Access is what ACLs allow a principal to do with an article.
+type Access struct {
+	// Restricted is true if any ACL entry applies to the article.
+	// Otherwise roles decide what users can do.
+	Restricted bool
+	// Granted is the strongest permission granted to the principal.
+	Granted Permission
+}
+
+// Allows reports whether the user can do p with the article.
+// Admins can do everything. On restricted articles, only permissions
+// granted by ACLs are allowed. On others, everyone can read them and
+// roles decide the rest. Users who have not verified their email
+// addresses can only read.
+func (a Access) Allows(u *User, p Permission) bool {
+	if u.Role == RoleAdmin {
+		return true
+	}
+	if !a.Restricted {
+		return p == PermRead || u.Can(p)
+	}
+	if p != PermRead && !u.EmailVerified {
+		return false
+	}
+	return aclRank(p) > 0 && aclRank(a.Granted) >= aclRank(p)
+}
+
+// access returns what acls, which apply to an article, allow the principal
+// who is member of groups.
+func access(p Principal, acls []ACL, groups map[int64]bool) Access {
+	a := Access{Restricted: len(acls) > 0}
+	if p.UserID == 0 {
+		return a
+	}
+	for _, acl := range acls {
+		if acl.UserID != p.UserID && !(acl.GroupID != 0 && groups[acl.GroupID]) {
+			continue
+		}
+		if aclRank(acl.Permission) > aclRank(a.Granted) {
+			a.Granted = acl.Permission
+		}
+	}
+	return a
+}
+
+// appliesTo reports whether the entry applies to the article.
+func (t *ACL) appliesTo(a Article) bool {
+	if t.ArticleID != 0 {
+		return t.ArticleID == a.ID
+	}
+	return strings.HasPrefix(strings.ToLower(a.Title), strings.ToLower(t.Namespace))
+}
+
+// readable returns SQL condition that articles aliased as a are readable
+// by the principal, and arguments of it. An article is readable if no
+// ACL entry applies to it, or any entry grants the principal.
+func (p Principal) readable() (string, []interface{}) {
+	if p.Admin {
+		return "1 = 1", nil
+	}
+	const applies = `(c.article_id = a.article_id or (c.article_id = 0 and instr(lower(a.title), lower(c.namespace)) = 1))`
+	// entries for groups have user_id 0, which must not match guests.
+	id := p.UserID
+	if id == 0 {
+		id = -1
+	}
+	return `(not exists (select 1 from article_acls c where ` + applies + `)
+		or exists (select 1 from article_acls c where ` + applies + `
+			and (c.user_id = ? or c.group_id in (select group_id from group_members where user_id = ?))))`,
+		[]interface{}{id, id}
+}
+
+// ACLsAll returns all ACL entries ordered by articles and namespaces.
+func ACLsAll(db *sql.DB) ([]ACL, error) {
+	rows, err := db.Query(`select * from article_acls order by article_id, namespace, acl_id`)
+	if err != nil {
+		return nil, err
+	}
+	return ScanACLs(rows)
+}
+
+// ACLsByArticle returns ACL entries which apply to the article,
+// including ones of its namespaces.
+func ACLsByArticle(db *sql.DB, a Article) ([]ACL, error) {
+	rows, err := db.Query(`
+	select * from article_acls
+		where (article_id <> 0 and article_id = ?) or (article_id = 0 and instr(lower(?), lower(namespace)) = 1)
+		order by article_id, namespace, acl_id
+	`, a.ID, a.Title)
+	if err != nil {
+		return nil, err
+	}
+	return ScanACLs(rows)
+}
+
+// ArticleAccess returns what ACLs allow the principal to do with the article.
+func ArticleAccess(db *sql.DB, p Principal, a Article) (Access, error) {
+	acls, err := ACLsByArticle(db, a)
+	if err != nil {
+		return Access{}, err
+	}
+	groups, err := GroupIDsByUser(db, p.UserID)
+	if err != nil {
+		return Access{}, err
+	}
+	return access(p, acls, groups), nil
+}
+
+// HiddenArticleIDs returns ids of articles the principal can not read.
+func HiddenArticleIDs(db *sql.DB, p Principal) (map[int64]bool, error) {
+	cond, args := p.readable()
+	rows, err := db.Query(`select a.article_id from articles a where not `+cond, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// Insert inserts new ACL entry.
+func (t *ACL) Insert(tx *sql.Tx) (sql.Result, error) {
+	stmt, err := tx.Prepare(`
+	insert into article_acls (article_id, namespace, user_id, group_id, permission)
+	values(?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	return stmt.Exec(t.ArticleID, t.Namespace, t.UserID, t.GroupID, string(t.Permission))
+}
+
+// DeleteACL deletes the ACL entry.
+func DeleteACL(tx *sql.Tx, id int64) (sql.Result, error) {
+	return tx.Exec(`delete from article_acls where acl_id = ?`, id)
+}
+
+// DeleteArticleACLs deletes ACL entries of the article.
+func DeleteArticleACLs(tx *sql.Tx, articleID int64) (sql.Result, error) {
+	return tx.Exec(`delete from article_acls where article_id = ?`, articleID)
+}
@@ -1,10 +1,76 @@
 package model
 
-import "database/sql"
+import (
+	"database/sql"
+	"strings"
+)
 
-// ArticlesAll returns all articles.
-func ArticlesAll(db *sql.DB) ([]Article, error) {
-	rows, err := db.Query(`select * from articles`)
+// ArticlesAll returns all articles readable by the principal.
+func ArticlesAll(db *sql.DB, p Principal) ([]Article, error) {
+	cond, args := p.readable()
+	rows, err := db.Query(`select a.* from articles a where `+cond, args...)
+	if err != nil {
+		return nil, err
+	}
+	return ScanArticles(rows)
+}
+
+// Sort orders of articles.
+const (
+	// SortUpdated lists recently updated articles first.
+	SortUpdated = "updated"
+	// SortCreated lists recently created articles first.
+	SortCreated = "created"
+	// SortTitle lists articles in alphabetical order of titles.
+	SortTitle = "title"
+)
+
+// articleOrders maps sort orders to order by clauses.
+var articleOrders = map[string]string{
+	SortUpdated: "updated desc, article_id desc",
+	SortCreated: "created desc, article_id desc",
+	SortTitle:   "title, article_id",
+}
+
+// IsArticleSort reports whether sort is one of supported sort orders.
+func IsArticleSort(sort string) bool {
+	_, ok := articleOrders[sort]
+	return ok
+}
+
+// ArticlesPage returns at most limit articles readable by the principal
+// from offset in given order. Unknown order is treated as SortUpdated.
+func ArticlesPage(db *sql.DB, p Principal, sort string, offset, limit int) ([]Article, error) {
+	order, ok := articleOrders[sort]
+	if !ok {
+		order = articleOrders[SortUpdated]
+	}
+	cond, args := p.readable()
+	rows, err := db.Query(`select a.* from articles a where `+cond+` order by `+order+` limit ? offset ?`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	return ScanArticles(rows)
+}
+
+// ArticlesCount returns number of articles readable by the principal.
+func ArticlesCount(db *sql.DB, p Principal) (int, error) {
+	var count int
+	cond, args := p.readable()
+	err := db.QueryRow(`select count(*) from articles a where `+cond, args...).Scan(&count)
+	return count, err
+}
+
+// ArticlesByAuthor returns articles created by the user and readable by
+// the principal, newest first.
+func ArticlesByAuthor(db *sql.DB, p Principal, userID int64) ([]Article, error) {
+	cond, args := p.readable()
+	rows, err := db.Query(`
+	select a.* from articles a
+		where a.author_id = ? and `+cond+`
+		order by a.created desc, a.article_id desc
+	`, append([]interface{}{userID}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -12,35 +78,73 @@ func ArticlesAll(db *sql.DB) ([]Article, error) {
 }
 
 // ArticleOne returns the article for given id.
-func ArticleOne(db *sql.DB, id int64) (Article, error) {
-	return ScanArticle(db.QueryRow(`select * from articles where article_id = ?`, id))
+// Articles the principal can not read are not found.
+func ArticleOne(db *sql.DB, p Principal, id int64) (Article, error) {
+	cond, args := p.readable()
+	return ScanArticle(db.QueryRow(`select a.* from articles a where a.article_id = ? and `+cond,
+		append([]interface{}{id}, args...)...))
+}
+
+// ArticleIDsByTitles returns ids of articles for given titles, keyed by title.
+// Titles not found are not included. If titles are duplicated,
+// the oldest article wins.
+func ArticleIDsByTitles(db *sql.DB, titles []string) (map[string]int64, error) {
+	ids := make(map[string]int64, len(titles))
+	if len(titles) == 0 {
+		return ids, nil
+	}
+	args := make([]interface{}, len(titles))
+	for i, title := range titles {
+		args[i] = title
+	}
+	rows, err := db.Query(`
+	select article_id, title from articles
+		where title in (?`+strings.Repeat(`, ?`, len(titles)-1)+`)
+		order by article_id desc
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id    int64
+			title string
+		)
+		if err := rows.Scan(&id, &title); err != nil {
+			return nil, err
+		}
+		ids[title] = id
+	}
+	return ids, rows.Err()
 }
 
 // Update updates article by given article.
+// Author of the article is kept.
 func (t *Article) Update(tx *sql.Tx) (sql.Result, error) {
 	stmt, err := tx.Prepare(`
 	update articles
-		set title = ?, body = ?
+		set title = ?, body = ?, last_editor_id = ?, updated = CURRENT_TIMESTAMP
 		where article_id = ?
 	`)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
-	return stmt.Exec(t.Title, t.Body, t.ID)
+	return stmt.Exec(t.Title, t.Body, t.LastEditorID, t.ID)
 }
 
 // Insert inserts new article.
 func (t *Article) Insert(tx *sql.Tx) (sql.Result, error) {
 	stmt, err := tx.Prepare(`
-	insert into articles (title, body)
-	values(?, ?)
+	insert into articles (title, body, author_id, last_editor_id)
+	values(?, ?, ?, ?)
 	`)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
-	return stmt.Exec(t.Title, t.Body)
+	return stmt.Exec(t.Title, t.Body, t.AuthorID, t.LastEditorID)
 }
 
 // Delete deletes article by given id.
@@ -56,5 +160,5 @@ func (t *Article) Delete(tx *sql.Tx) (sql.Result, error) {
 // ArticlesDeleteAll deltes all articles.
 // Useful for testing.
 func ArticlesDeleteAll(tx *sql.Tx) (sql.Result, error) {
-	return tx.Exec(`truncate table articles`)
+	return tx.Exec(`delete from articles`)
 }
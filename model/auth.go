@@ -0,0 +1,51 @@
+package model
+
+import "github.com/pkg/errors"
+
+// Authenticator authenticates users by login names, such as email
+// addresses, and passwords. Unknown users are ErrNotFound, and wrong
+// passwords are ErrPasswordUnmatch.
+type Authenticator interface {
+	Authenticate(login, password string) (User, error)
+}
+
+// LocalAuth authenticates users by passwords saved in the store.
+type LocalAuth struct {
+	Users UserStore
+}
+
+// Authenticate implements Authenticator.
+func (a LocalAuth) Authenticate(login, password string) (User, error) {
+	return a.Users.Auth(login, password)
+}
+
+// Authenticators tries each of authenticators in order, until any of them
+// knows the user and the password.
+type Authenticators []Authenticator
+
+// Authenticate implements Authenticator. If none of them authenticates
+// the user, errors other than ErrNotFound and ErrPasswordUnmatch, such as
+// ones of unreachable servers, are returned first, and ErrPasswordUnmatch
+// is returned if any of them knows the user.
+func (as Authenticators) Authenticate(login, password string) (User, error) {
+	var unmatch, failed error
+	for _, a := range as {
+		u, err := a.Authenticate(login, password)
+		switch errors.Cause(err) {
+		case nil:
+			return u, nil
+		case ErrNotFound:
+		case ErrPasswordUnmatch:
+			unmatch = err
+		default:
+			failed = err
+		}
+	}
+	switch {
+	case failed != nil:
+		return User{}, failed
+	case unmatch != nil:
+		return User{}, unmatch
+	}
+	return User{}, ErrNotFound
+}
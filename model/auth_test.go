@@ -0,0 +1,41 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+// authFunc is an Authenticator by the function.
+type authFunc func(login, password string) (User, error)
+
+func (f authFunc) Authenticate(login, password string) (User, error) { return f(login, password) }
+
+func TestAuthenticators(t *testing.T) {
+	errDown := errors.New("server down")
+	ok := authFunc(func(login, password string) (User, error) { return User{ID: 1}, nil })
+	notFound := authFunc(func(login, password string) (User, error) { return User{}, ErrNotFound })
+	unmatch := authFunc(func(login, password string) (User, error) { return User{}, ErrPasswordUnmatch })
+	down := authFunc(func(login, password string) (User, error) { return User{}, errDown })
+
+	tests := []struct {
+		as   Authenticators
+		want error
+	}{
+		{Authenticators{notFound, ok}, nil},
+		{Authenticators{unmatch, ok}, nil},
+		{Authenticators{down, ok}, nil},
+		{Authenticators{notFound, unmatch}, ErrPasswordUnmatch},
+		{Authenticators{unmatch, down}, errDown},
+		{Authenticators{notFound}, ErrNotFound},
+		{nil, ErrNotFound},
+	}
+	for i, tt := range tests {
+		u, err := tt.as.Authenticate("alice@example.com", "password")
+		if err != tt.want {
+			t.Errorf("%d: want %v, got %v", i, tt.want, err)
+		}
+		if err == nil && u.ID != 1 {
+			t.Errorf("%d: unexpected user: %+v", i, u)
+		}
+	}
+}
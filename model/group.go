@@ -0,0 +1,129 @@
+package model
+
+import "database/sql"
+
+// GroupsAll returns all groups ordered by name.
+func GroupsAll(db *sql.DB) ([]Group, error) {
+	rows, err := db.Query(`select * from user_groups order by name, group_id`)
+	if err != nil {
+		return nil, err
+	}
+	return ScanGroups(rows)
+}
+
+// GroupOne returns the group for given id.
+func GroupOne(db *sql.DB, id int64) (Group, error) {
+	return ScanGroup(db.QueryRow(`select * from user_groups where group_id = ?`, id))
+}
+
+// GroupsByUser returns groups the user is member of, ordered by name.
+func GroupsByUser(db *sql.DB, userID int64) ([]Group, error) {
+	rows, err := db.Query(`
+	select g.* from user_groups g
+		join group_members m on m.group_id = g.group_id
+		where m.user_id = ?
+		order by g.name, g.group_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return ScanGroups(rows)
+}
+
+// GroupIDsByUser returns ids of groups the user is member of.
+func GroupIDsByUser(db *sql.DB, userID int64) (map[int64]bool, error) {
+	rows, err := db.Query(`select group_id from group_members where user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// GroupMembers returns members of the group ordered by id.
+func GroupMembers(db *sql.DB, groupID int64) ([]User, error) {
+	rows, err := db.Query(`
+	select u.* from users u
+		join group_members m on m.user_id = u.user_id
+		where m.group_id = ?
+		order by u.user_id
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return ScanUsers(rows)
+}
+
+// groupNameTaken reports whether other group than id has the name.
+func groupNameTaken(tx *sql.Tx, name string, id int64) (bool, error) {
+	var count int
+	err := tx.QueryRow(`select count(*) from user_groups where name = ? and group_id <> ?`, name, id).Scan(&count)
+	return count > 0, err
+}
+
+// Insert inserts new group.
+func (g *Group) Insert(tx *sql.Tx) (sql.Result, error) {
+	stmt, err := tx.Prepare(`insert into user_groups (name) values(?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	return stmt.Exec(g.Name)
+}
+
+// Update renames the group.
+func (g *Group) Update(tx *sql.Tx) (sql.Result, error) {
+	stmt, err := tx.Prepare(`update user_groups set name = ? where group_id = ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	return stmt.Exec(g.Name, g.ID)
+}
+
+// Delete deletes the group with its members. It returns ErrInUse if ACL
+// entries name the group.
+func (g *Group) Delete(tx *sql.Tx) error {
+	var count int
+	if err := tx.QueryRow(`select count(*) from article_acls where group_id = ?`, g.ID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrInUse
+	}
+	for _, q := range []string{
+		`delete from user_groups where group_id = ?`,
+		`delete from group_members where group_id = ?`,
+	} {
+		if _, err := tx.Exec(q, g.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddMember adds the user to the group. Adding a member twice is not
+// an error.
+func (g *Group) AddMember(tx *sql.Tx, userID int64) error {
+	var count int
+	if err := tx.QueryRow(`
+	select count(*) from group_members where group_id = ? and user_id = ?
+	`, g.ID, userID).Scan(&count); err != nil || count > 0 {
+		return err
+	}
+	_, err := tx.Exec(`insert into group_members (group_id, user_id) values(?, ?)`, g.ID, userID)
+	return err
+}
+
+// RemoveMember removes the user from the group.
+func (g *Group) RemoveMember(tx *sql.Tx, userID int64) (sql.Result, error) {
+	return tx.Exec(`delete from group_members where group_id = ? and user_id = ?`, g.ID, userID)
+}
@@ -0,0 +1,41 @@
+package model
+
+import "database/sql"
+
+// UserByIdentity returns the user of the identity given by the issuer and
+// the subject.
+func UserByIdentity(db *sql.DB, issuer, subject string) (User, error) {
+	return ScanUser(db.QueryRow(`
+	select users.* from users
+		inner join user_identities on user_identities.user_id = users.user_id
+		where user_identities.issuer = ? and user_identities.subject = ?
+	`, issuer, subject))
+}
+
+// Insert inserts new identity.
+func (i *Identity) Insert(tx *sql.Tx) (sql.Result, error) {
+	stmt, err := tx.Prepare(`
+	insert into user_identities (user_id, issuer, subject)
+	values(?, ?, ?)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	return stmt.Exec(i.UserID, i.Issuer, i.Subject)
+}
+
+// emailTaken reports whether the email address is used by any user.
+func emailTaken(tx *sql.Tx, email string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`select count(*) from users where email = ?`, email).Scan(&count)
+	return count > 0, err
+}
+
+// IdentityExists reports whether the identity given by the issuer and the
+// subject is linked to any user.
+func IdentityExists(tx *sql.Tx, issuer, subject string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`select count(*) from user_identities where issuer = ? and subject = ?`, issuer, subject).Scan(&count)
+	return count > 0, err
+}
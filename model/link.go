@@ -0,0 +1,124 @@
+package model
+
+import "database/sql"
+
+// BrokenLink is a link to an article which does not exist.
+type BrokenLink struct {
+	FromID    int64
+	FromTitle string
+	// ToID is set if linked by /article/{id}, otherwise ToTitle is set.
+	ToID    int64
+	ToTitle string
+}
+
+// SaveLinks replaces links from the article by links to given article ids
+// and titles. Links to the article itself are ignored.
+func (t *Article) SaveLinks(tx *sql.Tx, ids []int64, titles []string) error {
+	if err := t.DeleteLinks(tx); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`
+	insert into article_links (from_article_id, to_article_id, to_title)
+	values(?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, id := range ids {
+		if id == t.ID {
+			continue
+		}
+		if _, err := stmt.Exec(t.ID, id, ""); err != nil {
+			return err
+		}
+	}
+	for _, title := range titles {
+		if title == t.Title {
+			continue
+		}
+		if _, err := stmt.Exec(t.ID, 0, title); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteLinks deletes links from the article.
+func (t *Article) DeleteLinks(tx *sql.Tx) error {
+	_, err := tx.Exec(`delete from article_links where from_article_id = ?`, t.ID)
+	return err
+}
+
+// Backlinks returns articles linking to the article by its id or title,
+// which are readable by the principal.
+func Backlinks(db *sql.DB, p Principal, id int64, title string) ([]Article, error) {
+	cond, args := p.readable()
+	rows, err := db.Query(`
+	select a.* from articles a
+		where a.article_id in (
+			select from_article_id from article_links
+				where to_article_id = ? or to_title = ?
+		)
+		and `+cond+`
+		order by a.title
+	`, append([]interface{}{id, title}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return ScanArticles(rows)
+}
+
+// OrphanArticles returns articles which no other article links to,
+// and which are readable by the principal.
+func OrphanArticles(db *sql.DB, p Principal) ([]Article, error) {
+	cond, args := p.readable()
+	rows, err := db.Query(`
+	select a.* from articles a
+		where not exists (
+			select 1 from article_links l
+				where (l.to_article_id = a.article_id or l.to_title = a.title)
+				and l.from_article_id <> a.article_id
+		)
+		and `+cond+`
+		order by a.title
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return ScanArticles(rows)
+}
+
+// BrokenLinks returns links to articles which do not exist,
+// from articles readable by the principal.
+func BrokenLinks(db *sql.DB, p Principal) ([]BrokenLink, error) {
+	cond, args := p.readable()
+	rows, err := db.Query(`
+	select a.article_id, a.title, l.to_article_id, l.to_title
+		from article_links l
+		join articles a on a.article_id = l.from_article_id
+		where ((l.to_article_id <> 0 and not exists (
+			select 1 from articles t where t.article_id = l.to_article_id
+		))
+		or (l.to_title <> '' and not exists (
+			select 1 from articles t where t.title = l.to_title
+		)))
+		and `+cond+`
+		order by a.title, l.to_title, l.to_article_id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var links []BrokenLink
+	for rows.Next() {
+		var l BrokenLink
+		if err := rows.Scan(&l.FromID, &l.FromTitle, &l.ToID, &l.ToTitle); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
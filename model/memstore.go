@@ -0,0 +1,1182 @@
+package model
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store which keeps everything in memory.
+// It is useful for trying the wiki and for tests without database.
+// All data are lost when the process exits.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	articles      map[int64]Article
+	lastArticleID int64
+	revisions     map[int64][]Revision
+	lastRevision  int64
+	links         map[int64][]link
+
+	users      map[int64]User
+	lastUserID int64
+
+	tokens      map[int64]AccessToken
+	lastTokenID int64
+
+	resets      map[int64]PasswordReset
+	lastResetID int64
+
+	verifications      map[int64]EmailVerification
+	lastVerificationID int64
+
+	// recoveryCodes are hashes of recovery codes keyed by user id,
+	// with whether they are used.
+	recoveryCodes map[int64]map[string]bool
+	settings      map[string]string
+
+	identities     map[int64]Identity
+	lastIdentityID int64
+
+	groups      map[int64]Group
+	lastGroupID int64
+	// members are ids of users keyed by group id.
+	members map[int64]map[int64]bool
+
+	acls      map[int64]ACL
+	lastACLID int64
+}
+
+// link is a link from an article, by id or title.
+type link struct {
+	toID    int64
+	toTitle string
+}
+
+// NewMemoryStore returns an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		articles:      make(map[int64]Article),
+		revisions:     make(map[int64][]Revision),
+		links:         make(map[int64][]link),
+		users:         make(map[int64]User),
+		tokens:        make(map[int64]AccessToken),
+		resets:        make(map[int64]PasswordReset),
+		verifications: make(map[int64]EmailVerification),
+		recoveryCodes: make(map[int64]map[string]bool),
+		settings:      make(map[string]string),
+		identities:    make(map[int64]Identity),
+		groups:        make(map[int64]Group),
+		members:       make(map[int64]map[int64]bool),
+		acls:          make(map[int64]ACL),
+	}
+}
+
+// Close does nothing.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// now returns current time truncated to seconds as databases do.
+func now() *time.Time {
+	t := time.Now().Truncate(time.Second)
+	return &t
+}
+
+func (s *MemoryStore) ArticlesAll(p Principal) ([]Article, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	articles := s.readableArticles(p)
+	sort.Sort(byID(articles))
+	return articles, nil
+}
+
+// readableArticles returns articles readable by the principal
+// in no particular order.
+func (s *MemoryStore) readableArticles(p Principal) []Article {
+	articles := make([]Article, 0, len(s.articles))
+	for _, a := range s.articles {
+		if s.readable(p, a) {
+			articles = append(articles, a)
+		}
+	}
+	return articles
+}
+
+// readable reports whether the principal can read the article.
+func (s *MemoryStore) readable(p Principal, a Article) bool {
+	if p.Admin {
+		return true
+	}
+	access := s.access(p, a)
+	return !access.Restricted || access.Granted != ""
+}
+
+// access returns what ACLs allow the principal to do with the article.
+func (s *MemoryStore) access(p Principal, a Article) Access {
+	groups := make(map[int64]bool)
+	for id, members := range s.members {
+		if members[p.UserID] {
+			groups[id] = true
+		}
+	}
+	return access(p, s.aclsByArticle(a), groups)
+}
+
+func (s *MemoryStore) ArticlesPage(p Principal, order string, offset, limit int) ([]Article, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	articles := s.readableArticles(p)
+	switch order {
+	case SortCreated:
+		sort.Sort(byCreated(articles))
+	case SortTitle:
+		sort.Sort(byTitle(articles))
+	default:
+		sort.Sort(byUpdated(articles))
+	}
+	if offset > len(articles) {
+		offset = len(articles)
+	}
+	articles = articles[offset:]
+	if limit < len(articles) {
+		articles = articles[:limit]
+	}
+	return articles, nil
+}
+
+func (s *MemoryStore) ArticlesCount(p Principal) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.readableArticles(p)), nil
+}
+
+func (s *MemoryStore) ArticlesByAuthor(p Principal, userID int64) ([]Article, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var articles []Article
+	for _, a := range s.articles {
+		if a.AuthorID == userID && s.readable(p, a) {
+			articles = append(articles, a)
+		}
+	}
+	sort.Sort(byCreated(articles))
+	return articles, nil
+}
+
+func (s *MemoryStore) ArticleOne(p Principal, id int64) (Article, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.articles[id]
+	if !ok || !s.readable(p, a) {
+		return Article{}, ErrNotFound
+	}
+	return a, nil
+}
+
+func (s *MemoryStore) ArticleIDsByTitles(titles []string) (map[string]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make(map[string]int64, len(titles))
+	for _, title := range titles {
+		if a, ok := s.articleByTitle(title); ok {
+			ids[a.Title] = a.ID
+		}
+	}
+	return ids, nil
+}
+
+// articleByTitle finds the oldest article of the title.
+// Titles are compared case-insensitively as MySQL does.
+func (s *MemoryStore) articleByTitle(title string) (Article, bool) {
+	var (
+		found Article
+		ok    bool
+	)
+	for _, a := range s.articles {
+		if strings.EqualFold(a.Title, title) && (!ok || a.ID < found.ID) {
+			found, ok = a, true
+		}
+	}
+	return found, ok
+}
+
+func (s *MemoryStore) Revisions(articleID int64) ([]Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revs := s.revisions[articleID]
+	revisions := make([]Revision, 0, len(revs))
+	for i := len(revs) - 1; i >= 0; i-- {
+		revisions = append(revisions, revs[i])
+	}
+	return revisions, nil
+}
+
+func (s *MemoryStore) RevisionOne(articleID, revision int64) (Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, rev := range s.revisions[articleID] {
+		if rev.Revision == revision {
+			return rev, nil
+		}
+	}
+	return Revision{}, ErrNotFound
+}
+
+func (s *MemoryStore) LatestRevision(articleID int64) (Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revs := s.revisions[articleID]
+	if len(revs) == 0 {
+		return Revision{}, ErrNotFound
+	}
+	return revs[len(revs)-1], nil
+}
+
+func (s *MemoryStore) Backlinks(p Principal, id int64, title string) ([]Article, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var articles []Article
+	for from, links := range s.links {
+		if !s.readable(p, s.articles[from]) {
+			continue
+		}
+		for _, l := range links {
+			if l.toID == id || (l.toTitle != "" && strings.EqualFold(l.toTitle, title)) {
+				articles = append(articles, s.articles[from])
+				break
+			}
+		}
+	}
+	sort.Sort(byTitle(articles))
+	return articles, nil
+}
+
+func (s *MemoryStore) OrphanArticles(p Principal) ([]Article, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var articles []Article
+	for _, a := range s.readableArticles(p) {
+		if !s.linked(a) {
+			articles = append(articles, a)
+		}
+	}
+	sort.Sort(byTitle(articles))
+	return articles, nil
+}
+
+// linked reports whether any other article links to a.
+func (s *MemoryStore) linked(a Article) bool {
+	for from, links := range s.links {
+		if from == a.ID {
+			continue
+		}
+		for _, l := range links {
+			if l.toID == a.ID || (l.toTitle != "" && strings.EqualFold(l.toTitle, a.Title)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) BrokenLinks(p Principal) ([]BrokenLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var broken []BrokenLink
+	for _, from := range s.sortedArticles() {
+		if !s.readable(p, from) {
+			continue
+		}
+		for _, l := range s.links[from.ID] {
+			if l.toID != 0 {
+				if _, ok := s.articles[l.toID]; ok {
+					continue
+				}
+			} else if _, ok := s.articleByTitle(l.toTitle); ok {
+				continue
+			}
+			broken = append(broken, BrokenLink{
+				FromID:    from.ID,
+				FromTitle: from.Title,
+				ToID:      l.toID,
+				ToTitle:   l.toTitle,
+			})
+		}
+	}
+	return broken, nil
+}
+
+func (s *MemoryStore) sortedArticles() []Article {
+	articles := make([]Article, 0, len(s.articles))
+	for _, a := range s.articles {
+		articles = append(articles, a)
+	}
+	sort.Sort(byTitle(articles))
+	return articles
+}
+
+func (s *MemoryStore) InsertArticle(a *Article, e Edit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastArticleID++
+	a.ID = s.lastArticleID
+	a.Created, a.Updated = now(), now()
+	a.AuthorID, a.LastEditorID = e.UserID, e.UserID
+	s.articles[a.ID] = *a
+	s.record(a, e)
+	return nil
+}
+
+func (s *MemoryStore) UpdateArticle(a *Article, e Edit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.articles[a.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if e.BaseRevision != 0 && int64(len(s.revisions[a.ID])) != e.BaseRevision {
+		return ErrConflict
+	}
+	a.Created, a.Updated = old.Created, now()
+	a.AuthorID, a.LastEditorID = old.AuthorID, e.UserID
+	s.articles[a.ID] = *a
+	s.record(a, e)
+	return nil
+}
+
+// record saves revision and links of the article for the edit.
+func (s *MemoryStore) record(a *Article, e Edit) {
+	s.lastRevision++
+	revs := s.revisions[a.ID]
+	s.revisions[a.ID] = append(revs, Revision{
+		ID:           s.lastRevision,
+		ArticleID:    a.ID,
+		Revision:     int64(len(revs) + 1),
+		Title:        a.Title,
+		Body:         a.Body,
+		UserID:       e.UserID,
+		Created:      a.Updated,
+		RevertedFrom: e.RevertedFrom,
+	})
+	s.saveLinks(*a, e.LinkIDs, e.LinkTitles)
+}
+
+func (s *MemoryStore) SaveLinks(a Article, ids []int64, titles []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveLinks(a, ids, titles)
+	return nil
+}
+
+// saveLinks replaces links from the article. Links to itself are ignored.
+func (s *MemoryStore) saveLinks(a Article, ids []int64, titles []string) {
+	links := make([]link, 0, len(ids)+len(titles))
+	for _, id := range ids {
+		if id != a.ID {
+			links = append(links, link{toID: id})
+		}
+	}
+	for _, title := range titles {
+		if title != a.Title {
+			links = append(links, link{toTitle: title})
+		}
+	}
+	s.links[a.ID] = links
+}
+
+func (s *MemoryStore) DeleteArticle(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.articles, id)
+	delete(s.links, id)
+	for aclID, acl := range s.acls {
+		if acl.ArticleID == id {
+			delete(s.acls, aclID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) ArticleAccess(p Principal, a Article) (Access, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.access(p, a), nil
+}
+
+func (s *MemoryStore) HiddenArticleIDs(p Principal) (map[int64]bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make(map[int64]bool)
+	for id, a := range s.articles {
+		if !s.readable(p, a) {
+			ids[id] = true
+		}
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) UserOne(id int64) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+func (s *MemoryStore) UserByEmail(email string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.userByEmail(email)
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+func (s *MemoryStore) userByEmail(email string) (User, bool) {
+	for _, u := range s.users {
+		if strings.EqualFold(u.Email, email) {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+func (s *MemoryStore) UserExists(email string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.userByEmail(email)
+	return ok, nil
+}
+
+func (s *MemoryStore) UserNames(ids []int64) (map[int64]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make(map[int64]string, len(ids))
+	for _, id := range ids {
+		if u, ok := s.users[id]; ok {
+			names[id] = u.Name
+		}
+	}
+	return names, nil
+}
+
+func (s *MemoryStore) UsersAll() ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make([]User, 0, len(s.users))
+	for id := int64(1); id <= s.lastUserID; id++ {
+		if u, ok := s.users[id]; ok {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) InsertUser(u *User, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.userByEmail(u.Email); ok {
+		return ErrDuplicated
+	}
+	switch {
+	case len(s.users) == 0:
+		u.Role = RoleAdmin
+	case u.Role == "":
+		u.Role = RoleEditor
+	}
+	s.lastUserID++
+	u.ID = s.lastUserID
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	u.Salt, u.Salted = "", hash
+	u.Created, u.Updated = now(), now()
+	s.users[u.ID] = *u
+	return nil
+}
+
+func (s *MemoryStore) UpdateUser(u *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.users[u.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if other, ok := s.userByEmail(u.Email); ok && other.ID != u.ID {
+		return ErrDuplicated
+	}
+	if old.Email != u.Email {
+		// new email address must be verified again.
+		old.EmailVerified = false
+	}
+	old.Name, old.Email, old.Updated = u.Name, u.Email, now()
+	s.users[u.ID] = old
+	return nil
+}
+
+func (s *MemoryStore) UpdateUserRole(id int64, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	u.Role = role
+	s.users[id] = u
+	return nil
+}
+
+func (s *MemoryStore) Auth(email, password string) (User, error) {
+	u, err := s.UserByEmail(email)
+	if err != nil {
+		return User{}, err
+	}
+	rehash, err := u.verify(password)
+	if err != nil {
+		return User{}, err
+	}
+	if rehash {
+		hash, err := HashPassword(password)
+		if err != nil {
+			return User{}, err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		u.Salt, u.Salted = "", hash
+		if v, ok := s.users[u.ID]; ok {
+			v.Salt, v.Salted = u.Salt, u.Salted
+			s.users[u.ID] = v
+		}
+	}
+	return u, nil
+}
+
+func (s *MemoryStore) AccessTokens(userID int64) ([]AccessToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var tokens []AccessToken
+	for id := s.lastTokenID; id > 0; id-- {
+		if t, ok := s.tokens[id]; ok && t.UserID == userID {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func (s *MemoryStore) InsertAccessToken(t *AccessToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.tokens {
+		if other.Hash == t.Hash {
+			return ErrDuplicated
+		}
+	}
+	s.lastTokenID++
+	t.ID = s.lastTokenID
+	t.Created = now()
+	s.tokens[t.ID] = *t
+	return nil
+}
+
+func (s *MemoryStore) DeleteAccessToken(userID, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tokens[id]; ok && t.UserID == userID {
+		delete(s.tokens, id)
+	}
+	return nil
+}
+
+func (s *MemoryStore) UserByAccessToken(hash string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, t := range s.tokens {
+		if t.Hash != hash {
+			continue
+		}
+		u, ok := s.users[t.UserID]
+		if !ok {
+			return User{}, ErrNotFound
+		}
+		t.LastUsed = now()
+		s.tokens[id] = t
+		return u, nil
+	}
+	return User{}, ErrNotFound
+}
+
+func (s *MemoryStore) InsertPasswordReset(t *PasswordReset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.resets {
+		if other.Hash == t.Hash {
+			return ErrDuplicated
+		}
+	}
+	s.lastResetID++
+	t.ID = s.lastResetID
+	t.Created = now()
+	s.resets[t.ID] = *t
+	return nil
+}
+
+func (s *MemoryStore) PasswordResetByHash(hash string) (PasswordReset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.passwordResetByHash(hash)
+	if !ok || !t.Usable(time.Now()) {
+		return PasswordReset{}, ErrNotFound
+	}
+	return t, nil
+}
+
+// passwordResetByHash returns the token for given hash.
+// It must be called with the lock held.
+func (s *MemoryStore) passwordResetByHash(hash string) (PasswordReset, bool) {
+	for _, t := range s.resets {
+		if t.Hash == hash {
+			return t, true
+		}
+	}
+	return PasswordReset{}, false
+}
+
+func (s *MemoryStore) ResetPassword(hash, password string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.passwordResetByHash(hash)
+	if !ok || !t.Usable(time.Now()) {
+		return User{}, ErrNotFound
+	}
+	u, ok := s.users[t.UserID]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	salted, err := HashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	u.Salt, u.Salted = "", salted
+	s.users[u.ID] = u
+	used := now()
+	for id, t := range s.resets {
+		if t.UserID == u.ID && t.Used == nil {
+			t.Used = used
+			s.resets[id] = t
+		}
+	}
+	return u, nil
+}
+
+func (s *MemoryStore) InsertEmailVerification(t *EmailVerification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.verifications {
+		if other.Hash == t.Hash {
+			return ErrDuplicated
+		}
+	}
+	s.lastVerificationID++
+	t.ID = s.lastVerificationID
+	t.Created = now()
+	s.verifications[t.ID] = *t
+	return nil
+}
+
+func (s *MemoryStore) VerifyEmail(hash string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, t := range s.verifications {
+		if t.Hash != hash {
+			continue
+		}
+		u, ok := s.users[t.UserID]
+		if !ok || !t.Usable(time.Now()) || u.Email != t.Email {
+			return User{}, ErrNotFound
+		}
+		t.Used = now()
+		s.verifications[id] = t
+		u.EmailVerified = true
+		s.users[u.ID] = u
+		return u, nil
+	}
+	return User{}, ErrNotFound
+}
+
+func (s *MemoryStore) PurgeUnverifiedUsers(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int
+	for id, u := range s.users {
+		if u.EmailVerified || u.Role == RoleAdmin || u.Created == nil || !u.Created.Before(before) {
+			continue
+		}
+		if s.userInACLs(id) {
+			continue
+		}
+		s.deleteUser(id)
+		n++
+	}
+	return n, nil
+}
+
+// userInACLs reports whether ACL entries name the user, who should not be
+// deleted not to open restricted articles. It must be called with the lock
+// held.
+func (s *MemoryStore) userInACLs(id int64) bool {
+	for _, acl := range s.acls {
+		if acl.UserID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteUser deletes the user with tokens and group memberships of the
+// user. It must be called with the lock held.
+func (s *MemoryStore) deleteUser(id int64) {
+	delete(s.users, id)
+	for tid, t := range s.tokens {
+		if t.UserID == id {
+			delete(s.tokens, tid)
+		}
+	}
+	for rid, t := range s.resets {
+		if t.UserID == id {
+			delete(s.resets, rid)
+		}
+	}
+	for vid, t := range s.verifications {
+		if t.UserID == id {
+			delete(s.verifications, vid)
+		}
+	}
+	delete(s.recoveryCodes, id)
+	for iid, i := range s.identities {
+		if i.UserID == id {
+			delete(s.identities, iid)
+		}
+	}
+	for _, members := range s.members {
+		delete(members, id)
+	}
+}
+
+func (s *MemoryStore) SetTOTPSecret(userID int64, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.TOTPSecret, u.MFAEnabled, u.TOTPCounter = secret, false, 0
+	s.users[userID] = u
+	return nil
+}
+
+func (s *MemoryStore) EnableMFA(userID, counter int64, recoveryHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok || u.TOTPSecret == "" {
+		return ErrNotFound
+	}
+	u.MFAEnabled, u.TOTPCounter = true, counter
+	s.users[userID] = u
+	s.replaceRecoveryCodes(userID, recoveryHashes)
+	return nil
+}
+
+func (s *MemoryStore) DisableMFA(userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[userID]; ok {
+		u.TOTPSecret, u.MFAEnabled, u.TOTPCounter = "", false, 0
+		s.users[userID] = u
+	}
+	delete(s.recoveryCodes, userID)
+	return nil
+}
+
+func (s *MemoryStore) UseTOTP(userID, counter int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok || u.TOTPCounter >= counter {
+		return ErrConflict
+	}
+	u.TOTPCounter = counter
+	s.users[userID] = u
+	return nil
+}
+
+func (s *MemoryStore) UseRecoveryCode(userID int64, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	used, ok := s.recoveryCodes[userID][hash]
+	if !ok || used {
+		return ErrNotFound
+	}
+	s.recoveryCodes[userID][hash] = true
+	return nil
+}
+
+func (s *MemoryStore) RecoveryCodesLeft(userID int64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var n int
+	for _, used := range s.recoveryCodes[userID] {
+		if !used {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) ReplaceRecoveryCodes(userID int64, hashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replaceRecoveryCodes(userID, hashes)
+	return nil
+}
+
+// replaceRecoveryCodes replaces recovery codes of the user by ones given by
+// their hashes. It must be called with the lock held.
+func (s *MemoryStore) replaceRecoveryCodes(userID int64, hashes []string) {
+	codes := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		codes[hash] = false
+	}
+	s.recoveryCodes[userID] = codes
+}
+
+func (s *MemoryStore) Setting(name string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings[name], nil
+}
+
+func (s *MemoryStore) SetSetting(name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings[name] = value
+	return nil
+}
+
+func (s *MemoryStore) UserByIdentity(issuer, subject string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.identity(issuer, subject)
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	u, ok := s.users[i.UserID]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+// identity returns the identity given by the issuer and the subject.
+// It must be called with the lock held.
+func (s *MemoryStore) identity(issuer, subject string) (Identity, bool) {
+	for _, i := range s.identities {
+		if i.Issuer == issuer && i.Subject == subject {
+			return i, true
+		}
+	}
+	return Identity{}, false
+}
+
+func (s *MemoryStore) InsertIdentity(i *Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.identity(i.Issuer, i.Subject); ok {
+		return ErrDuplicated
+	}
+	s.insertIdentity(i)
+	return nil
+}
+
+// insertIdentity inserts the identity. It must be called with the lock held.
+func (s *MemoryStore) insertIdentity(i *Identity) {
+	s.lastIdentityID++
+	i.ID = s.lastIdentityID
+	i.Created = now()
+	s.identities[i.ID] = *i
+}
+
+func (s *MemoryStore) ProvisionUser(u *User, i *Identity) error {
+	password, err := randomToken()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.userByEmail(u.Email); ok {
+		return ErrDuplicated
+	}
+	if _, ok := s.identity(i.Issuer, i.Subject); ok {
+		return ErrDuplicated
+	}
+	switch {
+	case len(s.users) == 0:
+		u.Role = RoleAdmin
+	case u.Role == "":
+		u.Role = RoleEditor
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	s.lastUserID++
+	u.ID = s.lastUserID
+	u.Salt, u.Salted = "", hash
+	u.Created, u.Updated = now(), now()
+	s.users[u.ID] = *u
+	i.UserID = u.ID
+	s.insertIdentity(i)
+	return nil
+}
+
+func (s *MemoryStore) GroupsAll() ([]Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	groups := make([]Group, 0, len(s.groups))
+	for _, g := range s.groups {
+		groups = append(groups, g)
+	}
+	sort.Sort(groupsByName(groups))
+	return groups, nil
+}
+
+func (s *MemoryStore) GroupOne(id int64) (Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, ok := s.groups[id]
+	if !ok {
+		return Group{}, ErrNotFound
+	}
+	return g, nil
+}
+
+func (s *MemoryStore) GroupsByUser(userID int64) ([]Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var groups []Group
+	for id, members := range s.members {
+		if members[userID] {
+			groups = append(groups, s.groups[id])
+		}
+	}
+	sort.Sort(groupsByName(groups))
+	return groups, nil
+}
+
+func (s *MemoryStore) GroupMembers(groupID int64) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var users []User
+	for id := int64(1); id <= s.lastUserID; id++ {
+		if u, ok := s.users[id]; ok && s.members[groupID][id] {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+// groupNameTaken reports whether other group than id has the name.
+func (s *MemoryStore) groupNameTaken(name string, id int64) bool {
+	for _, g := range s.groups {
+		if g.ID != id && strings.EqualFold(g.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) InsertGroup(g *Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.groupNameTaken(g.Name, 0) {
+		return ErrDuplicated
+	}
+	s.lastGroupID++
+	g.ID = s.lastGroupID
+	g.Created = now()
+	s.groups[g.ID] = *g
+	return nil
+}
+
+func (s *MemoryStore) UpdateGroup(g *Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.groups[g.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if s.groupNameTaken(g.Name, g.ID) {
+		return ErrDuplicated
+	}
+	old.Name = g.Name
+	s.groups[g.ID] = old
+	return nil
+}
+
+func (s *MemoryStore) DeleteGroup(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, acl := range s.acls {
+		if acl.GroupID == id {
+			return ErrInUse
+		}
+	}
+	delete(s.groups, id)
+	delete(s.members, id)
+	return nil
+}
+
+func (s *MemoryStore) AddGroupMember(groupID, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.groups[groupID]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.users[userID]; !ok {
+		return ErrNotFound
+	}
+	if s.members[groupID] == nil {
+		s.members[groupID] = make(map[int64]bool)
+	}
+	s.members[groupID][userID] = true
+	return nil
+}
+
+func (s *MemoryStore) RemoveGroupMember(groupID, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.members[groupID], userID)
+	return nil
+}
+
+func (s *MemoryStore) ACLsAll() ([]ACL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	acls := make([]ACL, 0, len(s.acls))
+	for _, acl := range s.acls {
+		acls = append(acls, acl)
+	}
+	sort.Sort(byTarget(acls))
+	return acls, nil
+}
+
+func (s *MemoryStore) ACLsByArticle(a Article) ([]ACL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.aclsByArticle(a), nil
+}
+
+func (s *MemoryStore) aclsByArticle(a Article) []ACL {
+	var acls []ACL
+	for _, acl := range s.acls {
+		if acl.appliesTo(a) {
+			acls = append(acls, acl)
+		}
+	}
+	sort.Sort(byTarget(acls))
+	return acls
+}
+
+func (s *MemoryStore) InsertACL(acl *ACL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastACLID++
+	acl.ID = s.lastACLID
+	acl.Created = now()
+	s.acls[acl.ID] = *acl
+	return nil
+}
+
+func (s *MemoryStore) DeleteACL(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.acls, id)
+	return nil
+}
+
+// byID sorts articles by id.
+type byID []Article
+
+func (a byID) Len() int           { return len(a) }
+func (a byID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byID) Less(i, j int) bool { return a[i].ID < a[j].ID }
+
+// byTitle sorts articles by title case-insensitively.
+type byTitle []Article
+
+func (a byTitle) Len() int      { return len(a) }
+func (a byTitle) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byTitle) Less(i, j int) bool {
+	ti, tj := strings.ToLower(a[i].Title), strings.ToLower(a[j].Title)
+	if ti != tj {
+		return ti < tj
+	}
+	return a[i].ID < a[j].ID
+}
+
+// byUpdated sorts articles by updated time, newest first.
+type byUpdated []Article
+
+func (a byUpdated) Len() int      { return len(a) }
+func (a byUpdated) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byUpdated) Less(i, j int) bool {
+	if !a[i].Updated.Equal(*a[j].Updated) {
+		return a[i].Updated.After(*a[j].Updated)
+	}
+	return a[i].ID > a[j].ID
+}
+
+// byCreated sorts articles by created time, newest first.
+type byCreated []Article
+
+func (a byCreated) Len() int      { return len(a) }
+func (a byCreated) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byCreated) Less(i, j int) bool {
+	if !a[i].Created.Equal(*a[j].Created) {
+		return a[i].Created.After(*a[j].Created)
+	}
+	return a[i].ID > a[j].ID
+}
+
+// groupsByName sorts groups by name.
+type groupsByName []Group
+
+func (g groupsByName) Len() int      { return len(g) }
+func (g groupsByName) Swap(i, j int) { g[i], g[j] = g[j], g[i] }
+func (g groupsByName) Less(i, j int) bool {
+	if g[i].Name != g[j].Name {
+		return g[i].Name < g[j].Name
+	}
+	return g[i].ID < g[j].ID
+}
+
+// byTarget sorts ACL entries by articles and namespaces.
+type byTarget []ACL
+
+func (a byTarget) Len() int      { return len(a) }
+func (a byTarget) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byTarget) Less(i, j int) bool {
+	if a[i].ArticleID != a[j].ArticleID {
+		return a[i].ArticleID < a[j].ArticleID
+	}
+	if a[i].Namespace != a[j].Namespace {
+		return a[i].Namespace < a[j].Namespace
+	}
+	return a[i].ID < a[j].ID
+}
@@ -0,0 +1,182 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// SettingMFARequired is the name of the setting which requires all users
+// to enroll in two-factor authentication if its value is "true".
+const SettingMFARequired = "mfa_required"
+
+// totpPeriod is the lifetime of a TOTP code.
+const totpPeriod = 30
+
+// NewTOTPKey returns new TOTP key of the user for enrollment.
+// The key gives the secret and the otpauth URI shown to the user.
+func NewTOTPKey(issuer string, u User) (*otp.Key, error) {
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: u.Email,
+		Period:      totpPeriod,
+	})
+}
+
+// TOTPKey returns the TOTP key of the user, whose secret is set on
+// enrollment, to show it again.
+func TOTPKey(issuer string, u User) (*otp.Key, error) {
+	q := url.Values{}
+	q.Set("issuer", issuer)
+	q.Set("secret", u.TOTPSecret)
+	q.Set("period", strconv.Itoa(totpPeriod))
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", "6")
+	uri := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + issuer + ":" + u.Email, RawQuery: q.Encode()}
+	return otp.NewKeyFromURL(uri.String())
+}
+
+// TOTPCounter checks the code against the secret at now, allowing one step
+// of clock skew, and returns the time step of the code. Codes of steps not
+// after last are rejected, so that each code is used only once.
+func TOTPCounter(secret, code string, last int64, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	step := now.Unix() / totpPeriod
+	for _, s := range []int64{step - 1, step, step + 1} {
+		if s <= last {
+			continue
+		}
+		want, err := totp.GenerateCodeCustom(secret, time.Unix(s*totpPeriod, 0), totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// recoveryCodeRunes are letters of recovery codes, without confusing ones
+// like 0 and o.
+const recoveryCodeRunes = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// NewRecoveryCodes returns n new recovery codes like abcde-fghjk, and their
+// hashes to save.
+func NewRecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, n)
+	hashes := make([]string, n)
+	max := big.NewInt(int64(len(recoveryCodeRunes)))
+	for i := range codes {
+		b := make([]byte, 10)
+		for j := range b {
+			k, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, nil, err
+			}
+			b[j] = recoveryCodeRunes[k.Int64()]
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns hash of the code to save and look up.
+// Hyphens, spaces and cases are ignored.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashToken(code)
+}
+
+// SetTOTPSecret sets the secret of the user for enrollment. Two-factor
+// authentication is disabled until the user confirms a code of it.
+func SetTOTPSecret(tx *sql.Tx, userID int64, secret string) (sql.Result, error) {
+	return tx.Exec(`update users set totp_secret = ?, mfa_enabled = 0, totp_counter = 0 where user_id = ?`, secret, userID)
+}
+
+// EnableMFA enables two-factor authentication of the user, recording the
+// time step of the code confirmed.
+func EnableMFA(tx *sql.Tx, userID, counter int64) (sql.Result, error) {
+	return tx.Exec(`update users set mfa_enabled = 1, totp_counter = ? where user_id = ? and totp_secret <> ''`, counter, userID)
+}
+
+// DisableMFA disables two-factor authentication of the user and deletes
+// the secret and recovery codes.
+func DisableMFA(tx *sql.Tx, userID int64) error {
+	if _, err := tx.Exec(`update users set totp_secret = '', mfa_enabled = 0, totp_counter = 0 where user_id = ?`, userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`delete from recovery_codes where user_id = ?`, userID)
+	return err
+}
+
+// UseTOTPCounter records the time step of the code used. It affects no rows
+// if the step is not after the last one, so that each code is used once.
+func UseTOTPCounter(tx *sql.Tx, userID, counter int64) (sql.Result, error) {
+	return tx.Exec(`update users set totp_counter = ? where user_id = ? and totp_counter < ?`, counter, userID, counter)
+}
+
+// ReplaceRecoveryCodes replaces recovery codes of the user by the codes
+// given by their hashes.
+func ReplaceRecoveryCodes(tx *sql.Tx, userID int64, hashes []string) error {
+	if _, err := tx.Exec(`delete from recovery_codes where user_id = ?`, userID); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`insert into recovery_codes (user_id, code_hash) values(?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, hash := range hashes {
+		if _, err := stmt.Exec(userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks the code of the user given by its hash used.
+// It affects no rows if the code is not found or already used.
+func UseRecoveryCode(tx *sql.Tx, userID int64, hash string) (sql.Result, error) {
+	return tx.Exec(`update recovery_codes set used = ? where user_id = ? and code_hash = ? and used is null`,
+		time.Now().UTC(), userID, hash)
+}
+
+// RecoveryCodesLeft returns the number of unused recovery codes of the user.
+func RecoveryCodesLeft(db *sql.DB, userID int64) (int, error) {
+	var n int
+	err := db.QueryRow(`select count(*) from recovery_codes where user_id = ? and used is null`, userID).Scan(&n)
+	return n, err
+}
+
+// Setting returns the value of the setting. Settings not set are empty.
+func Setting(db *sql.DB, name string) (string, error) {
+	var value string
+	err := db.QueryRow(`select value from settings where name = ?`, name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+// SetSetting sets the value of the setting.
+func SetSetting(tx *sql.Tx, name, value string) error {
+	if _, err := tx.Exec(`delete from settings where name = ?`, name); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`insert into settings (name, value) values(?, ?)`, name, value)
+	return err
+}
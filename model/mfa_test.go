@@ -0,0 +1,80 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func TestTOTPCounter(t *testing.T) {
+	key, err := NewTOTPKey("go-wiki", User{Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := key.Secret()
+	now := time.Date(2017, 1, 1, 0, 0, 15, 0, time.UTC)
+	step := now.Unix() / totpPeriod
+	code := func(at time.Time) string {
+		c, err := totp.GenerateCode(secret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		code string
+		last int64
+		want int64
+		ok   bool
+	}{
+		{code(now), 0, step, true},
+		{" " + code(now) + " ", 0, step, true},
+		{code(now.Add(-totpPeriod * time.Second)), 0, step - 1, true},
+		{code(now.Add(totpPeriod * time.Second)), 0, step + 1, true},
+		{code(now.Add(-2 * totpPeriod * time.Second)), 0, 0, false},
+		// used codes are rejected.
+		{code(now), step, 0, false},
+		{code(now.Add(-totpPeriod * time.Second)), step - 1, 0, false},
+		{"000000x", 0, 0, false},
+	}
+	for i, tt := range tests {
+		got, ok := TOTPCounter(secret, tt.code, tt.last, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%d: want (%d, %t), got (%d, %t)", i, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestTOTPKey(t *testing.T) {
+	u := User{Email: "alice@example.com", TOTPSecret: "JBSWY3DPEHPK3PXP"}
+	key, err := TOTPKey("go-wiki", u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Secret() != u.TOTPSecret || key.Issuer() != "go-wiki" || key.AccountName() != u.Email {
+		t.Errorf("unexpected key: %s", key)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for i, c := range codes {
+		if len(c) != 11 || c[5] != '-' {
+			t.Errorf("unexpected code: %s", c)
+		}
+		if seen[c] {
+			t.Errorf("duplicated code: %s", c)
+		}
+		seen[c] = true
+		if hashes[i] == c || hashes[i] != HashRecoveryCode(strings.ToUpper(strings.Replace(c, "-", " ", 1))) {
+			t.Errorf("hash should ignore cases and separators: %s", c)
+		}
+	}
+}
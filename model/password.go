@@ -0,0 +1,58 @@
+package model
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashes are saved in salted column of users. The format is
+// versioned by its prefix: bcrypt hashes start with $2a$ followed by the
+// cost, like $2a$10$. Legacy hashes made by Stretch have no prefix, and
+// their salt is saved in salt column.
+
+// MaxPasswordLength is the maximum length of passwords in bytes, since
+// bcrypt refuses longer ones.
+const MaxPasswordLength = 72
+
+// ErrPasswordTooLong is returned when the password is longer than
+// MaxPasswordLength.
+var ErrPasswordTooLong = errors.New("password is too long")
+
+// passwordCost is the bcrypt cost of new hashes. Hashes with lower cost
+// are rehashed on login.
+var passwordCost = bcrypt.DefaultCost
+
+// HashPassword returns the hash of password to save in salted column.
+func HashPassword(password string) (string, error) {
+	if len(password) > MaxPasswordLength {
+		return "", ErrPasswordTooLong
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// CheckPassword reports whether password matches the hash, which is made
+// with salt if it is a legacy one. rehash is true if the password matches
+// but the hash should be replaced by HashPassword.
+func CheckPassword(hash, salt, password string) (ok, rehash bool) {
+	if !strings.HasPrefix(hash, "$") {
+		ok = subtle.ConstantTimeCompare([]byte(hash), []byte(Stretch(password, salt))) == 1
+		// legacy hashes of passwords too long for bcrypt are kept.
+		return ok, ok && len(password) <= MaxPasswordLength
+	}
+	if !strings.HasPrefix(hash, "$2") {
+		// unknown scheme.
+		return false, false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, err != nil || cost < passwordCost
+}
@@ -0,0 +1,119 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$2a$") {
+		t.Fatalf("want bcrypt hash, got %s", hash)
+	}
+	weak, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := Stretch("secret", "salt")
+	long := strings.Repeat("a", 100)
+	longLegacy := Stretch(long, "salt")
+
+	tests := []struct {
+		hash, salt, password string
+		ok, rehash           bool
+	}{
+		{hash, "", "secret", true, false},
+		{hash, "", "wrong", false, false},
+		{string(weak), "", "secret", true, true},
+		{legacy, "salt", "secret", true, true},
+		{legacy, "salt", "wrong", false, false},
+		{legacy, "pepper", "secret", false, false},
+		{"$unknown$" + legacy, "salt", "secret", false, false},
+		// bcrypt can not hash it, so the legacy hash is kept.
+		{longLegacy, "salt", long, true, false},
+	}
+	for i, tt := range tests {
+		ok, rehash := CheckPassword(tt.hash, tt.salt, tt.password)
+		if ok != tt.ok || rehash != tt.rehash {
+			t.Errorf("%d: want (%t, %t), got (%t, %t)", i, tt.ok, tt.rehash, ok, rehash)
+		}
+	}
+}
+
+func TestHashPasswordTooLong(t *testing.T) {
+	if _, err := HashPassword(strings.Repeat("a", 100)); err != ErrPasswordTooLong {
+		t.Errorf("want ErrPasswordTooLong, got %v", err)
+	}
+	if _, err := HashPassword(strings.Repeat("a", MaxPasswordLength)); err != nil {
+		t.Errorf("hashing password of the maximum length failed: %s", err)
+	}
+}
+
+func TestSalt(t *testing.T) {
+	a, err := Salt(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Salt(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 32 || a == b {
+		t.Errorf("unexpected salts: %s, %s", a, b)
+	}
+}
+
+func TestAuthRehash(t *testing.T) {
+	stores := map[string]func(t *testing.T) (Store, func(id int64, salt, salted string)){
+		"memory": func(t *testing.T) (Store, func(int64, string, string)) {
+			s := NewMemoryStore()
+			return s, func(id int64, salt, salted string) {
+				u := s.users[id]
+				u.Salt, u.Salted = salt, salted
+				s.users[id] = u
+			}
+		},
+		"sqlite3": func(t *testing.T) (Store, func(int64, string, string)) {
+			s := openSQLite(t)
+			return s, func(id int64, salt, salted string) {
+				if _, err := s.DB.Exec(`update users set salt = ?, salted = ? where user_id = ?`, salt, salted, id); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+	}
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			s, setHash := open(t)
+			defer s.Close()
+			u := User{Name: "alice", Email: "alice@example.com"}
+			if err := s.InsertUser(&u, "secret"); err != nil {
+				t.Fatal(err)
+			}
+			// users signed up before bcrypt have hashes made by Stretch.
+			setHash(u.ID, "salt", Stretch("secret", "salt"))
+
+			if _, err := s.Auth("alice@example.com", "wrong"); err != ErrPasswordUnmatch {
+				t.Fatalf("want ErrPasswordUnmatch, got %v", err)
+			}
+			if _, err := s.Auth("alice@example.com", "secret"); err != nil {
+				t.Fatalf("auth with legacy hash failed: %s", err)
+			}
+			got, err := s.UserOne(u.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Salt != "" || !strings.HasPrefix(got.Salted, "$2a$") {
+				t.Errorf("legacy hash should be replaced: %+v", got)
+			}
+			if _, err := s.Auth("alice@example.com", "secret"); err != nil {
+				t.Errorf("auth after rehash failed: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PasswordResetTTL is how long tokens to reset passwords are valid.
+const PasswordResetTTL = time.Hour
+
+// NewPasswordReset returns new token to reset password of the user, which
+// expires after ttl, and the token string to send to the user.
+// The token string is not saved; only its hash is.
+func NewPasswordReset(userID int64, ttl time.Duration) (*PasswordReset, string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	expires := time.Now().Add(ttl).UTC()
+	return &PasswordReset{
+		UserID:  userID,
+		Hash:    HashPasswordResetToken(token),
+		Expires: &expires,
+	}, token, nil
+}
+
+// HashPasswordResetToken returns hash of the token to save and look up.
+func HashPasswordResetToken(token string) string {
+	return hashToken(token)
+}
+
+// Usable reports whether the token is neither used nor expired at now.
+func (t *PasswordReset) Usable(now time.Time) bool {
+	return t.Used == nil && t.Expires != nil && now.Before(*t.Expires)
+}
+
+// PasswordResetByHash returns the token for given hash.
+func PasswordResetByHash(db *sql.DB, hash string) (PasswordReset, error) {
+	return ScanPasswordReset(db.QueryRow(`select * from password_resets where token_hash = ?`, hash))
+}
+
+// Insert inserts new token.
+func (t *PasswordReset) Insert(tx *sql.Tx) (sql.Result, error) {
+	stmt, err := tx.Prepare(`
+	insert into password_resets (user_id, token_hash, expires)
+	values(?, ?, ?)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	return stmt.Exec(t.UserID, t.Hash, t.Expires)
+}
+
+// Use marks the token used. It affects no rows if the token is already used,
+// so that the token can be used only once.
+func (t *PasswordReset) Use(tx *sql.Tx) (sql.Result, error) {
+	return tx.Exec(`update password_resets set used = ? where reset_id = ? and used is null`,
+		time.Now().UTC(), t.ID)
+}
+
+// UsePasswordResets marks all tokens of the user used.
+func UsePasswordResets(tx *sql.Tx, userID int64) (sql.Result, error) {
+	return tx.Exec(`update password_resets set used = ? where user_id = ? and used is null`,
+		time.Now().UTC(), userID)
+}
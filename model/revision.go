@@ -0,0 +1,63 @@
+package model
+
+import "database/sql"
+
+// RevisionsByArticle returns all revisions of the article, newest first.
+func RevisionsByArticle(db *sql.DB, articleID int64) ([]Revision, error) {
+	rows, err := db.Query(`
+	select * from article_revisions
+		where article_id = ?
+		order by revision desc
+	`, articleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return ScanRevisions(rows)
+}
+
+// RevisionOne returns the revision of the article for given revision number.
+func RevisionOne(db *sql.DB, articleID, revision int64) (Revision, error) {
+	return ScanRevision(db.QueryRow(`
+	select * from article_revisions
+		where article_id = ? and revision = ?
+	`, articleID, revision))
+}
+
+// LatestRevision returns the newest revision of the article.
+func LatestRevision(db *sql.DB, articleID int64) (Revision, error) {
+	return ScanRevision(db.QueryRow(`
+	select * from article_revisions
+		where article_id = ?
+		order by revision desc
+		limit 1
+	`, articleID))
+}
+
+// latestRevisionNumber returns the newest revision number of the article
+// in the transaction. It is 0 if the article has no revision.
+func latestRevisionNumber(tx *sql.Tx, articleID int64) (int64, error) {
+	var rev int64
+	err := tx.QueryRow(`
+	select coalesce(max(revision), 0) from article_revisions
+		where article_id = ?
+	`, articleID).Scan(&rev)
+	return rev, err
+}
+
+// InsertRevision records current title and body of the article
+// as its next revision. userID is who made the change, and revertedFrom
+// is the revision restored by the change if it is a revert, otherwise 0.
+func (t *Article) InsertRevision(tx *sql.Tx, userID, revertedFrom int64) (sql.Result, error) {
+	stmt, err := tx.Prepare(`
+	insert into article_revisions (article_id, revision, title, body, user_id, reverted_from)
+		select ?, coalesce(max(revision), 0) + 1, ?, ?, ?, ?
+		from article_revisions
+		where article_id = ?
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	return stmt.Exec(t.ID, t.Title, t.Body, userID, revertedFrom, t.ID)
+}
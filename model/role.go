@@ -0,0 +1,59 @@
+package model
+
+// Roles of users.
+const (
+	// RoleViewer can only read articles.
+	RoleViewer = "viewer"
+	// RoleEditor can create and edit articles.
+	RoleEditor = "editor"
+	// RoleAdmin can do everything, including deleting articles
+	// and managing roles of users.
+	RoleAdmin = "admin"
+)
+
+// Roles lists roles from the least privileged.
+var Roles = []string{RoleViewer, RoleEditor, RoleAdmin}
+
+// Permission is a kind of operation allowed to some roles.
+type Permission string
+
+// Permissions checked by handlers.
+const (
+	// PermEdit is for creating, editing and reverting articles.
+	PermEdit Permission = "edit"
+	// PermDelete is for deleting articles.
+	PermDelete Permission = "delete"
+	// PermAdmin is for managing users.
+	PermAdmin Permission = "admin"
+)
+
+// permissionRoles maps permissions to the least privileged roles having them.
+var permissionRoles = map[Permission]string{
+	PermEdit:   RoleEditor,
+	PermDelete: RoleAdmin,
+	PermAdmin:  RoleAdmin,
+}
+
+// roleRank returns the rank of the role, which is higher for more
+// privileged role. Unknown roles have no privilege.
+func roleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// IsRole reports whether role is one of Roles.
+func IsRole(role string) bool {
+	return roleRank(role) > 0
+}
+
+// Can reports whether the user has the permission by the role.
+// Users who have not verified their email addresses have no permission
+// unless they are admins.
+func (u *User) Can(p Permission) bool {
+	role, ok := permissionRoles[p]
+	return ok && roleRank(u.Role) >= roleRank(role) && (u.EmailVerified || u.Role == RoleAdmin)
+}
@@ -0,0 +1,40 @@
+package model
+
+import "testing"
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		role string
+		perm Permission
+		want bool
+	}{
+		{RoleViewer, PermEdit, false},
+		{RoleEditor, PermEdit, true},
+		{RoleEditor, PermDelete, false},
+		{RoleAdmin, PermDelete, true},
+		{RoleAdmin, PermAdmin, true},
+		{"", PermEdit, false},
+		{RoleAdmin, Permission("unknown"), false},
+	}
+	for _, tt := range tests {
+		u := User{Role: tt.role, EmailVerified: true}
+		if got := u.Can(tt.perm); got != tt.want {
+			t.Errorf("%q can %s: want %v, got %v", tt.role, tt.perm, tt.want, got)
+		}
+	}
+}
+
+func TestCanUnverified(t *testing.T) {
+	editor := User{Role: RoleEditor}
+	if editor.Can(PermEdit) {
+		t.Error("unverified editor should not edit")
+	}
+	admin := User{Role: RoleAdmin}
+	if !admin.Can(PermDelete) {
+		t.Error("unverified admin should be able to delete")
+	}
+	granted := Access{Restricted: true, Granted: PermEdit}
+	if !granted.Allows(&editor, PermRead) || granted.Allows(&editor, PermEdit) {
+		t.Error("unverified editor should only read even if granted")
+	}
+}
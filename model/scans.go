@@ -14,6 +14,11 @@ func ScanUser(r *sql.Row) (User, error) {
 		&s.Salted,
 		&s.Created,
 		&s.Updated,
+		&s.Role,
+		&s.EmailVerified,
+		&s.TOTPSecret,
+		&s.MFAEnabled,
+		&s.TOTPCounter,
 	); err != nil {
 		return User{}, err
 	}
@@ -33,6 +38,11 @@ func ScanUsers(rs *sql.Rows) ([]User, error) {
 			&s.Salted,
 			&s.Created,
 			&s.Updated,
+			&s.Role,
+			&s.EmailVerified,
+			&s.TOTPSecret,
+			&s.MFAEnabled,
+			&s.TOTPCounter,
 		); err != nil {
 			return nil, err
 		}
@@ -52,6 +62,8 @@ func ScanArticle(r *sql.Row) (Article, error) {
 		&s.Body,
 		&s.Created,
 		&s.Updated,
+		&s.AuthorID,
+		&s.LastEditorID,
 	); err != nil {
 		return Article{}, err
 	}
@@ -69,6 +81,8 @@ func ScanArticles(rs *sql.Rows) ([]Article, error) {
 			&s.Body,
 			&s.Created,
 			&s.Updated,
+			&s.AuthorID,
+			&s.LastEditorID,
 		); err != nil {
 			return nil, err
 		}
@@ -80,3 +94,268 @@ func ScanArticles(rs *sql.Rows) ([]Article, error) {
 	return structs, nil
 }
 
+func ScanRevision(r *sql.Row) (Revision, error) {
+	var s Revision
+	if err := r.Scan(
+		&s.ID,
+		&s.ArticleID,
+		&s.Revision,
+		&s.Title,
+		&s.Body,
+		&s.UserID,
+		&s.Created,
+		&s.RevertedFrom,
+	); err != nil {
+		return Revision{}, err
+	}
+	return s, nil
+}
+
+func ScanRevisions(rs *sql.Rows) ([]Revision, error) {
+	structs := make([]Revision, 0, 16)
+	var err error
+	for rs.Next() {
+		var s Revision
+		if err = rs.Scan(
+			&s.ID,
+			&s.ArticleID,
+			&s.Revision,
+			&s.Title,
+			&s.Body,
+			&s.UserID,
+			&s.Created,
+			&s.RevertedFrom,
+		); err != nil {
+			return nil, err
+		}
+		structs = append(structs, s)
+	}
+	if err = rs.Err(); err != nil {
+		return nil, err
+	}
+	return structs, nil
+}
+
+func ScanAccessToken(r *sql.Row) (AccessToken, error) {
+	var s AccessToken
+	if err := r.Scan(
+		&s.ID,
+		&s.UserID,
+		&s.Name,
+		&s.Hash,
+		&s.Created,
+		&s.LastUsed,
+	); err != nil {
+		return AccessToken{}, err
+	}
+	return s, nil
+}
+
+func ScanAccessTokens(rs *sql.Rows) ([]AccessToken, error) {
+	structs := make([]AccessToken, 0, 16)
+	var err error
+	for rs.Next() {
+		var s AccessToken
+		if err = rs.Scan(
+			&s.ID,
+			&s.UserID,
+			&s.Name,
+			&s.Hash,
+			&s.Created,
+			&s.LastUsed,
+		); err != nil {
+			return nil, err
+		}
+		structs = append(structs, s)
+	}
+	if err = rs.Err(); err != nil {
+		return nil, err
+	}
+	return structs, nil
+}
+
+func ScanGroup(r *sql.Row) (Group, error) {
+	var s Group
+	if err := r.Scan(
+		&s.ID,
+		&s.Name,
+		&s.Created,
+	); err != nil {
+		return Group{}, err
+	}
+	return s, nil
+}
+
+func ScanGroups(rs *sql.Rows) ([]Group, error) {
+	structs := make([]Group, 0, 16)
+	var err error
+	for rs.Next() {
+		var s Group
+		if err = rs.Scan(
+			&s.ID,
+			&s.Name,
+			&s.Created,
+		); err != nil {
+			return nil, err
+		}
+		structs = append(structs, s)
+	}
+	if err = rs.Err(); err != nil {
+		return nil, err
+	}
+	return structs, nil
+}
+
+func ScanACL(r *sql.Row) (ACL, error) {
+	var s ACL
+	if err := r.Scan(
+		&s.ID,
+		&s.ArticleID,
+		&s.Namespace,
+		&s.UserID,
+		&s.GroupID,
+		&s.Permission,
+		&s.Created,
+	); err != nil {
+		return ACL{}, err
+	}
+	return s, nil
+}
+
+func ScanACLs(rs *sql.Rows) ([]ACL, error) {
+	structs := make([]ACL, 0, 16)
+	var err error
+	for rs.Next() {
+		var s ACL
+		if err = rs.Scan(
+			&s.ID,
+			&s.ArticleID,
+			&s.Namespace,
+			&s.UserID,
+			&s.GroupID,
+			&s.Permission,
+			&s.Created,
+		); err != nil {
+			return nil, err
+		}
+		structs = append(structs, s)
+	}
+	if err = rs.Err(); err != nil {
+		return nil, err
+	}
+	return structs, nil
+}
+
+func ScanPasswordReset(r *sql.Row) (PasswordReset, error) {
+	var s PasswordReset
+	if err := r.Scan(
+		&s.ID,
+		&s.UserID,
+		&s.Hash,
+		&s.Expires,
+		&s.Used,
+		&s.Created,
+	); err != nil {
+		return PasswordReset{}, err
+	}
+	return s, nil
+}
+
+func ScanPasswordResets(rs *sql.Rows) ([]PasswordReset, error) {
+	structs := make([]PasswordReset, 0, 16)
+	var err error
+	for rs.Next() {
+		var s PasswordReset
+		if err = rs.Scan(
+			&s.ID,
+			&s.UserID,
+			&s.Hash,
+			&s.Expires,
+			&s.Used,
+			&s.Created,
+		); err != nil {
+			return nil, err
+		}
+		structs = append(structs, s)
+	}
+	if err = rs.Err(); err != nil {
+		return nil, err
+	}
+	return structs, nil
+}
+
+func ScanEmailVerification(r *sql.Row) (EmailVerification, error) {
+	var s EmailVerification
+	if err := r.Scan(
+		&s.ID,
+		&s.UserID,
+		&s.Email,
+		&s.Hash,
+		&s.Expires,
+		&s.Used,
+		&s.Created,
+	); err != nil {
+		return EmailVerification{}, err
+	}
+	return s, nil
+}
+
+func ScanEmailVerifications(rs *sql.Rows) ([]EmailVerification, error) {
+	structs := make([]EmailVerification, 0, 16)
+	var err error
+	for rs.Next() {
+		var s EmailVerification
+		if err = rs.Scan(
+			&s.ID,
+			&s.UserID,
+			&s.Email,
+			&s.Hash,
+			&s.Expires,
+			&s.Used,
+			&s.Created,
+		); err != nil {
+			return nil, err
+		}
+		structs = append(structs, s)
+	}
+	if err = rs.Err(); err != nil {
+		return nil, err
+	}
+	return structs, nil
+}
+
+func ScanIdentity(r *sql.Row) (Identity, error) {
+	var s Identity
+	if err := r.Scan(
+		&s.ID,
+		&s.UserID,
+		&s.Issuer,
+		&s.Subject,
+		&s.Created,
+	); err != nil {
+		return Identity{}, err
+	}
+	return s, nil
+}
+
+func ScanIdentitys(rs *sql.Rows) ([]Identity, error) {
+	structs := make([]Identity, 0, 16)
+	var err error
+	for rs.Next() {
+		var s Identity
+		if err = rs.Scan(
+			&s.ID,
+			&s.UserID,
+			&s.Issuer,
+			&s.Subject,
+			&s.Created,
+		); err != nil {
+			return nil, err
+		}
+		structs = append(structs, s)
+	}
+	if err = rs.Err(); err != nil {
+		return nil, err
+	}
+	return structs, nil
+}
@@ -0,0 +1,739 @@
+package model
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SQLStore is a Store backed by SQL database.
+// Both MySQL and SQLite are supported, since queries are written in
+// the common subset of them.
+type SQLStore struct {
+	DB *sql.DB
+	// Dialect is name of the database, such as mysql or sqlite3.
+	Dialect string
+}
+
+// NewSQLStore returns a store for the database.
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{DB: db, Dialect: dialect}
+}
+
+// Close closes the database.
+func (s *SQLStore) Close() error {
+	return s.DB.Close()
+}
+
+// TXHandler is handler for working with transaction.
+// This is wrapper function for commit and rollback.
+// f should commit the transaction, otherwise it is rolled back.
+func TXHandler(db *sql.DB, f func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "start transaction failed")
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			log.Print("rollback operation.")
+			panic(err)
+		}
+	}()
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "transaction: operation failed")
+	}
+	return nil
+}
+
+func (s *SQLStore) ArticlesAll(p Principal) ([]Article, error) {
+	return ArticlesAll(s.DB, p)
+}
+
+func (s *SQLStore) ArticlesPage(p Principal, sort string, offset, limit int) ([]Article, error) {
+	return ArticlesPage(s.DB, p, sort, offset, limit)
+}
+
+func (s *SQLStore) ArticlesCount(p Principal) (int, error) {
+	return ArticlesCount(s.DB, p)
+}
+
+func (s *SQLStore) ArticlesByAuthor(p Principal, userID int64) ([]Article, error) {
+	return ArticlesByAuthor(s.DB, p, userID)
+}
+
+func (s *SQLStore) ArticleOne(p Principal, id int64) (Article, error) {
+	return ArticleOne(s.DB, p, id)
+}
+
+func (s *SQLStore) ArticleIDsByTitles(titles []string) (map[string]int64, error) {
+	return ArticleIDsByTitles(s.DB, titles)
+}
+
+func (s *SQLStore) Revisions(articleID int64) ([]Revision, error) {
+	return RevisionsByArticle(s.DB, articleID)
+}
+
+func (s *SQLStore) RevisionOne(articleID, revision int64) (Revision, error) {
+	return RevisionOne(s.DB, articleID, revision)
+}
+
+func (s *SQLStore) LatestRevision(articleID int64) (Revision, error) {
+	return LatestRevision(s.DB, articleID)
+}
+
+func (s *SQLStore) Backlinks(p Principal, id int64, title string) ([]Article, error) {
+	return Backlinks(s.DB, p, id, title)
+}
+
+func (s *SQLStore) OrphanArticles(p Principal) ([]Article, error) {
+	return OrphanArticles(s.DB, p)
+}
+
+func (s *SQLStore) BrokenLinks(p Principal) ([]BrokenLink, error) {
+	return BrokenLinks(s.DB, p)
+}
+
+func (s *SQLStore) ArticleAccess(p Principal, a Article) (Access, error) {
+	return ArticleAccess(s.DB, p, a)
+}
+
+func (s *SQLStore) HiddenArticleIDs(p Principal) (map[int64]bool, error) {
+	return HiddenArticleIDs(s.DB, p)
+}
+
+func (s *SQLStore) InsertArticle(a *Article, e Edit) error {
+	a.AuthorID, a.LastEditorID = e.UserID, e.UserID
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		result, err := a.Insert(tx)
+		if err != nil {
+			return err
+		}
+		if a.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		if err := a.record(tx, e); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) UpdateArticle(a *Article, e Edit) error {
+	a.LastEditorID = e.UserID
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		exists, err := s.lockArticle(tx, a.ID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		// the article is locked, so that concurrent edits on the same base
+		// wait here and then find the revision of the first one.
+		if e.BaseRevision != 0 {
+			latest, err := latestRevisionNumber(tx, a.ID)
+			if err != nil {
+				return err
+			}
+			if latest != e.BaseRevision {
+				return ErrConflict
+			}
+		}
+		if _, err := a.Update(tx); err != nil {
+			return err
+		}
+		if err := a.record(tx, e); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// lockArticle locks the article until the transaction ends, and reports
+// whether it exists.
+func (s *SQLStore) lockArticle(tx *sql.Tx, id int64) (bool, error) {
+	if s.Dialect == "sqlite3" {
+		// SQLite locks the whole database for writes, as lockedUsersCount.
+		result, err := tx.Exec(`update articles set article_id = article_id where article_id = ?`, id)
+		if err != nil {
+			return false, err
+		}
+		n, err := result.RowsAffected()
+		return n > 0, err
+	}
+	var count int64
+	err := tx.QueryRow(`select count(*) from articles where article_id = ? for update`, id).Scan(&count)
+	return count > 0, err
+}
+
+// record saves revision and links of the article for the edit.
+func (t *Article) record(tx *sql.Tx, e Edit) error {
+	if _, err := t.InsertRevision(tx, e.UserID, e.RevertedFrom); err != nil {
+		return err
+	}
+	return t.SaveLinks(tx, e.LinkIDs, e.LinkTitles)
+}
+
+func (s *SQLStore) SaveLinks(a Article, ids []int64, titles []string) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		if err := a.SaveLinks(tx, ids, titles); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) DeleteArticle(id int64) error {
+	article := Article{ID: id}
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		if _, err := article.Delete(tx); err != nil {
+			return err
+		}
+		if err := article.DeleteLinks(tx); err != nil {
+			return err
+		}
+		if _, err := DeleteArticleACLs(tx, id); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) UserOne(id int64) (User, error) {
+	return UserOne(s.DB, id)
+}
+
+func (s *SQLStore) UserByEmail(email string) (User, error) {
+	return UserByEmail(s.DB, email)
+}
+
+func (s *SQLStore) UserExists(email string) (bool, error) {
+	return UserExists(s.DB, email)
+}
+
+func (s *SQLStore) UserNames(ids []int64) (map[int64]string, error) {
+	return UserNames(s.DB, ids)
+}
+
+func (s *SQLStore) UsersAll() ([]User, error) {
+	return UsersAll(s.DB)
+}
+
+// lockedUsersCount counts users, locking users until the transaction ends,
+// so that concurrent signups cannot both find no users and become admins.
+func (s *SQLStore) lockedUsersCount(tx *sql.Tx) (int, error) {
+	if s.Dialect == "sqlite3" {
+		// SQLite locks the whole database for writes. Writing nothing takes
+		// the lock before counting, as begin immediate does.
+		if _, err := tx.Exec(`update users set user_id = user_id where 0`); err != nil {
+			return 0, err
+		}
+		return UsersCount(tx)
+	}
+	var count int
+	err := tx.QueryRow(`select count(*) from users for update`).Scan(&count)
+	return count, err
+}
+
+func (s *SQLStore) InsertUser(u *User, password string) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		count, err := s.lockedUsersCount(tx)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			u.Role = RoleAdmin
+		}
+		result, err := u.Insert(tx, password)
+		if err != nil {
+			return err
+		}
+		if u.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) UpdateUser(u *User) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		if _, err := u.Update(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) UpdateUserRole(id int64, role string) error {
+	u := User{ID: id, Role: role}
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		if _, err := u.UpdateRole(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) Auth(email, password string) (User, error) {
+	return Auth(s.DB, email, password)
+}
+
+func (s *SQLStore) AccessTokens(userID int64) ([]AccessToken, error) {
+	return AccessTokensByUser(s.DB, userID)
+}
+
+func (s *SQLStore) InsertAccessToken(t *AccessToken) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		result, err := t.Insert(tx)
+		if err != nil {
+			return err
+		}
+		if t.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) DeleteAccessToken(userID, id int64) error {
+	t := AccessToken{ID: id, UserID: userID}
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		if _, err := t.Delete(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) UserByAccessToken(hash string) (User, error) {
+	t, err := AccessTokenByHash(s.DB, hash)
+	if err != nil {
+		return User{}, err
+	}
+	if err := TXHandler(s.DB, func(tx *sql.Tx) error {
+		if _, err := t.Touch(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}); err != nil {
+		return User{}, err
+	}
+	return UserOne(s.DB, t.UserID)
+}
+
+func (s *SQLStore) InsertPasswordReset(t *PasswordReset) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		result, err := t.Insert(tx)
+		if err != nil {
+			return err
+		}
+		if t.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) PasswordResetByHash(hash string) (PasswordReset, error) {
+	t, err := PasswordResetByHash(s.DB, hash)
+	if err != nil {
+		return PasswordReset{}, err
+	}
+	if !t.Usable(time.Now()) {
+		return PasswordReset{}, ErrNotFound
+	}
+	return t, nil
+}
+
+func (s *SQLStore) ResetPassword(hash, password string) (User, error) {
+	t, err := s.PasswordResetByHash(hash)
+	if err != nil {
+		return User{}, err
+	}
+	u, err := UserOne(s.DB, t.UserID)
+	if err != nil {
+		return User{}, err
+	}
+	if err := TXHandler(s.DB, func(tx *sql.Tx) error {
+		result, err := t.Use(tx)
+		if err != nil {
+			return err
+		}
+		// the token has been used by another request since read.
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		if _, err := UsePasswordResets(tx, u.ID); err != nil {
+			return err
+		}
+		if _, err := u.UpdatePassword(tx, password); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}); err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+func (s *SQLStore) InsertEmailVerification(t *EmailVerification) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		result, err := t.Insert(tx)
+		if err != nil {
+			return err
+		}
+		if t.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) VerifyEmail(hash string) (User, error) {
+	t, err := EmailVerificationByHash(s.DB, hash)
+	if err != nil {
+		return User{}, err
+	}
+	if !t.Usable(time.Now()) {
+		return User{}, ErrNotFound
+	}
+	u, err := UserOne(s.DB, t.UserID)
+	if err != nil {
+		return User{}, err
+	}
+	// the token was sent to the address the user no longer has.
+	if u.Email != t.Email {
+		return User{}, ErrNotFound
+	}
+	if err := TXHandler(s.DB, func(tx *sql.Tx) error {
+		result, err := t.Use(tx)
+		if err != nil {
+			return err
+		}
+		// the token has been used by another request since read.
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		if _, err := VerifyEmail(tx, u.ID, u.Email); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}); err != nil {
+		return User{}, err
+	}
+	return UserOne(s.DB, t.UserID)
+}
+
+func (s *SQLStore) PurgeUnverifiedUsers(before time.Time) (int, error) {
+	users, err := UnverifiedUsers(s.DB)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = TXHandler(s.DB, func(tx *sql.Tx) error {
+		for _, u := range users {
+			if u.Role == RoleAdmin || u.Created == nil || !u.Created.Before(before) {
+				continue
+			}
+			err := u.Delete(tx)
+			if err == ErrInUse {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			n++
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *SQLStore) SetTOTPSecret(userID int64, secret string) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		if _, err := SetTOTPSecret(tx, userID, secret); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) EnableMFA(userID, counter int64, recoveryHashes []string) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		result, err := EnableMFA(tx, userID, counter)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		if err := ReplaceRecoveryCodes(tx, userID, recoveryHashes); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) DisableMFA(userID int64) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		if err := DisableMFA(tx, userID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) UseTOTP(userID, counter int64) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		result, err := UseTOTPCounter(tx, userID, counter)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrConflict
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) UseRecoveryCode(userID int64, hash string) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		result, err := UseRecoveryCode(tx, userID, hash)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) RecoveryCodesLeft(userID int64) (int, error) {
+	return RecoveryCodesLeft(s.DB, userID)
+}
+
+func (s *SQLStore) ReplaceRecoveryCodes(userID int64, hashes []string) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		if err := ReplaceRecoveryCodes(tx, userID, hashes); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) Setting(name string) (string, error) {
+	return Setting(s.DB, name)
+}
+
+func (s *SQLStore) SetSetting(name, value string) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		if err := SetSetting(tx, name, value); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) UserByIdentity(issuer, subject string) (User, error) {
+	return UserByIdentity(s.DB, issuer, subject)
+}
+
+func (s *SQLStore) InsertIdentity(i *Identity) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		if err := insertIdentity(tx, i); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// insertIdentity inserts the identity unless it is linked to any user.
+func insertIdentity(tx *sql.Tx, i *Identity) error {
+	exists, err := IdentityExists(tx, i.Issuer, i.Subject)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrDuplicated
+	}
+	result, err := i.Insert(tx)
+	if err != nil {
+		return err
+	}
+	i.ID, err = result.LastInsertId()
+	return err
+}
+
+func (s *SQLStore) ProvisionUser(u *User, i *Identity) error {
+	password, err := randomToken()
+	if err != nil {
+		return err
+	}
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		count, err := s.lockedUsersCount(tx)
+		if err != nil {
+			return err
+		}
+		taken, err := emailTaken(tx, u.Email)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrDuplicated
+		}
+		if count == 0 {
+			u.Role = RoleAdmin
+		}
+		result, err := u.Insert(tx, password)
+		if err != nil {
+			return err
+		}
+		if u.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		i.UserID = u.ID
+		if err := insertIdentity(tx, i); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) GroupsAll() ([]Group, error) {
+	return GroupsAll(s.DB)
+}
+
+func (s *SQLStore) GroupOne(id int64) (Group, error) {
+	return GroupOne(s.DB, id)
+}
+
+func (s *SQLStore) GroupsByUser(userID int64) ([]Group, error) {
+	return GroupsByUser(s.DB, userID)
+}
+
+func (s *SQLStore) GroupMembers(groupID int64) ([]User, error) {
+	return GroupMembers(s.DB, groupID)
+}
+
+func (s *SQLStore) InsertGroup(g *Group) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		taken, err := groupNameTaken(tx, g.Name, 0)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrDuplicated
+		}
+		result, err := g.Insert(tx)
+		if err != nil {
+			return err
+		}
+		if g.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) UpdateGroup(g *Group) error {
+	if _, err := GroupOne(s.DB, g.ID); err != nil {
+		return err
+	}
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		taken, err := groupNameTaken(tx, g.Name, g.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrDuplicated
+		}
+		if _, err := g.Update(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) DeleteGroup(id int64) error {
+	g := Group{ID: id}
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		if err := g.Delete(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) AddGroupMember(groupID, userID int64) error {
+	if _, err := GroupOne(s.DB, groupID); err != nil {
+		return err
+	}
+	if _, err := UserOne(s.DB, userID); err != nil {
+		return err
+	}
+	g := Group{ID: groupID}
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		if err := g.AddMember(tx, userID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) RemoveGroupMember(groupID, userID int64) error {
+	g := Group{ID: groupID}
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		if _, err := g.RemoveMember(tx, userID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) ACLsAll() ([]ACL, error) {
+	return ACLsAll(s.DB)
+}
+
+func (s *SQLStore) ACLsByArticle(a Article) ([]ACL, error) {
+	return ACLsByArticle(s.DB, a)
+}
+
+func (s *SQLStore) InsertACL(acl *ACL) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		result, err := acl.Insert(tx)
+		if err != nil {
+			return err
+		}
+		if acl.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (s *SQLStore) DeleteACL(id int64) error {
+	return TXHandler(s.DB, func(tx *sql.Tx) error {
+		if _, err := DeleteACL(tx, id); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
@@ -0,0 +1,264 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by stores when the record does not exist.
+	// It is the same as sql.ErrNoRows for compatibility with SQL stores.
+	ErrNotFound = sql.ErrNoRows
+	// ErrDuplicated is returned by stores when unique key is duplicated.
+	ErrDuplicated = errors.New("duplicated")
+	// ErrConflict is returned by stores when the article has been changed
+	// since the revision the edit is based on, or when a TOTP code is
+	// used again.
+	ErrConflict = errors.New("conflict")
+	// ErrInUse is returned by stores when the record is still referred,
+	// such as groups named by ACL entries.
+	ErrInUse = errors.New("in use")
+)
+
+// Store is the storage of the wiki.
+type Store interface {
+	ArticleStore
+	UserStore
+	AccessTokenStore
+	PasswordResetStore
+	EmailVerificationStore
+	MFAStore
+	SettingStore
+	IdentityStore
+	GroupStore
+	ACLStore
+	Close() error
+}
+
+// Edit describes a change to an article.
+type Edit struct {
+	// UserID is who made the change.
+	UserID int64
+	// RevertedFrom is the revision restored by the change if it is a revert.
+	RevertedFrom int64
+	// BaseRevision is the revision the change is based on. If the article
+	// has newer revision, the change is rejected by ErrConflict.
+	// 0 means no check.
+	BaseRevision int64
+	// LinkIDs and LinkTitles are articles linked from the new body,
+	// by their URLs and by wiki links respectively.
+	LinkIDs    []int64
+	LinkTitles []string
+}
+
+// ArticleStore stores articles with their revisions and links.
+// Methods taking Principal return only articles readable by it.
+type ArticleStore interface {
+	// ArticlesAll returns all articles.
+	ArticlesAll(p Principal) ([]Article, error)
+	// ArticlesPage returns at most limit articles from offset in the order
+	// of sort, one of SortUpdated, SortCreated and SortTitle.
+	ArticlesPage(p Principal, sort string, offset, limit int) ([]Article, error)
+	// ArticlesCount returns number of articles.
+	ArticlesCount(p Principal) (int, error)
+	// ArticlesByAuthor returns articles created by the user, newest first.
+	ArticlesByAuthor(p Principal, userID int64) ([]Article, error)
+	// ArticleOne returns the article for given id. Articles which can not
+	// be read are not found.
+	ArticleOne(p Principal, id int64) (Article, error)
+	// ArticleIDsByTitles returns ids of articles for given titles,
+	// keyed by title.
+	ArticleIDsByTitles(titles []string) (map[string]int64, error)
+
+	// Revisions returns all revisions of the article, newest first.
+	Revisions(articleID int64) ([]Revision, error)
+	// RevisionOne returns the revision of the article.
+	RevisionOne(articleID, revision int64) (Revision, error)
+	// LatestRevision returns the newest revision of the article.
+	LatestRevision(articleID int64) (Revision, error)
+
+	// Backlinks returns articles linking to the article.
+	Backlinks(p Principal, id int64, title string) ([]Article, error)
+	// OrphanArticles returns articles which no other article links to.
+	OrphanArticles(p Principal) ([]Article, error)
+	// BrokenLinks returns links to articles which do not exist,
+	// from articles readable by the principal.
+	BrokenLinks(p Principal) ([]BrokenLink, error)
+	// SaveLinks replaces links from the article, such as for articles saved
+	// before links were recorded.
+	SaveLinks(a Article, ids []int64, titles []string) error
+
+	// ArticleAccess returns what ACLs allow the principal to do with
+	// the article. The article may not exist yet, then ACLs of namespaces
+	// of its title apply.
+	ArticleAccess(p Principal, a Article) (Access, error)
+	// HiddenArticleIDs returns ids of articles the principal can not read.
+	HiddenArticleIDs(p Principal) (map[int64]bool, error)
+
+	// InsertArticle creates new article with its first revision and links.
+	// ID of the article is set after inserted. The user of the edit is
+	// recorded as the author.
+	InsertArticle(a *Article, e Edit) error
+	// UpdateArticle updates the article, and records its revision and links.
+	// The user of the edit is recorded as the last editor.
+	UpdateArticle(a *Article, e Edit) error
+	// DeleteArticle deletes the article, links from it and its ACL entries.
+	// Revisions are kept as the history.
+	DeleteArticle(id int64) error
+}
+
+// UserStore stores users.
+type UserStore interface {
+	// UserOne returns the user for given id.
+	UserOne(id int64) (User, error)
+	// UserByEmail returns the user for given email.
+	UserByEmail(email string) (User, error)
+	// UserExists reports whether the user of the email exists.
+	UserExists(email string) (bool, error)
+	// UserNames returns names of users for given ids.
+	UserNames(ids []int64) (map[int64]string, error)
+	// UsersAll returns all users ordered by id.
+	UsersAll() ([]User, error)
+	// InsertUser creates new user with the password.
+	// ID of the user is set after inserted. The first user becomes
+	// an admin, and others become editors unless the role is given.
+	InsertUser(u *User, password string) error
+	// UpdateUser updates name and email of the user.
+	UpdateUser(u *User) error
+	// UpdateUserRole updates role of the user.
+	UpdateUserRole(id int64, role string) error
+	// Auth authenticates the user by email and password.
+	Auth(email, password string) (User, error)
+}
+
+// AccessTokenStore stores personal access tokens of users.
+type AccessTokenStore interface {
+	// AccessTokens returns tokens of the user, newest first.
+	AccessTokens(userID int64) ([]AccessToken, error)
+	// InsertAccessToken saves the token. ID of the token is set after inserted.
+	InsertAccessToken(t *AccessToken) error
+	// DeleteAccessToken deletes the token of the user.
+	DeleteAccessToken(userID, id int64) error
+	// UserByAccessToken returns the owner of the token given by its hash,
+	// and records the use of the token.
+	UserByAccessToken(hash string) (User, error)
+}
+
+// PasswordResetStore stores one-time tokens to reset passwords.
+type PasswordResetStore interface {
+	// InsertPasswordReset saves the token. ID of the token is set after inserted.
+	InsertPasswordReset(t *PasswordReset) error
+	// PasswordResetByHash returns the token given by its hash.
+	// Used or expired tokens are not found.
+	PasswordResetByHash(hash string) (PasswordReset, error)
+	// ResetPassword sets the password of the owner of the token given by
+	// its hash, and uses up all tokens of the owner. Used or expired tokens
+	// are not found.
+	ResetPassword(hash, password string) (User, error)
+}
+
+// EmailVerificationStore stores one-time tokens to verify email addresses.
+type EmailVerificationStore interface {
+	// InsertEmailVerification saves the token. ID of the token is set after inserted.
+	InsertEmailVerification(t *EmailVerification) error
+	// VerifyEmail marks the email address of the owner of the token given
+	// by its hash verified, and uses up the token. Used or expired tokens,
+	// and tokens sent to addresses the owner no longer has, are not found.
+	VerifyEmail(hash string) (User, error)
+	// PurgeUnverifiedUsers deletes users who signed up before the time and
+	// have not verified their email addresses, except admins and users
+	// named by ACL entries.
+	// It returns the number of users deleted.
+	PurgeUnverifiedUsers(before time.Time) (int, error)
+}
+
+// MFAStore stores TOTP secrets and recovery codes of users for two-factor
+// authentication.
+type MFAStore interface {
+	// SetTOTPSecret sets the TOTP secret of the user to enroll. Two-factor
+	// authentication of the user is disabled until it is enabled by
+	// EnableMFA.
+	SetTOTPSecret(userID int64, secret string) error
+	// EnableMFA enables two-factor authentication of the user who confirmed
+	// the code of the time step, and replaces recovery codes of the user by
+	// ones given by their hashes. Users without secrets are not found.
+	EnableMFA(userID, counter int64, recoveryHashes []string) error
+	// DisableMFA disables two-factor authentication of the user, and
+	// deletes the secret and recovery codes.
+	DisableMFA(userID int64) error
+	// UseTOTP records the time step of the code the user used. It returns
+	// ErrConflict if a code of the step or later has been used, so that
+	// each code is used only once.
+	UseTOTP(userID, counter int64) error
+	// UseRecoveryCode uses up the recovery code of the user given by its
+	// hash. Used codes are not found.
+	UseRecoveryCode(userID int64, hash string) error
+	// RecoveryCodesLeft returns the number of unused recovery codes.
+	RecoveryCodesLeft(userID int64) (int, error)
+	// ReplaceRecoveryCodes replaces recovery codes of the user by ones
+	// given by their hashes.
+	ReplaceRecoveryCodes(userID int64, hashes []string) error
+}
+
+// SettingStore stores site-wide settings changed by admins.
+type SettingStore interface {
+	// Setting returns the value of the setting given by name.
+	// Settings not set are empty.
+	Setting(name string) (string, error)
+	// SetSetting sets the value of the setting.
+	SetSetting(name, value string) error
+}
+
+// IdentityStore stores identities of users at OpenID Connect providers.
+type IdentityStore interface {
+	// UserByIdentity returns the user of the identity given by the issuer
+	// and the subject.
+	UserByIdentity(issuer, subject string) (User, error)
+	// InsertIdentity links the identity to its user. ID of the identity is
+	// set after inserted. Identities are unique by issuer and subject.
+	InsertIdentity(i *Identity) error
+	// ProvisionUser creates the user who logs in by the identity, and links
+	// the identity to the user. The user gets a random password, so that
+	// the user can log in only by the identity until resetting it. Email
+	// addresses and identities used by others are duplicated.
+	ProvisionUser(u *User, i *Identity) error
+}
+
+// GroupStore stores groups of users and their members.
+type GroupStore interface {
+	// GroupsAll returns all groups ordered by name.
+	GroupsAll() ([]Group, error)
+	// GroupOne returns the group for given id.
+	GroupOne(id int64) (Group, error)
+	// GroupsByUser returns groups the user is member of, ordered by name.
+	GroupsByUser(userID int64) ([]Group, error)
+	// GroupMembers returns members of the group ordered by id.
+	GroupMembers(groupID int64) ([]User, error)
+	// InsertGroup creates new group. ID of the group is set after inserted.
+	// Names of groups are unique.
+	InsertGroup(g *Group) error
+	// UpdateGroup renames the group.
+	UpdateGroup(g *Group) error
+	// DeleteGroup deletes the group with its members. Groups named by ACL
+	// entries are not deleted and ErrInUse is returned, since deleting the
+	// entries may open restricted articles to everyone.
+	DeleteGroup(id int64) error
+	// AddGroupMember adds the user to the group.
+	AddGroupMember(groupID, userID int64) error
+	// RemoveGroupMember removes the user from the group.
+	RemoveGroupMember(groupID, userID int64) error
+}
+
+// ACLStore stores access control lists of articles and namespaces.
+type ACLStore interface {
+	// ACLsAll returns all entries ordered by articles and namespaces.
+	ACLsAll() ([]ACL, error)
+	// ACLsByArticle returns entries which apply to the article,
+	// including ones of its namespaces.
+	ACLsByArticle(a Article) ([]ACL, error)
+	// InsertACL saves the entry. ID of the entry is set after inserted.
+	InsertACL(acl *ACL) error
+	// DeleteACL deletes the entry.
+	DeleteACL(id int64) error
+}
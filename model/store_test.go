@@ -0,0 +1,926 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// openSQLite returns a store of in-memory SQLite database
+// migrated by migrations/sqlite3.
+func openSQLite(t *testing.T) *SQLStore {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open sqlite3 failed: %s", err)
+	}
+	// each connection has its own in-memory database.
+	db.SetMaxOpenConns(1)
+	migrateSQLite(t, db)
+	return NewSQLStore(db, "sqlite3")
+}
+
+// openSQLiteFile returns a store of SQLite database in a temporary file,
+// which is shared by connections unlike in-memory ones.
+func openSQLiteFile(t *testing.T) *SQLStore {
+	dir, err := ioutil.TempDir("", "wiki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "wiki.db")+"?_busy_timeout=10000")
+	if err != nil {
+		t.Fatalf("open sqlite3 failed: %s", err)
+	}
+	migrateSQLite(t, db)
+	return NewSQLStore(db, "sqlite3")
+}
+
+// migrateSQLite applies migrations/sqlite3 to the database.
+func migrateSQLite(t *testing.T, db *sql.DB) {
+	files, err := filepath.Glob("../migrations/sqlite3/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up := strings.SplitN(string(b), "-- +migrate Down", 2)[0]
+		if _, err := db.Exec(up); err != nil {
+			t.Fatalf("migrate %s failed: %s", f, err)
+		}
+	}
+}
+
+func TestPurgeDeletesSessions(t *testing.T) {
+	s := openSQLite(t)
+	defer s.Close()
+	admin := &User{Name: "admin", Email: "admin@example.com"}
+	bob := &User{Name: "bob", Email: "Bob@example.com"}
+	for _, u := range []*User{admin, bob} {
+		if err := s.InsertUser(u, "secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().UTC()
+	for _, u := range []*User{admin, bob} {
+		if _, err := s.DB.Exec(`insert into sessions (session_id, user_id, session_values, user_agent, ip, created, last_seen, expires) values(?, ?, ?, '', '', ?, ?, ?)`,
+			u.Name, u.ID, []byte{}, now, now, now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.DB.Exec(`insert into login_failures (failure_key, failures, last_failed) values(?, 1, ?)`,
+			"account:"+strings.ToLower(u.Email), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := s.PurgeUnverifiedUsers(time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("want 1 purged, got %d, %v", n, err)
+	}
+	for table, want := range map[string]int{"sessions": 1, "login_failures": 1} {
+		var count int
+		if err := s.DB.QueryRow(`select count(*) from ` + table).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != want {
+			t.Errorf("want %d rows of %s left, got %d", want, table, count)
+		}
+	}
+}
+
+func TestUpdateArticleConcurrent(t *testing.T) {
+	s := openSQLiteFile(t)
+	defer s.Close()
+	a := &Article{Title: "Go", Body: "v1"}
+	if err := s.InsertArticle(a, Edit{}); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 5)
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			edit := &Article{ID: a.ID, Title: "Go", Body: fmt.Sprintf("v2 by %d", i)}
+			errs <- s.UpdateArticle(edit, Edit{UserID: int64(i + 1), BaseRevision: 1})
+		}(i)
+	}
+	var saved, conflicts int
+	for i := 0; i < cap(errs); i++ {
+		switch err := <-errs; {
+		case err == nil:
+			saved++
+		case errors.Cause(err) == ErrConflict:
+			conflicts++
+		default:
+			t.Errorf("want ErrConflict, got %v", err)
+		}
+	}
+	if saved != 1 || conflicts != cap(errs)-1 {
+		t.Errorf("want 1 saved and others conflicted, got %d saved and %d conflicted", saved, conflicts)
+	}
+}
+
+func TestFirstUserAdminConcurrent(t *testing.T) {
+	s := openSQLiteFile(t)
+	defer s.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u := &User{Name: fmt.Sprintf("user%d", i), Email: fmt.Sprintf("user%d@example.com", i)}
+			var err error
+			// users sign up by passwords and single sign-on at the same time.
+			if i%2 == 0 {
+				err = s.InsertUser(u, "secret")
+			} else {
+				err = s.ProvisionUser(u, &Identity{Issuer: "https://idp.example.com", Subject: u.Name})
+			}
+			if err != nil {
+				t.Errorf("insert failed: %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	users, err := s.UsersAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	admins := 0
+	for _, u := range users {
+		if u.Role == RoleAdmin {
+			admins++
+		}
+	}
+	if len(users) != 5 || admins != 1 {
+		t.Errorf("want 1 admin of 5 users, got %d of %d", admins, len(users))
+	}
+}
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory":  func(t *testing.T) Store { return NewMemoryStore() },
+		"sqlite3": func(t *testing.T) Store { return openSQLite(t) },
+	}
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Run("Articles", func(t *testing.T) {
+				s := open(t)
+				defer s.Close()
+				testArticleStore(t, s)
+			})
+			t.Run("Pages", func(t *testing.T) {
+				s := open(t)
+				defer s.Close()
+				testArticlesPage(t, s)
+			})
+			t.Run("Users", func(t *testing.T) {
+				s := open(t)
+				defer s.Close()
+				testUserStore(t, s)
+			})
+			t.Run("AccessTokens", func(t *testing.T) {
+				s := open(t)
+				defer s.Close()
+				testAccessTokenStore(t, s)
+			})
+			t.Run("PasswordResets", func(t *testing.T) {
+				s := open(t)
+				defer s.Close()
+				testPasswordResetStore(t, s)
+			})
+			t.Run("EmailVerifications", func(t *testing.T) {
+				s := open(t)
+				defer s.Close()
+				testEmailVerificationStore(t, s)
+			})
+			t.Run("MFA", func(t *testing.T) {
+				s := open(t)
+				defer s.Close()
+				testMFAStore(t, s)
+			})
+			t.Run("ACLs", func(t *testing.T) {
+				s := open(t)
+				defer s.Close()
+				testACLStore(t, s)
+			})
+			t.Run("Groups", func(t *testing.T) {
+				s := open(t)
+				defer s.Close()
+				testGroupStore(t, s)
+			})
+		})
+	}
+}
+
+func testArticleStore(t *testing.T, s Store) {
+	home := &Article{Title: "Home", Body: "see [[Go]] and [[Missing]]"}
+	if err := s.InsertArticle(home, Edit{UserID: 1, LinkTitles: []string{"Go", "Missing"}}); err != nil {
+		t.Fatalf("insert failed: %s", err)
+	}
+	if home.ID == 0 {
+		t.Fatal("id should be set after inserted")
+	}
+	golang := &Article{Title: "Go", Body: "a language"}
+	if err := s.InsertArticle(golang, Edit{UserID: 1}); err != nil {
+		t.Fatalf("insert failed: %s", err)
+	}
+
+	got, err := s.ArticleOne(Principal{}, home.ID)
+	if err != nil {
+		t.Fatalf("get failed: %s", err)
+	}
+	if got.Title != home.Title || got.Body != home.Body {
+		t.Errorf("want %+v, got %+v", home, got)
+	}
+	if _, err := s.ArticleOne(Principal{}, 100); err != ErrNotFound {
+		t.Errorf("want ErrNotFound for missing article, got %v", err)
+	}
+
+	ids, err := s.ArticleIDsByTitles([]string{"go", "Missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids["Go"] != golang.ID {
+		t.Errorf("want only Go resolved, got %v", ids)
+	}
+
+	backlinks, err := s.Backlinks(Principal{}, golang.ID, golang.Title)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backlinks) != 1 || backlinks[0].ID != home.ID {
+		t.Errorf("want Home linking to Go, got %+v", backlinks)
+	}
+	orphans, err := s.OrphanArticles(Principal{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 1 || orphans[0].ID != home.ID {
+		t.Errorf("want Home as orphan, got %+v", orphans)
+	}
+	broken, err := s.BrokenLinks(Principal{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(broken) != 1 || broken[0].ToTitle != "Missing" {
+		t.Errorf("want broken link to Missing, got %+v", broken)
+	}
+
+	home.Body = "only [[Go]]"
+	if err := s.UpdateArticle(home, Edit{UserID: 2, RevertedFrom: 1, LinkTitles: []string{"Go"}}); err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+	if err := s.UpdateArticle(&Article{ID: 100, Title: "x"}, Edit{}); err == nil {
+		t.Error("updating missing article should be error")
+	}
+	if got, _ := s.ArticleOne(Principal{}, home.ID); got.AuthorID != 1 || got.LastEditorID != 2 {
+		t.Errorf("want author 1 and last editor 2, got %+v", got)
+	}
+	if authored, err := s.ArticlesByAuthor(Principal{}, 1); err != nil || len(authored) != 2 {
+		t.Errorf("want 2 articles by user 1, got %+v, %v", authored, err)
+	}
+	stale := &Article{ID: home.ID, Title: "Home", Body: "stale"}
+	if err := s.UpdateArticle(stale, Edit{BaseRevision: 1}); errors.Cause(err) != ErrConflict {
+		t.Errorf("want ErrConflict for stale edit, got %v", err)
+	}
+	if latest, err := s.LatestRevision(home.ID); err != nil || latest.Revision != 2 {
+		t.Errorf("want revision 2 as the latest, got %+v, %v", latest, err)
+	}
+	revisions, err := s.Revisions(home.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].Revision != 2 || revisions[0].UserID != 2 || revisions[0].RevertedFrom != 1 {
+		t.Errorf("want 2 revisions newest first, got %+v", revisions)
+	}
+	rev, err := s.RevisionOne(home.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev.Body != "see [[Go]] and [[Missing]]" {
+		t.Errorf("unexpected body of revision 1: %q", rev.Body)
+	}
+	if broken, _ := s.BrokenLinks(Principal{}); len(broken) != 0 {
+		t.Errorf("links should be replaced by update, got %+v", broken)
+	}
+
+	if err := s.DeleteArticle(golang.ID); err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	articles, err := s.ArticlesAll(Principal{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(articles) != 1 || articles[0].ID != home.ID {
+		t.Errorf("want only Home left, got %+v", articles)
+	}
+	if broken, _ := s.BrokenLinks(Principal{}); len(broken) != 1 {
+		t.Errorf("link to deleted article should be broken, got %+v", broken)
+	}
+	if err := s.SaveLinks(*home, nil, nil); err != nil {
+		t.Fatalf("saving links failed: %s", err)
+	}
+	if broken, _ := s.BrokenLinks(Principal{}); len(broken) != 0 {
+		t.Errorf("links should be replaced by saved ones, got %+v", broken)
+	}
+}
+
+func testArticlesPage(t *testing.T, s Store) {
+	for _, title := range []string{"banana", "Cherry", "apple"} {
+		if err := s.InsertArticle(&Article{Title: title}, Edit{}); err != nil {
+			t.Fatalf("insert failed: %s", err)
+		}
+	}
+	count, err := s.ArticlesCount(Principal{})
+	if err != nil || count != 3 {
+		t.Fatalf("want 3 articles, got %d, %v", count, err)
+	}
+	titles := func(sort string, offset, limit int) string {
+		articles, err := s.ArticlesPage(Principal{}, sort, offset, limit)
+		if err != nil {
+			t.Fatalf("page failed: %s", err)
+		}
+		var ts []string
+		for _, a := range articles {
+			ts = append(ts, a.Title)
+		}
+		return strings.Join(ts, ",")
+	}
+	tests := []struct {
+		sort          string
+		offset, limit int
+		want          string
+	}{
+		{SortTitle, 0, 10, "apple,banana,Cherry"},
+		{SortTitle, 1, 1, "banana"},
+		{SortTitle, 3, 10, ""},
+		// created at the same second, so newer id comes first.
+		{SortCreated, 0, 2, "apple,Cherry"},
+		{"unknown", 0, 10, "apple,Cherry,banana"},
+	}
+	for _, tt := range tests {
+		if got := titles(tt.sort, tt.offset, tt.limit); got != tt.want {
+			t.Errorf("sort %s offset %d limit %d: want %q, got %q", tt.sort, tt.offset, tt.limit, tt.want, got)
+		}
+	}
+}
+
+func testUserStore(t *testing.T, s Store) {
+	u := &User{Name: "alice", Email: "alice@example.com"}
+	if err := s.InsertUser(u, "secret"); err != nil {
+		t.Fatalf("insert failed: %s", err)
+	}
+	if u.ID == 0 {
+		t.Fatal("id should be set after inserted")
+	}
+	if err := s.InsertUser(&User{Name: "alice2", Email: "alice@example.com"}, "x"); err == nil {
+		t.Error("duplicated email should be error")
+	}
+	bob := &User{Name: "bob", Email: "bob@example.com"}
+	if err := s.InsertUser(bob, "secret"); err != nil {
+		t.Fatalf("insert failed: %s", err)
+	}
+	if err := s.UpdateUserRole(bob.ID, RoleViewer); err != nil {
+		t.Fatalf("update role failed: %s", err)
+	}
+	users, err := s.UsersAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Role != RoleAdmin || users[1].Role != RoleViewer {
+		t.Errorf("want the first user as admin and bob as viewer, got %+v", users)
+	}
+
+	ok, err := s.UserExists("alice@example.com")
+	if err != nil || !ok {
+		t.Errorf("user should exist: %v, %s", ok, err)
+	}
+	if ok, _ := s.UserExists("carol@example.com"); ok {
+		t.Error("carol should not exist")
+	}
+	if _, err := s.Auth("alice@example.com", "secret"); err != nil {
+		t.Errorf("auth failed: %s", err)
+	}
+	if _, err := s.Auth("alice@example.com", "wrong"); err == nil {
+		t.Error("auth with wrong password should fail")
+	}
+
+	u.Name = "Alice"
+	if err := s.UpdateUser(u); err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+	names, err := s.UserNames([]int64{u.ID, 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[u.ID] != "Alice" {
+		t.Errorf("unexpected names: %v", names)
+	}
+	got, err := s.UserByEmail("alice@example.com")
+	if err != nil || got.ID != u.ID {
+		t.Errorf("get by email failed: %+v, %s", got, err)
+	}
+	if _, err := s.UserOne(100); err != ErrNotFound {
+		t.Errorf("want ErrNotFound for missing user, got %v", err)
+	}
+}
+
+func testAccessTokenStore(t *testing.T, s Store) {
+	u := &User{Name: "alice", Email: "alice@example.com"}
+	if err := s.InsertUser(u, "secret"); err != nil {
+		t.Fatalf("insert user failed: %s", err)
+	}
+	token, err := NewAccessTokenString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := &AccessToken{UserID: u.ID, Name: "bot", Hash: HashAccessToken(token)}
+	if err := s.InsertAccessToken(at); err != nil {
+		t.Fatalf("insert token failed: %s", err)
+	}
+	if at.ID == 0 {
+		t.Fatal("id should be set after inserted")
+	}
+
+	got, err := s.UserByAccessToken(HashAccessToken(token))
+	if err != nil || got.ID != u.ID {
+		t.Fatalf("want %d, got %+v, %v", u.ID, got, err)
+	}
+	if _, err := s.UserByAccessToken(HashAccessToken("wrong")); err != ErrNotFound {
+		t.Errorf("want ErrNotFound for unknown token, got %v", err)
+	}
+	tokens, err := s.AccessTokens(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "bot" || tokens[0].LastUsed == nil {
+		t.Errorf("unexpected tokens: %+v", tokens)
+	}
+
+	// others can not revoke the token.
+	if err := s.DeleteAccessToken(u.ID+1, at.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UserByAccessToken(at.Hash); err != nil {
+		t.Errorf("token should be alive: %s", err)
+	}
+	if err := s.DeleteAccessToken(u.ID, at.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UserByAccessToken(at.Hash); err != ErrNotFound {
+		t.Errorf("revoked token should not work, got %v", err)
+	}
+}
+
+func testPasswordResetStore(t *testing.T, s Store) {
+	u := &User{Name: "alice", Email: "alice@example.com"}
+	if err := s.InsertUser(u, "old"); err != nil {
+		t.Fatalf("insert user failed: %s", err)
+	}
+	reset, token, err := NewPasswordReset(u.ID, PasswordResetTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InsertPasswordReset(reset); err != nil {
+		t.Fatalf("insert token failed: %s", err)
+	}
+	if reset.ID == 0 {
+		t.Fatal("id should be set after inserted")
+	}
+	other, _, err := NewPasswordReset(u.ID, PasswordResetTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InsertPasswordReset(other); err != nil {
+		t.Fatal(err)
+	}
+	expired, expiredToken, err := NewPasswordReset(u.ID, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InsertPasswordReset(expired); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.PasswordResetByHash(HashPasswordResetToken(token))
+	if err != nil || got.UserID != u.ID {
+		t.Fatalf("want token of %d, got %+v, %v", u.ID, got, err)
+	}
+	for _, hash := range []string{HashPasswordResetToken("wrong"), HashPasswordResetToken(expiredToken)} {
+		if _, err := s.PasswordResetByHash(hash); err != ErrNotFound {
+			t.Errorf("want ErrNotFound, got %v", err)
+		}
+		if _, err := s.ResetPassword(hash, "new"); errors.Cause(err) != ErrNotFound {
+			t.Errorf("want ErrNotFound, got %v", err)
+		}
+	}
+
+	if _, err := s.ResetPassword(HashPasswordResetToken(token), "new"); err != nil {
+		t.Fatalf("reset failed: %s", err)
+	}
+	if _, err := s.Auth(u.Email, "new"); err != nil {
+		t.Errorf("auth with new password failed: %s", err)
+	}
+	if _, err := s.Auth(u.Email, "old"); err != ErrPasswordUnmatch {
+		t.Errorf("want ErrPasswordUnmatch for old password, got %v", err)
+	}
+	// tokens are single-use, and other tokens of the user are used up.
+	for _, hash := range []string{reset.Hash, other.Hash} {
+		if _, err := s.ResetPassword(hash, "again"); errors.Cause(err) != ErrNotFound {
+			t.Errorf("want ErrNotFound for used token, got %v", err)
+		}
+	}
+}
+
+func testEmailVerificationStore(t *testing.T, s Store) {
+	admin := &User{Name: "admin", Email: "admin@example.com"}
+	alice := &User{Name: "alice", Email: "alice@example.com"}
+	bob := &User{Name: "bob", Email: "bob@example.com"}
+	for _, u := range []*User{admin, alice, bob} {
+		if err := s.InsertUser(u, "secret"); err != nil {
+			t.Fatalf("insert user failed: %s", err)
+		}
+	}
+	got, err := s.UserOne(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.EmailVerified || got.Can(PermEdit) {
+		t.Errorf("new user should not be verified: %+v", got)
+	}
+
+	v, token, err := NewEmailVerification(*alice, EmailVerificationTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InsertEmailVerification(v); err != nil {
+		t.Fatalf("insert token failed: %s", err)
+	}
+	if v.ID == 0 {
+		t.Fatal("id should be set after inserted")
+	}
+	if _, err := s.VerifyEmail(HashEmailVerificationToken("wrong")); errors.Cause(err) != ErrNotFound {
+		t.Errorf("want ErrNotFound for unknown token, got %v", err)
+	}
+	verified, err := s.VerifyEmail(HashEmailVerificationToken(token))
+	if err != nil {
+		t.Fatalf("verify failed: %s", err)
+	}
+	if verified.ID != alice.ID || !verified.EmailVerified || !verified.Can(PermEdit) {
+		t.Errorf("alice should be verified: %+v", verified)
+	}
+	if _, err := s.VerifyEmail(HashEmailVerificationToken(token)); errors.Cause(err) != ErrNotFound {
+		t.Errorf("want ErrNotFound for used token, got %v", err)
+	}
+
+	// tokens sent to old addresses do not verify new ones.
+	v, token, err = NewEmailVerification(*bob, EmailVerificationTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InsertEmailVerification(v); err != nil {
+		t.Fatal(err)
+	}
+	bob.Email = "robert@example.com"
+	if err := s.UpdateUser(bob); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.VerifyEmail(HashEmailVerificationToken(token)); errors.Cause(err) != ErrNotFound {
+		t.Errorf("want ErrNotFound for old address, got %v", err)
+	}
+
+	if n, err := s.PurgeUnverifiedUsers(time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("new users should not be purged: %d, %v", n, err)
+	}
+	// users named by ACL entries are kept, not to open articles restricted
+	// to them.
+	carol := &User{Name: "carol", Email: "carol@example.com"}
+	if err := s.InsertUser(carol, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	notes := &Article{Title: "Notes of carol"}
+	if err := s.InsertArticle(notes, Edit{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InsertACL(&ACL{ArticleID: notes.ID, UserID: carol.ID, Permission: PermRead}); err != nil {
+		t.Fatal(err)
+	}
+	// the first user is an admin, who is never purged.
+	if n, err := s.PurgeUnverifiedUsers(time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Errorf("want 1 purged, got %d, %v", n, err)
+	}
+	if _, err := s.UserOne(carol.ID); err != nil {
+		t.Errorf("carol should be kept: %v", err)
+	}
+	if _, err := s.ArticleOne(alice.Principal(), notes.ID); err != ErrNotFound {
+		t.Errorf("article restricted to carol should stay restricted, got %v", err)
+	}
+	if _, err := s.UserOne(bob.ID); err != ErrNotFound {
+		t.Errorf("bob should be purged, got %v", err)
+	}
+	for _, u := range []*User{admin, alice} {
+		if _, err := s.UserOne(u.ID); err != nil {
+			t.Errorf("%s should be kept: %v", u.Name, err)
+		}
+	}
+}
+
+func testMFAStore(t *testing.T, s Store) {
+	alice := &User{Name: "alice", Email: "alice@example.com"}
+	if err := s.InsertUser(alice, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EnableMFA(alice.ID, 1, nil); errors.Cause(err) != ErrNotFound {
+		t.Errorf("want ErrNotFound to enable without secret, got %v", err)
+	}
+	if err := s.SetTOTPSecret(alice.ID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.UserOne(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TOTPSecret != "JBSWY3DPEHPK3PXP" || got.MFAEnabled {
+		t.Errorf("secret should be set but not enabled: %+v", got)
+	}
+
+	_, hashes, err := NewRecoveryCodes(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EnableMFA(alice.ID, 100, hashes); err != nil {
+		t.Fatalf("enable failed: %s", err)
+	}
+	got, err = s.UserOne(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.MFAEnabled || got.TOTPCounter != 100 {
+		t.Errorf("mfa should be enabled: %+v", got)
+	}
+
+	// codes of the same or older steps are replays.
+	for _, counter := range []int64{100, 99} {
+		if err := s.UseTOTP(alice.ID, counter); errors.Cause(err) != ErrConflict {
+			t.Errorf("want ErrConflict for step %d, got %v", counter, err)
+		}
+	}
+	if err := s.UseTOTP(alice.ID, 101); err != nil {
+		t.Errorf("use totp failed: %s", err)
+	}
+
+	if err := s.UseRecoveryCode(alice.ID, hashes[0]); err != nil {
+		t.Fatalf("use recovery code failed: %s", err)
+	}
+	if err := s.UseRecoveryCode(alice.ID, hashes[0]); errors.Cause(err) != ErrNotFound {
+		t.Errorf("want ErrNotFound for used code, got %v", err)
+	}
+	if n, err := s.RecoveryCodesLeft(alice.ID); err != nil || n != 1 {
+		t.Errorf("want 1 code left, got %d, %v", n, err)
+	}
+	_, hashes, err = NewRecoveryCodes(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReplaceRecoveryCodes(alice.ID, hashes); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.RecoveryCodesLeft(alice.ID); err != nil || n != 3 {
+		t.Errorf("want 3 codes left after replaced, got %d, %v", n, err)
+	}
+
+	if err := s.DisableMFA(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.UserOne(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.MFAEnabled || got.TOTPSecret != "" {
+		t.Errorf("mfa should be disabled: %+v", got)
+	}
+	if n, err := s.RecoveryCodesLeft(alice.ID); err != nil || n != 0 {
+		t.Errorf("codes should be deleted, got %d, %v", n, err)
+	}
+
+	if v, err := s.Setting(SettingMFARequired); err != nil || v != "" {
+		t.Errorf("want empty setting, got %q, %v", v, err)
+	}
+	for _, want := range []string{"true", "false"} {
+		if err := s.SetSetting(SettingMFARequired, want); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := s.Setting(SettingMFARequired); err != nil || v != want {
+			t.Errorf("want %q, got %q, %v", want, v, err)
+		}
+	}
+}
+
+func testACLStore(t *testing.T, s Store) {
+	var (
+		public  = &Article{Title: "Home"}
+		hr      = &Article{Title: "HR/Payroll"}
+		secret  = &Article{Title: "Secret"}
+		alice   = Principal{UserID: 1}
+		bob     = Principal{UserID: 2}
+		guest   = Principal{}
+		admin   = Principal{UserID: 3, Admin: true}
+		entries = []*ACL{
+			{Namespace: "HR/", UserID: alice.UserID, Permission: PermRead},
+			{Namespace: "HR/", UserID: bob.UserID, Permission: PermEdit},
+		}
+	)
+	for _, a := range []*Article{public, hr, secret} {
+		if err := s.InsertArticle(a, Edit{}); err != nil {
+			t.Fatalf("insert failed: %s", err)
+		}
+	}
+	entries = append(entries, &ACL{ArticleID: secret.ID, UserID: bob.UserID, Permission: PermDelete})
+	for _, acl := range entries {
+		if err := s.InsertACL(acl); err != nil {
+			t.Fatalf("insert acl failed: %s", err)
+		}
+	}
+
+	tests := []struct {
+		p    Principal
+		want []string
+	}{
+		{guest, []string{"Home"}},
+		{alice, []string{"Home", "HR/Payroll"}},
+		{bob, []string{"Home", "HR/Payroll", "Secret"}},
+		{admin, []string{"Home", "HR/Payroll", "Secret"}},
+	}
+	for _, tt := range tests {
+		articles, err := s.ArticlesPage(tt.p, SortTitle, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, a := range articles {
+			got = append(got, a.Title)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%+v: want %q, got %q", tt.p, tt.want, got)
+		}
+		if count, _ := s.ArticlesCount(tt.p); count != len(tt.want) {
+			t.Errorf("%+v: want count %d, got %d", tt.p, len(tt.want), count)
+		}
+		hidden, err := s.HiddenArticleIDs(tt.p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hidden) != 3-len(tt.want) {
+			t.Errorf("%+v: unexpected hidden articles %v", tt.p, hidden)
+		}
+	}
+	if _, err := s.ArticleOne(alice, secret.ID); err != ErrNotFound {
+		t.Errorf("want ErrNotFound for restricted article, got %v", err)
+	}
+
+	access, err := s.ArticleAccess(bob, *hr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !access.Restricted || access.Granted != PermEdit {
+		t.Errorf("unexpected access: %+v", access)
+	}
+	// new articles in the namespace are restricted too.
+	if access, _ := s.ArticleAccess(alice, Article{Title: "HR/New"}); access.Granted != PermRead {
+		t.Errorf("unexpected access to new article: %+v", access)
+	}
+	if access, _ := s.ArticleAccess(alice, *public); access.Restricted {
+		t.Errorf("public article should not be restricted: %+v", access)
+	}
+	acls, err := s.ACLsByArticle(*hr)
+	if err != nil || len(acls) != 2 {
+		t.Errorf("want 2 entries for %s, got %+v, %v", hr.Title, acls, err)
+	}
+	// namespaces match titles regardless of case.
+	if access, _ := s.ArticleAccess(bob, Article{Title: "hr/New"}); access.Granted != PermEdit {
+		t.Errorf("unexpected access to article of lower case namespace: %+v", access)
+	}
+	lower := &Article{Title: "hr/Bonus"}
+	if err := s.InsertArticle(lower, Edit{}); err != nil {
+		t.Fatalf("insert failed: %s", err)
+	}
+	if _, err := s.ArticleOne(guest, lower.ID); err != ErrNotFound {
+		t.Errorf("want ErrNotFound for article of lower case namespace, got %v", err)
+	}
+	if _, err := s.ArticleOne(alice, lower.ID); err != nil {
+		t.Errorf("article of lower case namespace should be readable: %v", err)
+	}
+
+	if err := s.DeleteArticle(secret.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteACL(entries[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if acls, _ := s.ACLsAll(); len(acls) != 1 || acls[0].ID != entries[1].ID {
+		t.Errorf("unexpected entries after deleted: %+v", acls)
+	}
+}
+
+func testGroupStore(t *testing.T, s Store) {
+	alice := &User{Name: "alice", Email: "alice@example.com"}
+	bob := &User{Name: "bob", Email: "bob@example.com"}
+	for _, u := range []*User{alice, bob} {
+		if err := s.InsertUser(u, "secret"); err != nil {
+			t.Fatalf("insert user failed: %s", err)
+		}
+	}
+	dev := &Group{Name: "dev"}
+	if err := s.InsertGroup(dev); err != nil {
+		t.Fatalf("insert group failed: %s", err)
+	}
+	if dev.ID == 0 {
+		t.Fatal("id should be set after inserted")
+	}
+	if err := s.InsertGroup(&Group{Name: "dev"}); errors.Cause(err) != ErrDuplicated {
+		t.Errorf("want ErrDuplicated, got %v", err)
+	}
+	ops := &Group{Name: "ops"}
+	if err := s.InsertGroup(ops); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateGroup(&Group{ID: ops.ID, Name: "dev"}); errors.Cause(err) != ErrDuplicated {
+		t.Errorf("rename to existing name: want ErrDuplicated, got %v", err)
+	}
+	if err := s.UpdateGroup(&Group{ID: ops.ID, Name: "admins"}); err != nil {
+		t.Fatalf("rename failed: %s", err)
+	}
+	if err := s.UpdateGroup(&Group{ID: 100, Name: "x"}); errors.Cause(err) != ErrNotFound {
+		t.Errorf("want ErrNotFound for missing group, got %v", err)
+	}
+
+	for _, m := range []struct{ g, u int64 }{{dev.ID, alice.ID}, {dev.ID, bob.ID}, {ops.ID, alice.ID}, {dev.ID, alice.ID}} {
+		if err := s.AddGroupMember(m.g, m.u); err != nil {
+			t.Fatalf("add member failed: %s", err)
+		}
+	}
+	if err := s.AddGroupMember(dev.ID, 100); errors.Cause(err) != ErrNotFound {
+		t.Errorf("want ErrNotFound for missing user, got %v", err)
+	}
+	groups, err := s.GroupsByUser(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[0].Name != "admins" || groups[1].Name != "dev" {
+		t.Errorf("unexpected groups of alice: %+v", groups)
+	}
+	if err := s.RemoveGroupMember(dev.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	members, err := s.GroupMembers(dev.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].ID != alice.ID {
+		t.Errorf("unexpected members: %+v", members)
+	}
+
+	// members of the group are granted by entries for the group.
+	secret := &Article{Title: "Secret"}
+	if err := s.InsertArticle(secret, Edit{}); err != nil {
+		t.Fatal(err)
+	}
+	entry := &ACL{ArticleID: secret.ID, GroupID: dev.ID, Permission: PermEdit}
+	if err := s.InsertACL(entry); err != nil {
+		t.Fatal(err)
+	}
+	if access, _ := s.ArticleAccess(alice.Principal(), *secret); access.Granted != PermEdit {
+		t.Errorf("alice should be granted by the group: %+v", access)
+	}
+	if _, err := s.ArticleOne(bob.Principal(), secret.ID); err != ErrNotFound {
+		t.Errorf("bob is not member any more, got %v", err)
+	}
+
+	// deleting the group would open the article restricted to it.
+	if err := s.DeleteGroup(dev.ID); errors.Cause(err) != ErrInUse {
+		t.Errorf("want ErrInUse for group named by entries, got %v", err)
+	}
+	if _, err := s.ArticleOne(bob.Principal(), secret.ID); err != ErrNotFound {
+		t.Errorf("article should stay restricted, got %v", err)
+	}
+	if err := s.DeleteACL(entry.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteGroup(dev.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GroupOne(dev.ID); err != ErrNotFound {
+		t.Errorf("want ErrNotFound for deleted group, got %v", err)
+	}
+	if all, _ := s.GroupsAll(); len(all) != 1 || all[0].Name != "admins" {
+		t.Errorf("unexpected groups: %+v", all)
+	}
+}
@@ -1,20 +1,17 @@
 package model
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"io"
-	"math/rand"
-	"time"
+	"math/big"
 )
 
 var runes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 // Stretch makes stretched password using salt.
+// It is kept only for verifying legacy hashes. Use HashPassword instead.
 func Stretch(password, salt string) string {
 	var b []byte
 	s := sha256.New()
@@ -26,10 +23,15 @@ func Stretch(password, salt string) string {
 }
 
 // Salt returns random salt string.
-func Salt(n int) string {
+func Salt(n int) (string, error) {
 	b := make([]rune, n)
+	max := big.NewInt(int64(len(runes)))
 	for i := range b {
-		b[i] = runes[rand.Intn(len(runes))]
+		j, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = runes[j.Int64()]
 	}
-	return string(b)
+	return string(b), nil
 }
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+)
+
+// NewAccessTokenString returns new random token for API clients.
+// The token is shown to the user only once, and only its hash is saved.
+func NewAccessTokenString() (string, error) {
+	return randomToken()
+}
+
+// HashAccessToken returns hash of the token to save and look up.
+func HashAccessToken(token string) string {
+	return hashToken(token)
+}
+
+// randomToken returns hex encoded 20 random bytes.
+func randomToken() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken returns hex encoded SHA-256 of the token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AccessTokensByUser returns access tokens of the user, newest first.
+func AccessTokensByUser(db *sql.DB, userID int64) ([]AccessToken, error) {
+	rows, err := db.Query(`
+	select * from access_tokens
+		where user_id = ?
+		order by token_id desc
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return ScanAccessTokens(rows)
+}
+
+// AccessTokenByHash returns the access token for given hash.
+func AccessTokenByHash(db *sql.DB, hash string) (AccessToken, error) {
+	return ScanAccessToken(db.QueryRow(`select * from access_tokens where token_hash = ?`, hash))
+}
+
+// Insert inserts new access token.
+func (t *AccessToken) Insert(tx *sql.Tx) (sql.Result, error) {
+	stmt, err := tx.Prepare(`
+	insert into access_tokens (user_id, name, token_hash)
+	values(?, ?, ?)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	return stmt.Exec(t.UserID, t.Name, t.Hash)
+}
+
+// Touch records that the access token is used now.
+func (t *AccessToken) Touch(tx *sql.Tx) (sql.Result, error) {
+	return tx.Exec(`update access_tokens set last_used = CURRENT_TIMESTAMP where token_id = ?`, t.ID)
+}
+
+// Delete deletes the access token. Tokens of other users are not deleted.
+func (t *AccessToken) Delete(tx *sql.Tx) (sql.Result, error) {
+	return tx.Exec(`delete from access_tokens where token_id = ? and user_id = ?`, t.ID, t.UserID)
+}
@@ -13,13 +13,102 @@ type User struct {
 	Salted  string     `json:"salted"`
 	Created *time.Time `json:"created"`
 	Updated *time.Time `json:"updated"`
+	Role    string     `json:"role"`
+	// EmailVerified is true if the user has proved the email address is
+	// the user's one.
+	EmailVerified bool `json:"email_verified"`
+	// TOTPSecret is set when the user enrolls in two-factor authentication,
+	// and MFAEnabled becomes true after the user confirms a code of it.
+	// TOTPCounter is the time step of the last code used.
+	TOTPSecret  string `json:"-"`
+	MFAEnabled  bool   `json:"mfa_enabled"`
+	TOTPCounter int64  `json:"-"`
 }
 
 // Article returns model object for article.
 type Article struct {
+	ID           int64      `json:"id"`
+	Title        string     `json:"title"`
+	Body         string     `json:"body"`
+	Created      *time.Time `json:"created"`
+	Updated      *time.Time `json:"updated"`
+	AuthorID     int64      `json:"author_id"`
+	LastEditorID int64      `json:"last_editor_id"`
+}
+
+// Revision returns model object for a revision of article.
+type Revision struct {
+	ID           int64      `json:"id"`
+	ArticleID    int64      `json:"article_id"`
+	Revision     int64      `json:"revision"`
+	Title        string     `json:"title"`
+	Body         string     `json:"body"`
+	UserID       int64      `json:"user_id"`
+	Created      *time.Time `json:"created"`
+	RevertedFrom int64      `json:"reverted_from"`
+}
+
+// AccessToken returns model object for personal access token.
+// Only hash of the token is stored.
+type AccessToken struct {
+	ID       int64      `json:"id"`
+	UserID   int64      `json:"user_id"`
+	Name     string     `json:"name"`
+	Hash     string     `json:"-"`
+	Created  *time.Time `json:"created"`
+	LastUsed *time.Time `json:"last_used"`
+}
+
+// Group returns model object for group of users.
+type Group struct {
 	ID      int64      `json:"id"`
-	Title   string     `json:"title"`
-	Body    string     `json:"body"`
+	Name    string     `json:"name"`
+	Created *time.Time `json:"created"`
+}
+
+// ACL returns model object for an entry of access control list.
+// The entry applies to the article, or to articles in the namespace if
+// ArticleID is 0. It grants the permission to the user, or to members of
+// the group if UserID is 0.
+type ACL struct {
+	ID         int64      `json:"id"`
+	ArticleID  int64      `json:"article_id"`
+	Namespace  string     `json:"namespace"`
+	UserID     int64      `json:"user_id"`
+	GroupID    int64      `json:"group_id"`
+	Permission Permission `json:"permission"`
+	Created    *time.Time `json:"created"`
+}
+
+// PasswordReset returns model object for one-time token to reset password.
+// Only hash of the token is stored.
+type PasswordReset struct {
+	ID      int64      `json:"id"`
+	UserID  int64      `json:"user_id"`
+	Hash    string     `json:"-"`
+	Expires *time.Time `json:"expires"`
+	Used    *time.Time `json:"used"`
+	Created *time.Time `json:"created"`
+}
+
+// EmailVerification returns model object for one-time token to verify
+// email address. Only hash of the token is stored.
+type EmailVerification struct {
+	ID      int64      `json:"id"`
+	UserID  int64      `json:"user_id"`
+	Email   string     `json:"email"`
+	Hash    string     `json:"-"`
+	Expires *time.Time `json:"expires"`
+	Used    *time.Time `json:"used"`
+	Created *time.Time `json:"created"`
+}
+
+// Identity returns model object for identity of a user at an OpenID Connect
+// provider, by which the user logs in.
+type Identity struct {
+	ID      int64      `json:"id"`
+	UserID  int64      `json:"user_id"`
+	Issuer  string     `json:"issuer"`
+	Subject string     `json:"subject"`
 	Created *time.Time `json:"created"`
-	Updated *time.Time `json:"updated"`
 }
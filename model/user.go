@@ -1,7 +1,10 @@
 package model
 
-import "database/sql"
-import "errors"
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
 
 // ErrPasswordUnmatch is error for password unmatch when logging in.
 var ErrPasswordUnmatch = errors.New("password unmatch")
@@ -11,6 +14,51 @@ func UserOne(db *sql.DB, id int64) (User, error) {
 	return ScanUser(db.QueryRow(`select * from users where user_id = ?`, id))
 }
 
+// UsersAll returns all users ordered by id.
+func UsersAll(db *sql.DB) ([]User, error) {
+	rows, err := db.Query(`select * from users order by user_id`)
+	if err != nil {
+		return nil, err
+	}
+	return ScanUsers(rows)
+}
+
+// UsersCount returns number of users.
+func UsersCount(tx *sql.Tx) (int, error) {
+	var count int
+	err := tx.QueryRow(`select count(*) from users`).Scan(&count)
+	return count, err
+}
+
+// UserNames returns names of users for given ids.
+// Unknown ids are not included in the result.
+func UserNames(db *sql.DB, ids []int64) (map[int64]string, error) {
+	names := make(map[int64]string, len(ids))
+	if len(ids) == 0 {
+		return names, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := db.Query(`select user_id, name from users where user_id in (?`+strings.Repeat(`, ?`, len(ids)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+	return names, rows.Err()
+}
+
 // UserByEmail fetch user by email.
 // Email is unique key.
 func UserByEmail(db *sql.DB, email string) (User, error) {
@@ -28,40 +76,85 @@ func UserExists(db *sql.DB, email string) (bool, error) {
 
 // Update updates user by given user.
 func (u *User) Update(tx *sql.Tx) (sql.Result, error) {
+	// new email address must be verified again.
 	stmt, err := tx.Prepare(`
 	update users
-		set name = ?, email = ?
+		set email_verified = case when email = ? then email_verified else 0 end, name = ?, email = ?
 		where user_id = ?
 	`)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
-	return stmt.Exec(u.Name, u.Email, u.ID)
+	return stmt.Exec(u.Email, u.Name, u.Email, u.ID)
+}
+
+// UpdateRole updates role of the user.
+func (u *User) UpdateRole(tx *sql.Tx) (sql.Result, error) {
+	return tx.Exec(`update users set role = ? where user_id = ?`, u.Role, u.ID)
 }
 
-// Insert inserts new user.
+// Insert inserts new user. If role of the user is empty, the user becomes
+// an editor.
 func (u *User) Insert(tx *sql.Tx, password string) (sql.Result, error) {
 	stmt, err := tx.Prepare(`
-	insert into users (name, email, salt, salted)
-	values(?, ?, ?, ?)
+	insert into users (name, email, salt, salted, role, email_verified)
+	values(?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
-	salt := Salt(100)
-	return stmt.Exec(u.Name, u.Email, salt, Stretch(password, salt))
+	if u.Role == "" {
+		u.Role = RoleEditor
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(u.Name, u.Email, "", hash, u.Role, u.EmailVerified)
+}
+
+// UpdatePassword updates password of the user.
+func (u *User) UpdatePassword(tx *sql.Tx, password string) (sql.Result, error) {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	u.Salt, u.Salted = "", hash
+	return tx.Exec(`update users set salt = ?, salted = ? where user_id = ?`, u.Salt, u.Salted, u.ID)
 }
 
-// Auth makes user authentication.
+// Auth makes user authentication. Legacy or weak password hashes are
+// replaced on success, so that users need not reset their passwords.
 func Auth(db *sql.DB, email, password string) (User, error) {
 	u, err := UserByEmail(db, email)
 	if err != nil {
 		return User{}, err
 	}
-	if u.Salted != Stretch(password, u.Salt) {
-		return User{}, ErrPasswordUnmatch
+	rehash, err := u.verify(password)
+	if err != nil {
+		return User{}, err
+	}
+	if rehash {
+		if err := TXHandler(db, func(tx *sql.Tx) error {
+			if _, err := u.UpdatePassword(tx, password); err != nil {
+				return err
+			}
+			return tx.Commit()
+		}); err != nil {
+			return User{}, err
+		}
 	}
 	return u, nil
 }
+
+// verify checks if password is the user's one, and reports whether the
+// hash should be replaced.
+func (u *User) verify(password string) (bool, error) {
+	ok, rehash := CheckPassword(u.Salted, u.Salt, password)
+	if !ok {
+		return false, ErrPasswordUnmatch
+	}
+	return rehash, nil
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// EmailVerificationTTL is how long tokens to verify email addresses are valid.
+const EmailVerificationTTL = 48 * time.Hour
+
+// NewEmailVerification returns new token to verify the email address of
+// the user, which expires after ttl, and the token string to send to the
+// address. The token string is not saved; only its hash is.
+func NewEmailVerification(u User, ttl time.Duration) (*EmailVerification, string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	expires := time.Now().Add(ttl).UTC()
+	return &EmailVerification{
+		UserID:  u.ID,
+		Email:   u.Email,
+		Hash:    HashEmailVerificationToken(token),
+		Expires: &expires,
+	}, token, nil
+}
+
+// HashEmailVerificationToken returns hash of the token to save and look up.
+func HashEmailVerificationToken(token string) string {
+	return hashToken(token)
+}
+
+// Usable reports whether the token is neither used nor expired at now.
+func (t *EmailVerification) Usable(now time.Time) bool {
+	return t.Used == nil && t.Expires != nil && now.Before(*t.Expires)
+}
+
+// EmailVerificationByHash returns the token for given hash.
+func EmailVerificationByHash(db *sql.DB, hash string) (EmailVerification, error) {
+	return ScanEmailVerification(db.QueryRow(`select * from email_verifications where token_hash = ?`, hash))
+}
+
+// Insert inserts new token.
+func (t *EmailVerification) Insert(tx *sql.Tx) (sql.Result, error) {
+	stmt, err := tx.Prepare(`
+	insert into email_verifications (user_id, email, token_hash, expires)
+	values(?, ?, ?, ?)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	return stmt.Exec(t.UserID, t.Email, t.Hash, t.Expires)
+}
+
+// Use marks the token used. It affects no rows if the token is already used,
+// so that the token can be used only once.
+func (t *EmailVerification) Use(tx *sql.Tx) (sql.Result, error) {
+	return tx.Exec(`update email_verifications set used = ? where verification_id = ? and used is null`,
+		time.Now().UTC(), t.ID)
+}
+
+// VerifyEmail marks the email address of the user verified if it is still
+// the address. It affects no rows if the user has changed the address.
+func VerifyEmail(tx *sql.Tx, userID int64, email string) (sql.Result, error) {
+	return tx.Exec(`update users set email_verified = 1 where user_id = ? and email = ?`, userID, email)
+}
+
+// UnverifiedUsers returns users who have not verified their email addresses.
+func UnverifiedUsers(db *sql.DB) ([]User, error) {
+	rows, err := db.Query(`select * from users where email_verified = 0 order by user_id`)
+	if err != nil {
+		return nil, err
+	}
+	return ScanUsers(rows)
+}
+
+// Delete deletes the user with tokens, group memberships, sessions and
+// failed logins. Articles and
+// revisions of the user are kept. It returns ErrInUse if ACL entries name
+// the user, since deleting the entries may open restricted articles to
+// everyone.
+func (u *User) Delete(tx *sql.Tx) error {
+	var count int
+	if err := tx.QueryRow(`select count(*) from article_acls where user_id = ?`, u.ID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrInUse
+	}
+	for _, q := range []string{
+		`delete from users where user_id = ?`,
+		`delete from access_tokens where user_id = ?`,
+		`delete from password_resets where user_id = ?`,
+		`delete from email_verifications where user_id = ?`,
+		`delete from recovery_codes where user_id = ?`,
+		`delete from user_identities where user_id = ?`,
+		`delete from group_members where user_id = ?`,
+		`delete from sessions where user_id = ?`,
+	} {
+		if _, err := tx.Exec(q, u.ID); err != nil {
+			return err
+		}
+	}
+	// keys of failed logins are given by the login controller.
+	_, err := tx.Exec(`delete from login_failures where failure_key = ?`, "account:"+strings.ToLower(u.Email))
+	return err
+}
@@ -0,0 +1,272 @@
+// Package ratelimit limits failed attempts, such as password guesses,
+// with exponential backoff and temporary lockout.
+//
+// Failures are recorded by keys like email addresses or IP addresses in
+// a Store. MemoryStore works in a single process. SQLStore shares records
+// among instances behind a load balancer.
+package ratelimit
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is failures of a key.
+type Record struct {
+	Key      string
+	Failures int
+	// Last is when the last failure happened.
+	Last time.Time
+}
+
+// Store keeps failure records.
+type Store interface {
+	// Get returns the record of the key.
+	// Keys without failures have zero records.
+	Get(key string) (Record, error)
+	// Fail records a failure of the key at the time and returns the
+	// updated record.
+	Fail(key string, at time.Time) (Record, error)
+	// Reset forgets failures of the key.
+	Reset(key string) error
+	// All returns all records ordered by key.
+	All() ([]Record, error)
+}
+
+// Policy decides how long keys must wait after failures.
+type Policy struct {
+	// Free is the number of failures allowed without waiting.
+	Free int
+	// Base is the wait after Free failures. It doubles for each further
+	// failure until the key is locked.
+	Base time.Duration
+	// LockAfter is the number of failures which locks the key for LockFor.
+	LockAfter int
+	LockFor   time.Duration
+	// Forget is how long failures are remembered since the last one.
+	Forget time.Duration
+}
+
+// DefaultAccountPolicy is for failures of an account, which are likely
+// to be guesses of its password.
+var DefaultAccountPolicy = Policy{
+	Free:      3,
+	Base:      time.Second,
+	LockAfter: 10,
+	LockFor:   15 * time.Minute,
+	Forget:    24 * time.Hour,
+}
+
+// DefaultIPPolicy is for failures from an IP address, which may be shared
+// by many users behind NAT.
+var DefaultIPPolicy = Policy{
+	Free:      20,
+	Base:      time.Second,
+	LockAfter: 100,
+	LockFor:   15 * time.Minute,
+	Forget:    24 * time.Hour,
+}
+
+// DefaultResetPolicy is for requests of password reset links to an email
+// address, which are counted apart from failed logins, so that anyone
+// requesting links can not lock the account out of logging in.
+var DefaultResetPolicy = Policy{
+	Free:      3,
+	Base:      time.Minute,
+	LockAfter: 10,
+	LockFor:   time.Hour,
+	Forget:    24 * time.Hour,
+}
+
+// DefaultResetIPPolicy is for requests of password reset links from an IP
+// address.
+var DefaultResetIPPolicy = Policy{
+	Free:      20,
+	Base:      time.Minute,
+	LockAfter: 100,
+	LockFor:   time.Hour,
+	Forget:    24 * time.Hour,
+}
+
+// wait returns how long to wait after the last of n failures.
+func (p Policy) wait(n int) time.Duration {
+	switch {
+	case n < p.Free:
+		return 0
+	case n >= p.LockAfter:
+		return p.LockFor
+	}
+	d := p.Base
+	for i := p.Free; i < n && d < p.LockFor; i++ {
+		d *= 2
+	}
+	if d > p.LockFor {
+		return p.LockFor
+	}
+	return d
+}
+
+// Lock is a key which must wait for next attempt.
+type Lock struct {
+	Key      string
+	Failures int
+	// Locked is true if the key is locked, not only delayed.
+	Locked bool
+	Until  time.Time
+}
+
+// Limiter limits failures of keys by the policy.
+// Keys are prefixed in the store, so that limiters can share a store.
+type Limiter struct {
+	store  Store
+	prefix string
+	policy Policy
+
+	// now is replaceable for testing.
+	now func() time.Time
+}
+
+// New returns a limiter saving failures in the store with the prefix,
+// such as "ip:".
+func New(store Store, prefix string, policy Policy) *Limiter {
+	return &Limiter{store: store, prefix: prefix, policy: policy, now: time.Now}
+}
+
+// record returns the record of the key. Forgotten failures are reset.
+func (l *Limiter) record(key string) (Record, error) {
+	r, err := l.store.Get(l.prefix + key)
+	if err != nil || r.Failures == 0 {
+		return r, err
+	}
+	if l.now().Sub(r.Last) >= l.policy.Forget {
+		return Record{Key: r.Key}, l.store.Reset(r.Key)
+	}
+	return r, nil
+}
+
+// remaining returns how long the record must wait from now.
+func (l *Limiter) remaining(r Record) time.Duration {
+	d := r.Last.Add(l.policy.wait(r.Failures)).Sub(l.now())
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// Wait returns how long the key must wait before next attempt.
+// 0 means the attempt is allowed now.
+func (l *Limiter) Wait(key string) (time.Duration, error) {
+	r, err := l.record(key)
+	if err != nil {
+		return 0, err
+	}
+	return l.remaining(r), nil
+}
+
+// Fail records a failure of the key and returns how long the key must wait
+// before next attempt.
+func (l *Limiter) Fail(key string) (time.Duration, error) {
+	if _, err := l.record(key); err != nil {
+		return 0, err
+	}
+	r, err := l.store.Fail(l.prefix+key, l.now())
+	if err != nil {
+		return 0, err
+	}
+	return l.remaining(r), nil
+}
+
+// Reset forgets failures of the key, such as after it succeeds or
+// an admin unlocks it.
+func (l *Limiter) Reset(key string) error {
+	return l.store.Reset(l.prefix + key)
+}
+
+// Locks returns keys which must wait for next attempt now.
+func (l *Limiter) Locks() ([]Lock, error) {
+	records, err := l.store.All()
+	if err != nil {
+		return nil, err
+	}
+	var locks []Lock
+	for _, r := range records {
+		if !strings.HasPrefix(r.Key, l.prefix) {
+			continue
+		}
+		d := l.remaining(r)
+		if d == 0 {
+			continue
+		}
+		locks = append(locks, Lock{
+			Key:      strings.TrimPrefix(r.Key, l.prefix),
+			Failures: r.Failures,
+			Locked:   r.Failures >= l.policy.LockAfter,
+			Until:    l.now().Add(d),
+		})
+	}
+	return locks, nil
+}
+
+// MemoryStore keeps records in memory.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// NewMemoryStore returns an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[key]
+	if !ok {
+		return Record{Key: key}, nil
+	}
+	return r, nil
+}
+
+// Fail implements Store.
+func (s *MemoryStore) Fail(key string, at time.Time) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.records[key]
+	r.Key = key
+	r.Failures++
+	r.Last = at
+	s.records[key] = r
+	return r, nil
+}
+
+// Reset implements Store.
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// All implements Store.
+func (s *MemoryStore) All() ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]Record, 0, len(s.records))
+	for _, r := range s.records {
+		records = append(records, r)
+	}
+	sort.Sort(byKey(records))
+	return records, nil
+}
+
+// byKey sorts records by key.
+type byKey []Record
+
+func (s byKey) Len() int           { return len(s) }
+func (s byKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byKey) Less(i, j int) bool { return s[i].Key < s[j].Key }
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestPolicyWait(t *testing.T) {
+	p := Policy{Free: 3, Base: time.Second, LockAfter: 10, LockFor: time.Minute}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{6, 8 * time.Second},
+		{9, time.Minute},
+		{10, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := p.wait(tt.failures); got != tt.want {
+			t.Errorf("%d failures: want %s, got %s", tt.failures, tt.want, got)
+		}
+	}
+}
+
+// openSQLite returns a store of in-memory SQLite database
+// migrated by the migration of login_failures.
+func openSQLite(t *testing.T) *SQLStore {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	b, err := ioutil.ReadFile("../migrations/sqlite3/8_login_failures.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := strings.SplitN(string(b), "-- +migrate Down", 2)[0]
+	if _, err := db.Exec(up); err != nil {
+		t.Fatal(err)
+	}
+	return NewSQLStore(db)
+}
+
+func TestLimiter(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory":  func(t *testing.T) Store { return NewMemoryStore() },
+		"sqlite3": func(t *testing.T) Store { return openSQLite(t) },
+	}
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			testLimiter(t, open(t))
+		})
+	}
+}
+
+func testLimiter(t *testing.T, s Store) {
+	p := Policy{Free: 2, Base: time.Second, LockAfter: 4, LockFor: time.Minute, Forget: time.Hour}
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	accounts := New(s, "account:", p)
+	accounts.now = func() time.Time { return now }
+	ips := New(s, "ip:", p)
+	ips.now = accounts.now
+
+	fail := func(want time.Duration) {
+		t.Helper()
+		got, err := accounts.Fail("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("want wait %s, got %s", want, got)
+		}
+	}
+	fail(0)
+	fail(time.Second)
+	now = now.Add(500 * time.Millisecond)
+	if d, err := accounts.Wait("alice"); err != nil || d != 500*time.Millisecond {
+		t.Errorf("want 500ms, got %s, %v", d, err)
+	}
+	fail(2 * time.Second)
+	fail(time.Minute)
+
+	locks, err := accounts.Locks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 1 || locks[0].Key != "alice" || !locks[0].Locked || locks[0].Failures != 4 {
+		t.Errorf("unexpected locks: %+v", locks)
+	}
+	// keys of other limiters are separated.
+	if d, err := ips.Wait("alice"); err != nil || d != 0 {
+		t.Errorf("want no wait for ip, got %s, %v", d, err)
+	}
+	if locks, err := ips.Locks(); err != nil || len(locks) != 0 {
+		t.Errorf("want no ip locks, got %+v, %v", locks, err)
+	}
+
+	now = now.Add(time.Minute)
+	if d, err := accounts.Wait("alice"); err != nil || d != 0 {
+		t.Errorf("lock should expire, got %s, %v", d, err)
+	}
+	// failures are remembered until forgotten.
+	fail(time.Minute)
+	now = now.Add(time.Hour)
+	fail(0)
+
+	if err := accounts.Reset("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := accounts.Wait("alice"); err != nil || d != 0 {
+		t.Errorf("want no wait after reset, got %s, %v", d, err)
+	}
+}
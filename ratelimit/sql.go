@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SQLStore keeps records in login_failures table of MySQL or SQLite,
+// so that instances sharing the database share records.
+type SQLStore struct {
+	DB *sql.DB
+}
+
+// NewSQLStore returns a store of the database.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{DB: db}
+}
+
+// Get implements Store.
+func (s *SQLStore) Get(key string) (Record, error) {
+	r := Record{Key: key}
+	err := s.DB.QueryRow(`select failures, last_failed from login_failures where failure_key = ?`, key).
+		Scan(&r.Failures, &r.Last)
+	if err == sql.ErrNoRows {
+		return r, nil
+	}
+	return r, err
+}
+
+// Fail implements Store. Failures are counted up in the database, so that
+// concurrent failures on instances are all counted.
+func (s *SQLStore) Fail(key string, at time.Time) (Record, error) {
+	at = at.UTC()
+	result, err := s.DB.Exec(`update login_failures set failures = failures + 1, last_failed = ? where failure_key = ?`, at, key)
+	if err != nil {
+		return Record{}, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return Record{}, err
+	} else if n == 0 {
+		if _, err := s.DB.Exec(`insert into login_failures (failure_key, failures, last_failed) values(?, 1, ?)`, key, at); err != nil {
+			// another instance has inserted the key since updated.
+			if _, err := s.DB.Exec(`update login_failures set failures = failures + 1, last_failed = ? where failure_key = ?`, at, key); err != nil {
+				return Record{}, err
+			}
+		}
+	}
+	return s.Get(key)
+}
+
+// Reset implements Store.
+func (s *SQLStore) Reset(key string) error {
+	_, err := s.DB.Exec(`delete from login_failures where failure_key = ?`, key)
+	return err
+}
+
+// All implements Store.
+func (s *SQLStore) All() ([]Record, error) {
+	rows, err := s.DB.Query(`select failure_key, failures, last_failed from login_failures order by failure_key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []Record
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(&r.Key, &r.Failures, &r.Last); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
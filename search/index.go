@@ -0,0 +1,187 @@
+// Package search provides in-process full-text search for articles.
+//
+// The index is kept in memory and is built from the database when the
+// server starts, then updated as articles are saved. Japanese text is
+// indexed by bigrams, see Tokenize.
+package search
+
+import (
+	"html/template"
+	"math"
+	"sort"
+	"sync"
+)
+
+// titleWeight is how much a term in the title counts compared to the body.
+const titleWeight = 3
+
+// Document is a unit of indexing.
+type Document struct {
+	ID    int64
+	Title string
+	Body  string
+}
+
+// Hit is a document matched by the query.
+type Hit struct {
+	ID      int64
+	Title   string
+	Score   float64
+	Snippet template.HTML
+}
+
+// Result is a page of hits for the query.
+type Result struct {
+	Hits []Hit
+	// Total is the number of all documents matched.
+	Total int
+}
+
+// frequency is how many times a term appears in a document.
+type frequency struct {
+	title, body int
+}
+
+// Index is an inverted index of documents. It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[int64]Document
+	postings map[string]map[int64]frequency
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[int64]Document),
+		postings: make(map[string]map[int64]frequency),
+	}
+}
+
+// Add indexes the document. If the document is already indexed,
+// it is replaced.
+func (idx *Index) Add(doc Document) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(doc.ID)
+	idx.docs[doc.ID] = doc
+	for _, t := range Tokenize(doc.Title) {
+		f := idx.posting(t)
+		fr := f[doc.ID]
+		fr.title++
+		f[doc.ID] = fr
+	}
+	for _, t := range Tokenize(doc.Body) {
+		f := idx.posting(t)
+		fr := f[doc.ID]
+		fr.body++
+		f[doc.ID] = fr
+	}
+}
+
+// Remove removes the document from the index.
+func (idx *Index) Remove(id int64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+}
+
+func (idx *Index) posting(term string) map[int64]frequency {
+	p, ok := idx.postings[term]
+	if !ok {
+		p = make(map[int64]frequency)
+		idx.postings[term] = p
+	}
+	return p
+}
+
+func (idx *Index) remove(id int64) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	delete(idx.docs, id)
+	for _, t := range append(Tokenize(doc.Title), Tokenize(doc.Body)...) {
+		p, ok := idx.postings[t]
+		if !ok {
+			continue
+		}
+		delete(p, id)
+		if len(p) == 0 {
+			delete(idx.postings, t)
+		}
+	}
+}
+
+// Search finds documents containing all terms in the query, ranked by
+// TF-IDF. Hits from offset up to limit are returned with snippets.
+func (idx *Index) Search(q string, offset, limit int) Result {
+	return idx.SearchExcept(q, offset, limit, nil)
+}
+
+// SearchExcept works as Search, but documents whose ids are in hidden
+// are never hit. It is used for excluding documents the searcher is not
+// allowed to see.
+func (idx *Index) SearchExcept(q string, offset, limit int, hidden map[int64]bool) Result {
+	terms := queryTerms(q)
+	if len(terms) == 0 {
+		return Result{}
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	scores := make(map[int64]float64)
+	for i, t := range terms {
+		p := idx.postings[t]
+		if len(p) == 0 {
+			return Result{}
+		}
+		idf := math.Log(1 + float64(len(idx.docs))/float64(len(p)))
+		next := make(map[int64]float64, len(p))
+		for id, f := range p {
+			if _, ok := scores[id]; i > 0 && !ok {
+				continue
+			}
+			tf := float64(f.title*titleWeight + f.body)
+			next[id] = scores[id] + (1+math.Log(tf))*idf
+		}
+		scores = next
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		if hidden[id] {
+			continue
+		}
+		doc := idx.docs[id]
+		hits = append(hits, Hit{ID: id, Title: doc.Title, Score: score})
+	}
+	sort.Sort(byScore(hits))
+
+	result := Result{Total: len(hits)}
+	if offset >= len(hits) {
+		return result
+	}
+	hits = hits[offset:]
+	if limit < len(hits) {
+		hits = hits[:limit]
+	}
+	for i := range hits {
+		hits[i].Snippet = Snippet(idx.docs[hits[i].ID].Body, q)
+	}
+	result.Hits = hits
+	return result
+}
+
+// byScore sorts hits by higher score first. Ties are broken by id
+// for the stable order of pages.
+type byScore []Hit
+
+func (h byScore) Len() int      { return len(h) }
+func (h byScore) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h byScore) Less(i, j int) bool {
+	if h[i].Score != h[j].Score {
+		return h[i].Score > h[j].Score
+	}
+	return h[i].ID > h[j].ID
+}
@@ -0,0 +1,109 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	cases := []struct {
+		s    string
+		want []string
+	}{
+		{"Hello, World!", []string{"hello", "world"}},
+		{"Ｇｏ言語", []string{"go", "言", "言語", "語"}},
+		{"東京タワー", []string{"東", "東京", "京", "京タ", "タ", "タワ", "ワ", "ワー", "ー"}},
+		{"A 木", []string{"a", "木"}},
+	}
+	for _, c := range cases {
+		if got := Tokenize(c.s); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Tokenize(%q): want %v, got %v", c.s, c.want, got)
+		}
+	}
+}
+
+func newTestIndex() *Index {
+	idx := NewIndex()
+	idx.Add(Document{ID: 1, Title: "Go", Body: "Go is a programming language."})
+	idx.Add(Document{ID: 2, Title: "MySQL", Body: "MySQL is a database. Go talks to MySQL with database/sql."})
+	idx.Add(Document{ID: 3, Title: "東京", Body: "東京タワーは東京都港区にある電波塔です。"})
+	idx.Add(Document{ID: 4, Title: "京都", Body: "京都の寺社について。"})
+	return idx
+}
+
+func ids(r Result) []int64 {
+	var ids []int64
+	for _, h := range r.Hits {
+		ids = append(ids, h.ID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	idx := newTestIndex()
+	cases := []struct {
+		q     string
+		want  []int64
+		total int
+	}{
+		{"go", []int64{1, 2}, 2},
+		{"GO database", []int64{2}, 1},
+		{"mysql", []int64{2}, 1},
+		{"東京", []int64{3}, 1},
+		{"東京タワー", []int64{3}, 1},
+		{"京都", []int64{4, 3}, 2},
+		{"京", []int64{3, 4}, 2},
+		{"大阪", nil, 0},
+		{"", nil, 0},
+	}
+	for _, c := range cases {
+		r := idx.Search(c.q, 0, 10)
+		if got := ids(r); !reflect.DeepEqual(got, c.want) || r.Total != c.total {
+			t.Errorf("Search(%q): want %v (total %d), got %v (total %d)", c.q, c.want, c.total, got, r.Total)
+		}
+	}
+}
+
+func TestSearchPaging(t *testing.T) {
+	idx := newTestIndex()
+	r := idx.Search("go", 1, 1)
+	if got, want := ids(r), []int64{2}; !reflect.DeepEqual(got, want) || r.Total != 2 {
+		t.Errorf("want %v, got %v (total %d)", want, got, r.Total)
+	}
+	if r := idx.Search("go", 2, 1); len(r.Hits) != 0 || r.Total != 2 {
+		t.Errorf("want no hits, got %v (total %d)", r.Hits, r.Total)
+	}
+}
+
+func TestSearchExcept(t *testing.T) {
+	idx := newTestIndex()
+	r := idx.SearchExcept("go", 0, 10, map[int64]bool{1: true})
+	if got, want := ids(r), []int64{2}; !reflect.DeepEqual(got, want) || r.Total != 1 {
+		t.Errorf("want %v, got %v (total %d)", want, got, r.Total)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	idx := newTestIndex()
+	idx.Remove(1)
+	idx.Add(Document{ID: 2, Title: "MySQL", Body: "renamed"})
+	if r := idx.Search("go", 0, 10); r.Total != 0 {
+		t.Errorf("want no hits, got %v", ids(r))
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	cases := []struct {
+		text, q string
+		want    string
+	}{
+		{"Go is <fun>", "go", "<mark>Go</mark> is &lt;fun&gt;"},
+		{"東京タワーは東京都", "東京", "<mark>東京</mark>タワーは<mark>東京</mark>都"},
+		{"no match here", "go", "no match here"},
+	}
+	for _, c := range cases {
+		if got := string(Snippet(c.text, c.q)); got != c.want {
+			t.Errorf("Snippet(%q, %q): want %q, got %q", c.text, c.q, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package search
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"unicode"
+)
+
+const (
+	// snippetBefore is the number of characters shown before the first match.
+	snippetBefore = 40
+	// snippetLength is the maximum number of characters in a snippet.
+	snippetLength = 160
+)
+
+// Snippet returns an excerpt of text around the first match of the query.
+// Matched words are highlighted by <mark>, and the rest is HTML escaped.
+func Snippet(text, q string) template.HTML {
+	src := []rune(strings.Join(strings.Fields(text), " "))
+	norm := make([]rune, len(src))
+	for i, r := range src {
+		norm[i] = normalize(r)
+	}
+	var words [][]rune
+	for _, w := range strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		word := make([]rune, 0, len(w))
+		for _, r := range w {
+			word = append(word, normalize(r))
+		}
+		words = append(words, word)
+	}
+
+	// marks[i] is the length of the match starting at i.
+	marks := make(map[int]int)
+	first := -1
+	for i := 0; i < len(norm); i++ {
+		for _, w := range words {
+			if hasPrefix(norm[i:], w) && len(w) > marks[i] {
+				marks[i] = len(w)
+			}
+		}
+		if n, ok := marks[i]; ok {
+			if first < 0 {
+				first = i
+			}
+			i += n - 1
+		}
+	}
+
+	start := 0
+	if first > snippetBefore {
+		start = first - snippetBefore
+	}
+	end := start + snippetLength
+	if end > len(src) {
+		end = len(src)
+	}
+
+	var buf bytes.Buffer
+	if start > 0 {
+		buf.WriteString("…")
+	}
+	for i := start; i < end; {
+		n, ok := marks[i]
+		if !ok {
+			j := i + 1
+			for ; j < end; j++ {
+				if _, ok := marks[j]; ok {
+					break
+				}
+			}
+			buf.WriteString(template.HTMLEscapeString(string(src[i:j])))
+			i = j
+			continue
+		}
+		if i+n > end {
+			n = end - i
+		}
+		buf.WriteString("<mark>")
+		buf.WriteString(template.HTMLEscapeString(string(src[i : i+n])))
+		buf.WriteString("</mark>")
+		i += n
+	}
+	if end < len(src) {
+		buf.WriteString("…")
+	}
+	return template.HTML(buf.String())
+}
+
+func hasPrefix(s, prefix []rune) bool {
+	if len(prefix) == 0 || len(s) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if s[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package search
+
+import (
+	"unicode"
+)
+
+// Tokenize splits text into terms for indexing.
+//
+// Words of alphabets and digits are terms as they are in lower case.
+// Since Japanese and Chinese text has no spaces between words, runs of
+// those characters are split into overlapping bigrams (and unigrams
+// for indexing), so that any substring of two or more characters
+// can be found.
+func Tokenize(s string) []string {
+	return tokenize(s, true)
+}
+
+// queryTerms splits query into terms. Unlike Tokenize, runs of CJK
+// characters are split only into bigrams, which are all required to
+// match. Single characters are kept as unigrams.
+func queryTerms(q string) []string {
+	return tokenize(q, false)
+}
+
+func tokenize(s string, unigrams bool) []string {
+	var (
+		terms []string
+		word  []rune
+		cjk   []rune
+	)
+	flushWord := func() {
+		if len(word) > 0 {
+			terms = append(terms, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		switch {
+		case len(cjk) == 1:
+			terms = append(terms, string(cjk))
+		case len(cjk) > 1:
+			for i := 0; i < len(cjk); i++ {
+				if unigrams {
+					terms = append(terms, string(cjk[i]))
+				}
+				if i+1 < len(cjk) {
+					terms = append(terms, string(cjk[i:i+2]))
+				}
+			}
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range s {
+		r = normalize(r)
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return terms
+}
+
+// normalize folds a rune into lower case, and full width alphabets
+// and digits into ASCII.
+func normalize(r rune) rune {
+	if r >= 0xFF01 && r <= 0xFF5E {
+		r -= 0xFEE0
+	}
+	return unicode.ToLower(r)
+}
+
+// isCJK reports whether r is a character of Japanese or Chinese,
+// which are written without spaces between words.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) ||
+		r == 'ー' || r == '々'
+}
@@ -0,0 +1,191 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// userKey is the key of values of sessions which is the id of the user
+// logged in, as set by the controller.
+const userKey = "id"
+
+// touchInterval is how often last seen time of sessions is updated.
+const touchInterval = time.Minute
+
+// defaultMaxAge is how long sessions are kept, in seconds.
+const defaultMaxAge = 86400 * 30
+
+// ServerStore is a store of gorilla/sessions which keeps values of sessions
+// in a Store. Cookies have only random tokens signed and encrypted by the
+// keys, so that sessions are revoked by deleting them from the Store.
+type ServerStore struct {
+	Store   Store
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+
+	// now is replaceable for testing.
+	now func() time.Time
+}
+
+// NewServerStore returns a store which keeps sessions in the store. Like
+// sessions.NewCookieStore, keyPairs are pairs of hash and encryption keys,
+// and the first pair is used for new cookies.
+func NewServerStore(store Store, keyPairs ...[]byte) *ServerStore {
+	s := &ServerStore{
+		Store:  store,
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   defaultMaxAge,
+			HttpOnly: true,
+		},
+		now: time.Now,
+	}
+	for _, c := range s.Codecs {
+		if sc, ok := c.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(s.Options.MaxAge)
+		}
+	}
+	return s
+}
+
+// Get returns the session of the name, cached in the request.
+func (s *ServerStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns the session of the cookie. If the cookie is missing, or the
+// session is revoked or expired, the session is new and empty.
+func (s *ServerStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var token string
+	if err := securecookie.DecodeMulti(name, c.Value, &token, s.Codecs...); err != nil {
+		return session, err
+	}
+	rec, err := s.Store.Get(hashToken(token))
+	if err == ErrNotFound {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+	now := s.now()
+	if !rec.Expires.After(now) {
+		return session, nil
+	}
+	if err := (securecookie.GobEncoder{}).Deserialize(rec.Values, &session.Values); err != nil {
+		return session, err
+	}
+	session.ID = token
+	session.IsNew = false
+	if now.Sub(rec.LastSeen) >= touchInterval {
+		if err := s.Store.Touch(rec.ID, now, remoteIP(r), r.UserAgent()); err != nil {
+			log.Printf("sessions: touching session failed: %s", err)
+		}
+	}
+	return session, nil
+}
+
+// Save saves values of the session in the store, and sets the cookie of
+// its token. Sessions of negative MaxAge are deleted. Sessions loaded from
+// the store are only updated, so that sessions revoked while the request
+// is served are not brought back; their cookies are deleted instead.
+func (s *ServerStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.Store.Delete(hashToken(session.ID)); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+	issued := session.ID == ""
+	if issued {
+		token, err := newToken()
+		if err != nil {
+			return err
+		}
+		session.ID = token
+	}
+	values, err := (securecookie.GobEncoder{}).Serialize(session.Values)
+	if err != nil {
+		return err
+	}
+	maxAge := session.Options.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultMaxAge
+	}
+	userID, _ := session.Values[userKey].(int64)
+	now := s.now()
+	rec := Record{
+		ID:        hashToken(session.ID),
+		UserID:    userID,
+		Values:    values,
+		UserAgent: r.UserAgent(),
+		IP:        remoteIP(r),
+		Created:   now,
+		LastSeen:  now,
+		Expires:   now.Add(time.Duration(maxAge) * time.Second),
+	}
+	if issued {
+		err = s.Store.Insert(rec)
+	} else {
+		err = s.Store.Update(rec)
+	}
+	if err == ErrNotFound {
+		opts := *session.Options
+		opts.MaxAge = -1
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", &opts))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// newToken returns a random token of a new session.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the id of the record of the token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// remoteIP returns IP address of the client.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
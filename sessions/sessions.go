@@ -3,12 +3,22 @@ package sessions
 import (
 	"net/http"
 
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 )
 
 // store is session store based on gorilla/sessions.
-// This is singleton for wiki app.
-var store = sessions.NewCookieStore([]byte("secretkey"))
+// This is singleton for wiki app. Until UseServerStore is called, sessions
+// are kept in cookies signed by random keys, which are lost on exit.
+var store sessions.Store = sessions.NewCookieStore(securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32))
+
+// UseServerStore keeps sessions in the backend, with cookies signed and
+// encrypted by pairs of hash and encryption keys. The first pair is used
+// for new cookies, and the others are accepted for cookies made before key
+// rotation. It should be called before serving.
+func UseServerStore(backend Store, keyPairs ...[]byte) {
+	store = NewServerStore(backend, keyPairs...)
+}
 
 func Get(r *http.Request, key string) (*sessions.Session, error) {
 	return store.Get(r, key)
@@ -23,3 +33,25 @@ func Clear(r *http.Request, w http.ResponseWriter, session *sessions.Session) er
 	session.Options.MaxAge = -1
 	return Save(r, w, session)
 }
+
+// Renew makes the session saved by a new ID next time, and deletes the old
+// one on the server. It should be called on login, so that IDs given
+// before login cannot be used to hijack the session.
+func Renew(session *sessions.Session) error {
+	if s, ok := store.(*ServerStore); ok && session.ID != "" {
+		if err := s.Store.Delete(hashToken(session.ID)); err != nil {
+			return err
+		}
+	}
+	session.ID = ""
+	return nil
+}
+
+// RecordID returns the id of the record of the session on the server, or
+// "" if the session is not saved yet.
+func RecordID(session *sessions.Session) string {
+	if session.ID == "" {
+		return ""
+	}
+	return hashToken(session.ID)
+}
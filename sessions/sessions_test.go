@@ -0,0 +1,257 @@
+package sessions
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openSQLite returns a store of in-memory SQLite database
+// migrated by the migration of sessions.
+func openSQLite(t *testing.T) *SQLStore {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	b, err := ioutil.ReadFile("../migrations/sqlite3/11_sessions.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := strings.SplitN(string(b), "-- +migrate Down", 2)[0]
+	if _, err := db.Exec(up); err != nil {
+		t.Fatal(err)
+	}
+	return NewSQLStore(db)
+}
+
+var stores = map[string]func(t *testing.T) Store{
+	"memory":  func(t *testing.T) Store { return NewMemoryStore() },
+	"sqlite3": func(t *testing.T) Store { return openSQLite(t) },
+}
+
+func TestStore(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := open(t)
+			a := Record{ID: "a", UserID: 1, Values: []byte("a"), IP: "192.0.2.1", Created: now, LastSeen: now, Expires: now.Add(time.Hour)}
+			b := Record{ID: "b", UserID: 1, Values: []byte("b"), Created: now, LastSeen: now.Add(time.Minute), Expires: now.Add(-time.Minute)}
+			c := Record{ID: "c", UserID: 2, Values: []byte("c"), Created: now, LastSeen: now, Expires: now.Add(time.Hour)}
+			for _, r := range []Record{a, b, c} {
+				if err := s.Insert(r); err != nil {
+					t.Fatalf("insert failed: %s", err)
+				}
+			}
+			if _, err := s.Get("missing"); err != ErrNotFound {
+				t.Errorf("want ErrNotFound, got %v", err)
+			}
+
+			// created is kept on update.
+			a.Values, a.Created = []byte("a2"), now.Add(time.Hour)
+			if err := s.Update(a); err != nil {
+				t.Fatalf("update failed: %s", err)
+			}
+			if err := s.Update(Record{ID: "missing"}); err != ErrNotFound {
+				t.Errorf("want ErrNotFound for updating missing session, got %v", err)
+			}
+			got, err := s.Get("a")
+			if err != nil {
+				t.Fatalf("get failed: %s", err)
+			}
+			if string(got.Values) != "a2" || !got.Created.Equal(now) {
+				t.Errorf("unexpected record: %+v", got)
+			}
+			if err := s.Touch("a", now.Add(2*time.Minute), "192.0.2.2", "curl/7.0"); err != nil {
+				t.Fatalf("touch failed: %s", err)
+			}
+			if got, _ := s.Get("a"); got.IP != "192.0.2.2" || got.UserAgent != "curl/7.0" || !got.LastSeen.Equal(now.Add(2*time.Minute)) {
+				t.Errorf("unexpected record after touch: %+v", got)
+			}
+
+			records, err := s.ByUser(1)
+			if err != nil {
+				t.Fatalf("by user failed: %s", err)
+			}
+			if len(records) != 2 || records[0].ID != "a" || records[1].ID != "b" {
+				t.Errorf("want sessions a and b recently seen first, got %+v", records)
+			}
+			if n, err := s.Purge(now); err != nil || n != 1 {
+				t.Errorf("want 1 session purged, got %d, %v", n, err)
+			}
+			if err := s.DeleteByUser(1); err != nil {
+				t.Fatalf("delete by user failed: %s", err)
+			}
+			if records, _ := s.ByUser(1); len(records) != 0 {
+				t.Errorf("want no sessions, got %+v", records)
+			}
+			if err := s.Delete("c"); err != nil {
+				t.Fatalf("delete failed: %s", err)
+			}
+			if _, err := s.Get("c"); err != ErrNotFound {
+				t.Errorf("want ErrNotFound after delete, got %v", err)
+			}
+		})
+	}
+}
+
+// roundTrip saves the session of the request by the handler, and returns
+// the cookie of the response.
+func roundTrip(t *testing.T, s *ServerStore, c *http.Cookie, h func(w http.ResponseWriter, r *http.Request)) *http.Cookie {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) Firefox/55.0")
+	if c != nil {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h(w, r)
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 {
+		return c
+	}
+	return cookies[0]
+}
+
+func TestServerStore(t *testing.T) {
+	backend := NewMemoryStore()
+	hash, block := securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32)
+	s := NewServerStore(backend, hash, block)
+	// Renew deletes sessions of the package store.
+	old := store
+	store = s
+	defer func() { store = old }()
+
+	var id string
+	cookie := roundTrip(t, s, nil, func(w http.ResponseWriter, r *http.Request) {
+		sess, err := s.Get(r, "user")
+		if err != nil || !sess.IsNew {
+			t.Fatalf("want new session, got %v", err)
+		}
+		sess.Values["id"] = int64(1)
+		if err := s.Save(r, w, sess); err != nil {
+			t.Fatalf("save failed: %s", err)
+		}
+		id = RecordID(sess)
+	})
+	if strings.Contains(cookie.Value, id) || !cookie.HttpOnly {
+		t.Errorf("unexpected cookie: %+v", cookie)
+	}
+	records, _ := backend.ByUser(1)
+	if len(records) != 1 || records[0].ID != id || records[0].Device() != "Firefox on macOS" || records[0].IP != "192.0.2.1" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+
+	// loads values by the cookie, also with rotated keys.
+	rotated := NewServerStore(backend, securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32), hash, block)
+	for _, store := range []*ServerStore{s, rotated} {
+		roundTrip(t, store, cookie, func(w http.ResponseWriter, r *http.Request) {
+			sess, err := store.Get(r, "user")
+			if err != nil || sess.IsNew || sess.Values["id"] != int64(1) {
+				t.Errorf("want saved session, got %v, %v", sess.Values, err)
+			}
+		})
+	}
+
+	// renewed sessions have new ids.
+	renewed := roundTrip(t, s, cookie, func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := s.Get(r, "user")
+		if err := Renew(sess); err != nil {
+			t.Fatalf("renew failed: %s", err)
+		}
+		if err := s.Save(r, w, sess); err != nil {
+			t.Fatalf("save failed: %s", err)
+		}
+	})
+	records, _ = backend.ByUser(1)
+	if len(records) != 1 || records[0].ID == id {
+		t.Fatalf("want only renewed session, got %+v", records)
+	}
+	roundTrip(t, s, cookie, func(w http.ResponseWriter, r *http.Request) {
+		if sess, _ := s.Get(r, "user"); !sess.IsNew {
+			t.Error("session before renewal should be new")
+		}
+	})
+
+	// sessions revoked while requests are served are not brought back.
+	cleared := roundTrip(t, s, renewed, func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := s.Get(r, "user")
+		if err := backend.Delete(records[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		sess.AddFlash("saved after revoked")
+		if err := s.Save(r, w, sess); err != nil {
+			t.Fatalf("save failed: %s", err)
+		}
+	})
+	if records, _ := backend.ByUser(1); len(records) != 0 {
+		t.Errorf("revoked session should not be saved again, got %+v", records)
+	}
+	if cleared.MaxAge >= 0 {
+		t.Errorf("cookie of revoked session should be deleted: %+v", cleared)
+	}
+
+	// revoked sessions are new.
+	roundTrip(t, s, renewed, func(w http.ResponseWriter, r *http.Request) {
+		if sess, _ := s.Get(r, "user"); !sess.IsNew || len(sess.Values) != 0 {
+			t.Errorf("revoked session should be new, got %v", sess.Values)
+		}
+	})
+}
+
+func TestServerStoreExpiry(t *testing.T) {
+	backend := NewMemoryStore()
+	s := NewServerStore(backend, securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32))
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	cookie := roundTrip(t, s, nil, func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := s.Get(r, "user")
+		sess.Options.MaxAge = 60
+		sess.Values["id"] = int64(1)
+		s.Save(r, w, sess)
+	})
+
+	now = now.Add(2 * time.Minute)
+	roundTrip(t, s, cookie, func(w http.ResponseWriter, r *http.Request) {
+		if sess, _ := s.Get(r, "user"); !sess.IsNew {
+			t.Error("expired session should be new")
+		}
+	})
+
+	cookie = roundTrip(t, s, nil, func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := s.Get(r, "user")
+		sess.Values["id"] = int64(1)
+		s.Save(r, w, sess)
+	})
+	roundTrip(t, s, cookie, func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := s.Get(r, "user")
+		sess.Options.MaxAge = -1
+		if err := s.Save(r, w, sess); err != nil {
+			t.Fatalf("clear failed: %s", err)
+		}
+	})
+	if records, _ := backend.ByUser(1); len(records) != 1 {
+		t.Errorf("want only expired session left, got %+v", records)
+	}
+}
+
+func TestDevice(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/60.0.3112.113 Safari/537.36":                     "Chrome on Windows",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 10_3 like Mac OS X) AppleWebKit/603.1.30 (KHTML, like Gecko) Version/10.0 Mobile/14E277 Safari/602.1": "Safari on iOS",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:55.0) Gecko/20100101 Firefox/55.0":                                                                    "Firefox on Linux",
+		"curl/7.54.0": "curl",
+		"":            "Unknown browser",
+	}
+	for ua, want := range tests {
+		if got := (Record{UserAgent: ua}).Device(); got != want {
+			t.Errorf("%q: want %s, got %s", ua, want, got)
+		}
+	}
+}
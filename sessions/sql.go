@@ -0,0 +1,95 @@
+package sessions
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SQLStore keeps sessions in sessions table of MySQL or SQLite,
+// so that instances sharing the database share sessions.
+type SQLStore struct {
+	DB *sql.DB
+}
+
+// NewSQLStore returns a store of the database.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{DB: db}
+}
+
+// Get implements Store.
+func (s *SQLStore) Get(id string) (Record, error) {
+	r := Record{ID: id}
+	err := s.DB.QueryRow(`select user_id, session_values, user_agent, ip, created, last_seen, expires from sessions where session_id = ?`, id).
+		Scan(&r.UserID, &r.Values, &r.UserAgent, &r.IP, &r.Created, &r.LastSeen, &r.Expires)
+	if err == sql.ErrNoRows {
+		return Record{}, ErrNotFound
+	}
+	return r, err
+}
+
+// Insert implements Store.
+func (s *SQLStore) Insert(r Record) error {
+	_, err := s.DB.Exec(`insert into sessions (session_id, user_id, session_values, user_agent, ip, created, last_seen, expires) values(?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.UserID, r.Values, r.UserAgent, r.IP, r.Created.UTC(), r.LastSeen.UTC(), r.Expires.UTC())
+	return err
+}
+
+// Update implements Store.
+func (s *SQLStore) Update(r Record) error {
+	result, err := s.DB.Exec(`update sessions set user_id = ?, session_values = ?, user_agent = ?, ip = ?, last_seen = ?, expires = ? where session_id = ?`,
+		r.UserID, r.Values, r.UserAgent, r.IP, r.LastSeen.UTC(), r.Expires.UTC(), r.ID)
+	if err != nil {
+		return err
+	}
+	// MySQL counts only changed rows, so check existence of unchanged ones.
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	_, err = s.Get(r.ID)
+	return err
+}
+
+// Touch implements Store.
+func (s *SQLStore) Touch(id string, at time.Time, ip, userAgent string) error {
+	_, err := s.DB.Exec(`update sessions set last_seen = ?, ip = ?, user_agent = ? where session_id = ?`, at.UTC(), ip, userAgent, id)
+	return err
+}
+
+// Delete implements Store.
+func (s *SQLStore) Delete(id string) error {
+	_, err := s.DB.Exec(`delete from sessions where session_id = ?`, id)
+	return err
+}
+
+// ByUser implements Store.
+func (s *SQLStore) ByUser(userID int64) ([]Record, error) {
+	rows, err := s.DB.Query(`select session_id, user_id, session_values, user_agent, ip, created, last_seen, expires from sessions where user_id = ? order by last_seen desc`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []Record
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(&r.ID, &r.UserID, &r.Values, &r.UserAgent, &r.IP, &r.Created, &r.LastSeen, &r.Expires); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// DeleteByUser implements Store.
+func (s *SQLStore) DeleteByUser(userID int64) error {
+	_, err := s.DB.Exec(`delete from sessions where user_id = ?`, userID)
+	return err
+}
+
+// Purge implements Store.
+func (s *SQLStore) Purge(before time.Time) (int64, error) {
+	result, err := s.DB.Exec(`delete from sessions where expires < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,198 @@
+package sessions
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when the session does not exist.
+var ErrNotFound = errors.New("sessions: session not found")
+
+// Record is a session kept on the server.
+type Record struct {
+	// ID is the hash of the token in the cookie, so that cookies cannot be
+	// made from records.
+	ID string
+	// UserID is the user logged in by the session, or 0.
+	UserID int64
+	// Values are values of the session encoded by gob.
+	Values    []byte
+	UserAgent string
+	IP        string
+	Created   time.Time
+	LastSeen  time.Time
+	Expires   time.Time
+}
+
+// Device returns a short description of the user agent of the session, such
+// as "Firefox on Windows".
+func (r Record) Device() string {
+	ua := r.UserAgent
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, os := range []struct{ token, name string }{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "Chrome OS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, os.token) {
+			return browser + " on " + os.name
+		}
+	}
+	return browser
+}
+
+// Store keeps sessions on the server, so that they can be revoked.
+// MemoryStore works in a single process. SQLStore shares sessions among
+// instances behind a load balancer.
+type Store interface {
+	// Get returns the session of the id.
+	Get(id string) (Record, error)
+	// Insert creates the session.
+	Insert(r Record) error
+	// Update updates the session, keeping when it is created. It returns
+	// ErrNotFound if the session does not exist, such as revoked ones.
+	Update(r Record) error
+	// Touch updates when the session is last seen, and by whom.
+	Touch(id string, at time.Time, ip, userAgent string) error
+	// Delete deletes the session. Missing sessions are not errors.
+	Delete(id string) error
+	// ByUser returns sessions of the user, recently seen first.
+	ByUser(userID int64) ([]Record, error)
+	// DeleteByUser deletes all sessions of the user.
+	DeleteByUser(userID int64) error
+	// Purge deletes sessions expired before the time, and returns the
+	// number of them.
+	Purge(before time.Time) (int64, error)
+}
+
+// MemoryStore keeps sessions in memory.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// NewMemoryStore returns an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(id string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return r, nil
+}
+
+// Insert implements Store.
+func (s *MemoryStore) Insert(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[r.ID] = r
+	return nil
+}
+
+// Update implements Store.
+func (s *MemoryStore) Update(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.records[r.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	r.Created = old.Created
+	s.records[r.ID] = r
+	return nil
+}
+
+// Touch implements Store.
+func (s *MemoryStore) Touch(id string, at time.Time, ip, userAgent string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[id]
+	if !ok {
+		return nil
+	}
+	r.LastSeen, r.IP, r.UserAgent = at, ip, userAgent
+	s.records[id] = r
+	return nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, id)
+	return nil
+}
+
+// ByUser implements Store.
+func (s *MemoryStore) ByUser(userID int64) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var records []Record
+	for _, r := range s.records {
+		if r.UserID == userID {
+			records = append(records, r)
+		}
+	}
+	sort.Sort(byLastSeen(records))
+	return records, nil
+}
+
+// DeleteByUser implements Store.
+func (s *MemoryStore) DeleteByUser(userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, r := range s.records {
+		if r.UserID == userID {
+			delete(s.records, id)
+		}
+	}
+	return nil
+}
+
+// Purge implements Store.
+func (s *MemoryStore) Purge(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, r := range s.records {
+		if r.Expires.Before(before) {
+			delete(s.records, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// byLastSeen sorts records by last seen time, recent first.
+type byLastSeen []Record
+
+func (s byLastSeen) Len() int           { return len(s) }
+func (s byLastSeen) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLastSeen) Less(i, j int) bool { return s[i].LastSeen.After(s[j].LastSeen) }
@@ -0,0 +1,186 @@
+// Package sso implements single sign-on by OpenID Connect.
+//
+// The provider is discovered from its issuer URL. Logins use the
+// authorization code flow with PKCE, and the ID token is verified with
+// the nonce sent in the authorization request.
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+
+	oidc "github.com/coreos/go-oidc"
+	"github.com/suzuken/wiki/model"
+	"golang.org/x/oauth2"
+)
+
+var (
+	// ErrNoIDToken is returned when the token response has no ID token.
+	ErrNoIDToken = errors.New("sso: no id_token in token response")
+	// ErrNonce is returned when the nonce of the ID token is not the one
+	// sent in the authorization request.
+	ErrNonce = errors.New("sso: nonce of id_token does not match")
+)
+
+// Config is configuration of an OpenID Connect provider.
+type Config struct {
+	// Issuer is the URL of the provider. Its configuration is discovered
+	// at Issuer + "/.well-known/openid-configuration".
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the URL of the callback registered at the provider,
+	// like https://wiki.example.com/login/oidc/callback.
+	RedirectURL string
+	// GroupsClaim is the claim of ID tokens listing groups of the user.
+	// Default is "groups".
+	GroupsClaim string
+	// Roles maps groups of the provider to roles of the wiki. If it is not
+	// empty, roles of users are set by their groups on every login.
+	// Users in no group of Roles become viewers.
+	Roles map[string]string
+}
+
+// Claims are claims of the user given by the ID token.
+type Claims struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+// Provider is an OpenID Connect provider which users log in by.
+type Provider struct {
+	config   Config
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// New discovers the provider of the configuration. Requests to the provider
+// are sent by the HTTP client of ctx given by oidc.ClientContext, if any.
+func New(ctx context.Context, c Config) (*Provider, error) {
+	p, err := oidc.NewProvider(ctx, c.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	if c.GroupsClaim == "" {
+		c.GroupsClaim = "groups"
+	}
+	return &Provider{
+		config: c,
+		oauth2: oauth2.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURL:  c.RedirectURL,
+			Endpoint:     p.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+		verifier: p.Verifier(&oidc.Config{ClientID: c.ClientID}),
+	}, nil
+}
+
+// NewSecret returns a random string for state, nonce and PKCE code verifier.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// challenge returns the S256 code challenge of the code verifier.
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL of the provider to log in. state and
+// nonce must be checked on callback, and verifier must be given to
+// Exchange.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth2.AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.SetAuthURLParam("code_challenge", challenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+}
+
+// Exchange exchanges the authorization code for the ID token, verifies it
+// with the nonce, and returns its claims.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return Claims{}, err
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Claims{}, ErrNoIDToken
+	}
+	idToken, err := p.verifier.Verify(ctx, raw)
+	if err != nil {
+		return Claims{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		return Claims{}, ErrNonce
+	}
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return Claims{}, err
+	}
+	var all map[string]interface{}
+	if err := idToken.Claims(&all); err != nil {
+		return Claims{}, err
+	}
+	return Claims{
+		Issuer:        idToken.Issuer,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		Groups:        groups(all[p.config.GroupsClaim]),
+	}, nil
+}
+
+// groups returns names of groups of the claim, which is a list of strings
+// or a string.
+func groups(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var gs []string
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				gs = append(gs, s)
+			}
+		}
+		return gs
+	}
+	return nil
+}
+
+// Role returns the most privileged role mapped from the groups. ok is false
+// if roles are not mapped by the configuration.
+func (p *Provider) Role(groups []string) (role string, ok bool) {
+	if len(p.config.Roles) == 0 {
+		return "", false
+	}
+	for i := len(model.Roles) - 1; i >= 0; i-- {
+		for _, g := range groups {
+			if p.config.Roles[g] == model.Roles[i] {
+				return model.Roles[i], true
+			}
+		}
+	}
+	return model.RoleViewer, true
+}
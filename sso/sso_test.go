@@ -0,0 +1,118 @@
+package sso_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/suzuken/wiki/sso"
+	"github.com/suzuken/wiki/sso/ssotest"
+)
+
+// authorize follows the URL to the provider and returns the code and the
+// state given to the redirect URL.
+func authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("want redirect, got %d", resp.StatusCode)
+	}
+	u, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("code"), u.Query().Get("state")
+}
+
+func TestProvider(t *testing.T) {
+	idp := ssotest.NewServer("wiki", "secret")
+	defer idp.Close()
+	ctx := context.Background()
+	p, err := sso.New(ctx, sso.Config{
+		Issuer:       idp.URL,
+		ClientID:     "wiki",
+		ClientSecret: "secret",
+		RedirectURL:  "http://wiki.example.com/login/oidc/callback",
+	})
+	if err != nil {
+		t.Fatalf("discovery failed: %s", err)
+	}
+	idp.SetClaims(map[string]interface{}{
+		"sub":            "alice-id",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "alice",
+		"groups":         []string{"staff", "wiki-admins"},
+	})
+
+	code, state := authorize(t, p.AuthCodeURL("state", "nonce", "verifier-verifier-verifier-verifier-verif"))
+	if state != "state" {
+		t.Errorf("want state, got %q", state)
+	}
+	claims, err := p.Exchange(ctx, code, "verifier-verifier-verifier-verifier-verif", "nonce")
+	if err != nil {
+		t.Fatalf("exchange failed: %s", err)
+	}
+	want := sso.Claims{
+		Issuer:        idp.URL,
+		Subject:       "alice-id",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		Name:          "alice",
+		Groups:        []string{"staff", "wiki-admins"},
+	}
+	if !reflect.DeepEqual(claims, want) {
+		t.Errorf("want %+v, got %+v", want, claims)
+	}
+
+	// codes can not be exchanged without the verifier of PKCE.
+	code, _ = authorize(t, p.AuthCodeURL("state", "nonce", "verifier-verifier-verifier-verifier-verif"))
+	if _, err := p.Exchange(ctx, code, "wrong-verifier", "nonce"); err == nil {
+		t.Error("want error for wrong verifier")
+	}
+	code, _ = authorize(t, p.AuthCodeURL("state", "nonce", "verifier-verifier-verifier-verifier-verif"))
+	if _, err := p.Exchange(ctx, code, "verifier-verifier-verifier-verifier-verif", "other"); err != sso.ErrNonce {
+		t.Errorf("want ErrNonce, got %v", err)
+	}
+}
+
+func TestRole(t *testing.T) {
+	idp := ssotest.NewServer("wiki", "secret")
+	defer idp.Close()
+	roles := map[string]string{"wiki-admins": "admin", "staff": "editor"}
+	p, err := sso.New(context.Background(), sso.Config{Issuer: idp.URL, ClientID: "wiki", Roles: roles})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		groups []string
+		want   string
+	}{
+		{[]string{"staff", "wiki-admins"}, "admin"},
+		{[]string{"staff"}, "editor"},
+		{[]string{"sales"}, "viewer"},
+		{nil, "viewer"},
+	}
+	for _, tt := range tests {
+		if got, ok := p.Role(tt.groups); !ok || got != tt.want {
+			t.Errorf("%v: want %s, got %s, %t", tt.groups, tt.want, got, ok)
+		}
+	}
+
+	p, err = sso.New(context.Background(), sso.Config{Issuer: idp.URL, ClientID: "wiki"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Role([]string{"wiki-admins"}); ok {
+		t.Error("roles should not be mapped without configuration")
+	}
+}
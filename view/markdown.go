@@ -0,0 +1,46 @@
+package view
+
+import (
+	"html/template"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday"
+)
+
+const (
+	markdownExtensions = blackfriday.EXTENSION_NO_INTRA_EMPHASIS |
+		blackfriday.EXTENSION_TABLES |
+		blackfriday.EXTENSION_FENCED_CODE |
+		blackfriday.EXTENSION_AUTOLINK |
+		blackfriday.EXTENSION_STRIKETHROUGH |
+		blackfriday.EXTENSION_SPACE_HEADERS |
+		blackfriday.EXTENSION_HEADER_IDS |
+		blackfriday.EXTENSION_AUTO_HEADER_IDS
+
+	markdownHTMLFlags = blackfriday.HTML_USE_XHTML
+)
+
+// policy sanitizes HTML rendered from markdown. Since article body is
+// written by users, raw HTML in it must not be trusted.
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	// heading anchors generated by blackfriday.
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	// wiki links, see replaceWikiLinks.
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^wikilink( wikilink-new)?$`)).OnElements("a")
+	// language of fenced code blocks.
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+	return p
+}
+
+// Markdown renders markdown text into sanitized HTML.
+// Fenced code blocks, tables and heading anchors are supported.
+// Wiki links like [[Title]] are resolved by links.
+func Markdown(src string, links Links) template.HTML {
+	renderer := blackfriday.HtmlRenderer(markdownHTMLFlags, "", "")
+	unsafe := blackfriday.Markdown([]byte(replaceWikiLinks(src, links)), renderer, markdownExtensions)
+	return template.HTML(policy.SanitizeBytes(unsafe))
+}
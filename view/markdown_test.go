@@ -0,0 +1,50 @@
+package view
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdown(t *testing.T) {
+	cases := []struct {
+		src  string
+		want []string
+	}{
+		{"# Hello wiki", []string{`<h1 id="hello-wiki">Hello wiki</h1>`}},
+		{"## 見出し", []string{`<h2 id="見出し">見出し</h2>`}},
+		{"```go\nfmt.Println(\"<b>\")\n```", []string{
+			`<pre><code class="language-go">`,
+			`fmt.Println(&#34;&lt;b&gt;&#34;)`,
+		}},
+		{"a | b\n--- | ---\n1 | 2\n", []string{"<table>", "<th>a</th>", "<td>2</td>"}},
+		{"- one\n- two\n", []string{"<ul>", "<li>one</li>"}},
+		{"[link](https://example.com/)", []string{`<a href="https://example.com/" rel="nofollow">link</a>`}},
+	}
+	for _, c := range cases {
+		got := string(Markdown(c.src, nil))
+		for _, w := range c.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("Markdown(%q): want %q in %q", c.src, w, got)
+			}
+		}
+	}
+}
+
+func TestMarkdownSanitize(t *testing.T) {
+	cases := []struct {
+		src    string
+		unsafe string
+	}{
+		{"<script>alert(1)</script>", "<script"},
+		{`<a href="javascript:alert(1)">x</a>`, "javascript:"},
+		{"[x](javascript:alert(1))", "javascript:"},
+		{`<img src="x.png" onerror="alert(1)">`, "onerror"},
+		{`<h1 id="x" onclick="alert(1)">x</h1>`, "onclick"},
+		{"<div style=\"position:fixed\">x</div>", "style"},
+	}
+	for _, c := range cases {
+		if got := string(Markdown(c.src, nil)); strings.Contains(got, c.unsafe) {
+			t.Errorf("Markdown(%q): %q must be sanitized, got %q", c.src, c.unsafe, got)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package view
+
+import (
+	"fmt"
+	"time"
+)
+
+// Since returns human readable duration from t to now, such as "3 minutes".
+func Since(t time.Time) string {
+	return duration(time.Since(t))
+}
+
+func duration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "less than a minute"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour")
+	}
+	return plural(int(d/(24*time.Hour)), "day")
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
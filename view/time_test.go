@@ -0,0 +1,24 @@
+package view
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{10 * time.Second, "less than a minute"},
+		{time.Minute, "1 minute"},
+		{3*time.Minute + 20*time.Second, "3 minutes"},
+		{2 * time.Hour, "2 hours"},
+		{50 * time.Hour, "2 days"},
+	}
+	for _, tt := range tests {
+		if got := duration(tt.d); got != tt.want {
+			t.Errorf("%s: want %q, got %q", tt.d, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package view
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// wikiLinkPattern matches wiki links like [[Title]] and [[Title|label]].
+var wikiLinkPattern = regexp.MustCompile(`\[\[([^\[\]|]+)(?:\|([^\[\]]+))?\]\]`)
+
+// articleURLPattern matches URLs of articles like /article/{id}.
+// Absolute URLs are matched by their paths.
+var articleURLPattern = regexp.MustCompile(`/article/(\d+)`)
+
+// Links maps titles of articles to their ids for resolving wiki links.
+type Links map[string]int64
+
+// lookup finds the article id for title. Titles are compared
+// case-insensitively as the database does.
+func (l Links) lookup(title string) (int64, bool) {
+	if id, ok := l[title]; ok {
+		return id, true
+	}
+	for t, id := range l {
+		if strings.EqualFold(t, title) {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// WikiLinkTitles returns titles linked from src by wiki links.
+// Links in code blocks and code spans are ignored.
+func WikiLinkTitles(src string) []string {
+	var titles []string
+	seen := make(map[string]bool)
+	eachText(src, func(s string) string {
+		for _, m := range wikiLinkPattern.FindAllStringSubmatch(s, -1) {
+			title := strings.TrimSpace(m[1])
+			if title == "" || seen[title] {
+				continue
+			}
+			seen[title] = true
+			titles = append(titles, title)
+		}
+		return s
+	})
+	return titles
+}
+
+// ArticleRefs returns ids of articles linked from src by their URLs.
+// URLs in code blocks and code spans are ignored.
+func ArticleRefs(src string) []int64 {
+	var ids []int64
+	seen := make(map[int64]bool)
+	eachText(src, func(s string) string {
+		for _, m := range articleURLPattern.FindAllStringSubmatch(s, -1) {
+			id, err := strconv.ParseInt(m[1], 10, 64)
+			if err != nil || seen[id] {
+				continue
+			}
+			seen[id] = true
+			ids = append(ids, id)
+		}
+		return s
+	})
+	return ids
+}
+
+// replaceWikiLinks rewrites wiki links in src into HTML links.
+// Links to missing articles point to the page to create them.
+func replaceWikiLinks(src string, links Links) string {
+	return eachText(src, func(s string) string {
+		return wikiLinkPattern.ReplaceAllStringFunc(s, func(link string) string {
+			m := wikiLinkPattern.FindStringSubmatch(link)
+			title, label := strings.TrimSpace(m[1]), strings.TrimSpace(m[2])
+			if title == "" {
+				return link
+			}
+			if label == "" {
+				label = title
+			}
+			if id, ok := links.lookup(title); ok {
+				return fmt.Sprintf(`<a class="wikilink" href="/article/%d">%s</a>`, id, html.EscapeString(label))
+			}
+			return fmt.Sprintf(`<a class="wikilink wikilink-new" href="/new?title=%s" title="create this page">%s</a>`,
+				html.EscapeString(url.QueryEscape(title)), html.EscapeString(label))
+		})
+	})
+}
+
+// eachText applies f to parts of markdown src which are not code,
+// and returns src with the parts replaced by results of f.
+func eachText(src string, f func(string) string) string {
+	lines := strings.SplitAfter(src, "\n")
+	var fence string
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if len(line)-len(trimmed) < 4 {
+			if strings.HasPrefix(trimmed, "```") {
+				fence = "```"
+				continue
+			}
+			if strings.HasPrefix(trimmed, "~~~") {
+				fence = "~~~"
+				continue
+			}
+		}
+		// code spans are between backquotes.
+		spans := strings.Split(line, "`")
+		for j := 0; j < len(spans); j += 2 {
+			// unclosed backquote is not a code span.
+			if j+1 == len(spans)-1 && len(spans)%2 == 0 {
+				spans[j] = f(spans[j] + "`" + spans[j+1])
+				spans = spans[:j+1]
+				break
+			}
+			spans[j] = f(spans[j])
+		}
+		lines[i] = strings.Join(spans, "`")
+	}
+	return strings.Join(lines, "")
+}
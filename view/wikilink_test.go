@@ -0,0 +1,47 @@
+package view
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWikiLinkTitles(t *testing.T) {
+	src := "see [[Go]] and [[ Go ]], [[Wiki|the wiki]].\n" +
+		"`[[Inline code]]` is not a link, but [[After code]] is.\n" +
+		"```\n[[Fenced]]\n```\n" +
+		"[[]] [[日本語の記事]]\n"
+	want := []string{"Go", "Wiki", "After code", "日本語の記事"}
+	if got := WikiLinkTitles(src); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestArticleRefs(t *testing.T) {
+	src := "[first](/article/1), see also http://wiki.example.com/article/2/history.\n" +
+		"/article/1 again, `/article/3` in code.\n"
+	want := []int64{1, 2}
+	if got := ArticleRefs(src); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestMarkdownWikiLinks(t *testing.T) {
+	links := Links{"Go": 1, "Wiki": 2}
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"[[Go]]", `<a class="wikilink" href="/article/1" rel="nofollow">Go</a>`},
+		{"[[go]]", `<a class="wikilink" href="/article/1" rel="nofollow">go</a>`},
+		{"[[Wiki|the <b>wiki</b>]]", `<a class="wikilink" href="/article/2" rel="nofollow">the &lt;b&gt;wiki&lt;/b&gt;</a>`},
+		{"[[No such page]]", `<a class="wikilink wikilink-new" href="/new?title=No+such+page" title="create this page" rel="nofollow">No such page</a>`},
+		{"[[A&B]]", `href="/new?title=A%26B"`},
+		{"`[[Go]]`", `<code>[[Go]]</code>`},
+	}
+	for _, c := range cases {
+		if got := string(Markdown(c.src, links)); !strings.Contains(got, c.want) {
+			t.Errorf("Markdown(%q): want %q in %q", c.src, c.want, got)
+		}
+	}
+}
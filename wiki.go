@@ -1,53 +1,220 @@
 package wiki
 
 import (
-	"database/sql"
+	"context"
 	"html/template"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
+	"github.com/suzuken/wiki/config"
 	"github.com/suzuken/wiki/controller"
 	"github.com/suzuken/wiki/db"
+	"github.com/suzuken/wiki/editlock"
+	"github.com/suzuken/wiki/mail"
+	"github.com/suzuken/wiki/model"
+	"github.com/suzuken/wiki/ratelimit"
+	"github.com/suzuken/wiki/search"
+	"github.com/suzuken/wiki/sessions"
+	"github.com/suzuken/wiki/sso"
 	"github.com/suzuken/wiki/view"
 
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/gorilla/context"
-	"github.com/gorilla/csrf"
+	gcontext "github.com/gorilla/context"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 // Server is whole server implementation for this wiki app.
-// This holds database connection and router settings.
+// This holds storage and router settings.
 type Server struct {
-	db      *sql.DB
+	store   model.Store
+	index   *search.Index
 	handler http.Handler
+	// failures are failed logins shared by instances using the same database.
+	failures ratelimit.Store
+	// sessions are sessions of users, kept in the database unless
+	// MemorySessions is set.
+	sessions sessions.Store
+	// sso is the provider of single sign-on discovered by OIDC.
+	sso *sso.Provider
+	// auth checks passwords by the authentication configured for the
+	// environment.
+	auth model.Authenticator
+	// csrfKeys sign CSRF tokens, the first of which signs new ones.
+	csrfKeys [][]byte
+
+	// Mailer sends emails such as links to reset passwords.
+	// If nil, emails are written to stderr.
+	Mailer mail.Mailer
+	// BaseURL is the URL of the wiki used in emails,
+	// like https://wiki.example.com.
+	BaseURL string
+	// UnverifiedTTL is how long users who have not verified their email
+	// addresses are kept. 0 keeps them forever.
+	UnverifiedTTL time.Duration
+	// MemorySessions keeps sessions in memory even with a database. They are
+	// lost on exit, and not shared among instances.
+	MemorySessions bool
+	// ConfigFile is the YAML file of secret keys for each environment.
+	// Keys are also read from environment variables; see package config.
+	ConfigFile string
+	// OIDC enables single sign-on by the OpenID Connect provider.
+	// If RedirectURL is empty, it is /login/oidc/callback of BaseURL.
+	OIDC *sso.Config
+
+	// stop stops background jobs.
+	stop chan struct{}
 }
 
-// Close makes the database connection to close.
+// Close makes the storage to close.
 func (s *Server) Close() error {
-	return s.db.Close()
+	if s.stop != nil {
+		close(s.stop)
+	}
+	return s.store.Close()
 }
 
 // Init initialize server state. Connecting to database, compiling templates,
 // and settings router.
 func (s *Server) Init(dbconf, env string, debug bool) {
+	conf, err := config.Load(s.ConfigFile, env)
+	if err != nil {
+		log.Fatalf("cannot load configuration. exit. %s", err)
+	}
+	s.csrfKeys = conf.CSRFKeys
+
 	cs, err := db.NewConfigsFromFile(dbconf)
 	if err != nil {
 		log.Fatalf("cannot open database configuration. exit. %s", err)
 	}
-	db, err := cs.Open(env)
+	store, err := cs.Store(env)
 	if err != nil {
 		log.Fatalf("db initialization failed: %s", err)
 	}
+	auth, err := cs.Authenticator(env, store)
+	if err != nil {
+		log.Fatalf("auth initialization failed: %s", err)
+	}
 
 	// In debug mode, we compile templates on every request.
 	view.Init(template.FuncMap{
-		"LoggedIn":    controller.LoggedIn,
-		"CurrentName": controller.CurrentName,
-		"Flash":       controller.Flash,
+		"LoggedIn":      controller.LoggedIn,
+		"CurrentName":   controller.CurrentName,
+		"CurrentUserID": controller.CurrentUserID,
+		"Can":           controller.Can,
+		"Flash":         controller.Flash,
+		"Markdown":      view.Markdown,
+		"Since":         view.Since,
 	}, debug)
 
-	s.db = db
+	s.store = store
+	s.auth = auth
+	s.failures = ratelimit.NewMemoryStore()
+	s.sessions = sessions.NewMemoryStore()
+	if sqlStore, ok := store.(*model.SQLStore); ok {
+		s.failures = ratelimit.NewSQLStore(sqlStore.DB)
+		if !s.MemorySessions {
+			s.sessions = sessions.NewSQLStore(sqlStore.DB)
+		}
+	}
+	sessions.UseServerStore(s.sessions, conf.SessionKeyPairs()...)
+	if s.Mailer == nil {
+		s.Mailer = mail.NewLog(os.Stderr, "wiki@localhost")
+	}
+	if s.OIDC != nil {
+		c := *s.OIDC
+		if c.RedirectURL == "" {
+			c.RedirectURL = s.BaseURL + "/login/oidc/callback"
+		}
+		p, err := sso.New(context.Background(), c)
+		if err != nil {
+			log.Fatalf("discovering OpenID Connect provider failed: %s", err)
+		}
+		s.sso = p
+	}
+	index, err := buildIndex(store)
+	if err != nil {
+		log.Fatalf("building search index failed: %s", err)
+	}
+	s.index = index
+	if err := buildLinks(store); err != nil {
+		log.Fatalf("recording links between articles failed: %s", err)
+	}
 	s.Route()
+	s.stop = make(chan struct{})
+	go purgeExpiredSessions(s.sessions, s.stop)
+	if s.UnverifiedTTL > 0 {
+		go purgeUnverifiedUsers(s.store, s.UnverifiedTTL, s.stop)
+	}
+}
+
+// purgeInterval is how often unverified users are purged.
+const purgeInterval = time.Hour
+
+// purgeUnverifiedUsers deletes users who have not verified their email
+// addresses for ttl, every purgeInterval until stop is closed.
+func purgeUnverifiedUsers(store model.EmailVerificationStore, ttl time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(purgeInterval)
+	defer t.Stop()
+	for {
+		n, err := store.PurgeUnverifiedUsers(time.Now().Add(-ttl))
+		if err != nil {
+			log.Printf("purging unverified users failed: %s", err)
+		} else if n > 0 {
+			log.Printf("purged %d unverified users", n)
+		}
+		select {
+		case <-t.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// purgeExpiredSessions deletes expired sessions every purgeInterval until
+// stop is closed.
+func purgeExpiredSessions(store sessions.Store, stop <-chan struct{}) {
+	t := time.NewTicker(purgeInterval)
+	defer t.Stop()
+	for {
+		if _, err := store.Purge(time.Now()); err != nil {
+			log.Printf("purging expired sessions failed: %s", err)
+		}
+		select {
+		case <-t.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// buildIndex makes search index of all articles.
+func buildIndex(store model.ArticleStore) (*search.Index, error) {
+	articles, err := store.ArticlesAll(model.Principal{Admin: true})
+	if err != nil {
+		return nil, err
+	}
+	index := search.NewIndex()
+	for _, a := range articles {
+		index.Add(search.Document{ID: a.ID, Title: a.Title, Body: a.Body})
+	}
+	return index, nil
+}
+
+// buildLinks records links of all articles, so that backlinks and reports
+// of links cover articles saved before links were recorded.
+func buildLinks(store model.ArticleStore) error {
+	articles, err := store.ArticlesAll(model.Principal{Admin: true})
+	if err != nil {
+		return err
+	}
+	for _, a := range articles {
+		if err := store.SaveLinks(a, view.ArticleRefs(a.Body), view.WikiLinkTitles(a.Body)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // New returns server object.
@@ -55,37 +222,124 @@ func New() *Server {
 	return &Server{}
 }
 
-// csrfProtectKey should have 32 byte length.
-var csrfProtectKey = []byte("32-byte-long-auth-key")
-
 // Run starts running http server.
 func (s *Server) Run(addr string) {
 	log.Printf("start listening on %s", addr)
 
-	// NOTE: when you serve on TLS, make csrf.Secure(true)
-	CSRF := csrf.Protect(
-		csrfProtectKey, csrf.Secure(false))
-	http.ListenAndServe(addr, context.ClearHandler(CSRF(s.handler)))
+	// NOTE: when you serve on TLS, make secure true.
+	CSRF := ProtectCSRF(s.csrfKeys, false, s.handler)
+	http.ListenAndServe(addr, gcontext.ClearHandler(TokenAuth(s.store, CSRF)))
 }
 
 // Route setting router for this wiki.
 func (s *Server) Route() {
 	mux := http.NewServeMux()
 
-	article := &controller.Article{DB: s.db}
-	user := &controller.User{DB: s.db}
+	article := &controller.Article{
+		Store: s.store,
+		Users: s.store,
+		Index: s.index,
+		Locks: editlock.New(editlock.DefaultTTL),
+	}
+	user := &controller.User{
+		Store:         s.store,
+		Auth:          s.auth,
+		Articles:      s.store,
+		Groups:        s.store,
+		Resets:        s.store,
+		Verifications: s.store,
+		Mailer:        s.Mailer,
+		BaseURL:       s.BaseURL,
+		Accounts:      ratelimit.New(s.failures, "account:", ratelimit.DefaultAccountPolicy),
+		IPs:           ratelimit.New(s.failures, "ip:", ratelimit.DefaultIPPolicy),
+		ResetAccounts: ratelimit.New(s.failures, "reset-account:", ratelimit.DefaultResetPolicy),
+		ResetIPs:      ratelimit.New(s.failures, "reset-ip:", ratelimit.DefaultResetIPPolicy),
+		MFA:           s.store,
+		Settings:      s.store,
+		SSO:           s.sso != nil,
+		Sessions:      s.sessions,
+	}
+	token := &controller.Token{Store: s.store}
+	session := &controller.Session{Store: s.sessions}
+	acl := &controller.ACL{Store: s.store, Users: s.store, Groups: s.store, Articles: s.store}
 
 	mux.Handle("/authtest", GET(Auth(controller.AuthTestHandler)))
-	mux.Handle("/new", GET(controller.NewArticleHandler))
-	mux.Handle("/article/", GET(article.Get))
+	mux.Handle("/new", GET(Require(model.PermEdit, controller.NewArticleHandler)))
+	// operations on articles are authorized by the article controller,
+	// since ACLs of articles may grant them beyond roles.
+	mux.Handle("/article/", byMethod(map[string]handler{
+		"GET":  article.Get,
+		"POST": Auth(article.Revert),
+	}))
 	mux.Handle("/article/edit/", GET(Auth(article.Edit)))
-	mux.Handle("/save", POST(Auth(article.Save)))
+	mux.Handle("/save", articleHandler(POST(Auth(article.Save))))
 	mux.Handle("/delete", POST(Auth(article.Delete)))
 	mux.Handle("/logout", handler(user.LogoutHandler))
+	mux.Handle("/settings/tokens", byMethod(map[string]handler{
+		"GET":  Auth(token.List),
+		"POST": Auth(token.Create),
+	}))
+	mux.Handle("/settings/tokens/revoke", POST(Auth(token.Revoke)))
+	mux.Handle("/settings/sessions", GET(Auth(session.List)))
+	mux.Handle("/settings/sessions/revoke", POST(Auth(session.Revoke)))
+	mux.Handle("/settings/sessions/revoke-all", POST(Auth(session.RevokeAll)))
+	mux.Handle("/settings/mfa", GET(Auth(user.MFASettings)))
+	mux.Handle("/settings/mfa/enroll", POST(Auth(user.EnrollMFA)))
+	mux.Handle("/settings/mfa/confirm", POST(Auth(user.ConfirmMFA)))
+	mux.Handle("/settings/mfa/recovery", POST(Auth(user.RegenerateRecoveryCodes)))
+	mux.Handle("/settings/mfa/disable", POST(Auth(user.DisableMFA)))
+	mux.Handle("/search", GET(article.Search))
+	mux.Handle("/reports/orphans", GET(article.Orphans))
+	mux.Handle("/reports/broken-links", GET(article.BrokenLinks))
+
+	mux.Handle("/api/v1/articles", apiHandler(byMethod(map[string]handler{
+		"GET":  article.APIList,
+		"POST": Auth(article.APICreate),
+	})))
+	mux.Handle("/api/v1/articles/", apiHandler(byMethod(map[string]handler{
+		"GET":    article.APIGet,
+		"PUT":    Auth(article.APIUpdate),
+		"DELETE": Auth(article.APIDelete),
+	})))
 
 	mux.Handle("/", GET(article.Root))
 	mux.Handle("/signup", handler(user.SignupHandler))
+	mux.Handle("/user/", GET(user.Profile))
+	mux.Handle("/admin/users", byMethod(map[string]handler{
+		"GET":  Require(model.PermAdmin, user.Roles),
+		"POST": Require(model.PermAdmin, user.SetRole),
+	}))
+	mux.Handle("/admin/groups", byMethod(map[string]handler{
+		"GET":  Require(model.PermAdmin, user.ListGroups),
+		"POST": Require(model.PermAdmin, user.CreateGroup),
+	}))
+	mux.Handle("/admin/groups/", byMethod(map[string]handler{
+		"GET":  Require(model.PermAdmin, user.ShowGroup),
+		"POST": Require(model.PermAdmin, user.EditGroup),
+	}))
+	mux.Handle("/admin/acl", byMethod(map[string]handler{
+		"GET":  Require(model.PermAdmin, acl.List),
+		"POST": Require(model.PermAdmin, acl.Create),
+	}))
+	mux.Handle("/admin/acl/delete", POST(Require(model.PermAdmin, acl.Delete)))
+	mux.Handle("/admin/lockouts", GET(Require(model.PermAdmin, user.Lockouts)))
+	mux.Handle("/admin/lockouts/unlock", POST(Require(model.PermAdmin, user.Unlock)))
+	mux.Handle("/admin/mfa", byMethod(map[string]handler{
+		"GET":  Require(model.PermAdmin, user.MFAPolicy),
+		"POST": Require(model.PermAdmin, user.SetMFAPolicy),
+	}))
+	mux.Handle("/admin/mfa/reset", POST(Require(model.PermAdmin, user.ResetMFA)))
 	mux.Handle("/login", handler(user.LoginHandler))
+	mux.Handle("/login/mfa", handler(user.MFALoginHandler))
+	if s.sso != nil {
+		sso := &controller.SSO{Provider: s.sso, Users: s.store, Identities: s.store}
+		mux.Handle("/login/oidc", GET(sso.Login))
+		mux.Handle("/login/oidc/callback", GET(sso.Callback))
+	}
+	mux.Handle("/password/forgot", handler(user.ForgotPasswordHandler))
+	mux.Handle("/password/reset", handler(user.ResetPasswordHandler))
+	mux.Handle("/verify", GET(user.VerifyEmail))
+	mux.Handle("/verify/resend", POST(Auth(user.ResendVerification)))
 	mux.Handle("/static", http.FileServer(http.Dir("./static")))
-	s.handler = mux
+	s.handler = LoadUser(s.store, s.store, RequireMFA(s.store, mux))
 }